@@ -0,0 +1,67 @@
+const MIN_RETRY = 1000; //ms before the first reconnect
+const MAX_RETRY = 30000; //ms between reconnects at most
+
+// AquariumSocket receives the events of an aquarium over the WebSocket like an EventSource and sends
+// the messages of the display back. It reconnects by itself and resumes after the last event.
+export class AquariumSocket extends EventTarget {
+  path: string
+  // params are sent with every connect, e.g. the display name and the slot
+  params: URLSearchParams
+  socket?: WebSocket
+  lastEventId = ''
+  retry = MIN_RETRY
+  closed = false
+
+  constructor(path: string, params: URLSearchParams) {
+    super()
+    this.path = path
+    this.params = params
+    this.connect()
+  }
+
+  connect() {
+    const url = new URL(this.path, window.location.href)
+    url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:'
+    url.search = this.params.toString()
+    if (this.lastEventId) {
+      url.searchParams.set('lastEventId', this.lastEventId)
+    }
+
+    const socket = new WebSocket(url)
+    this.socket = socket
+    socket.addEventListener('open', () => {
+      this.retry = MIN_RETRY
+      this.dispatchEvent(new MessageEvent('open'))
+    })
+    socket.addEventListener('message', (event) => {
+      const msg = JSON.parse(event.data)
+      if (msg.id) {
+        this.lastEventId = msg.id
+      }
+      this.dispatchEvent(new MessageEvent(msg.event, { data: JSON.stringify(msg.data), lastEventId: msg.id ?? '' }))
+    })
+    socket.addEventListener('close', () => {
+      if (this.closed) {
+        return
+      }
+      setTimeout(() => this.connect(), this.retry)
+      this.retry = Math.min(this.retry * 2, MAX_RETRY)
+    })
+  }
+
+  addEventListener(type: string, listener: (event: MessageEvent) => void) {
+    super.addEventListener(type, listener as EventListener)
+  }
+
+  // send drops messages while the socket reconnects, the display sends its state again on open
+  send(message: object) {
+    if (this.socket?.readyState === WebSocket.OPEN) {
+      this.socket.send(JSON.stringify(message))
+    }
+  }
+
+  close() {
+    this.closed = true
+    this.socket?.close()
+  }
+}
@@ -13,14 +13,28 @@ const parsedFont = fontLoader.parse(font);
 
 const SPEED = 0.009; //how fast the boids travel
 const AVOIDANCE_RADIUS = 0.0025; //the radius of the boid's sightline to the walls
+const SEP_RADIUS = 0.3; //how close neighboids may come
 const SEP_WEIGHT = 1; //how much the boid separates itself from it's neighboids
 const AVO_WEIGHT = 0.2; //how much the boid dodges the walls
 const RAN_WEIGHT = 0.003; //how much the boid goes in a random direction
 const INERTIA = 0.02; //the proportion with which the rules should affect the current speed
+const ALI_WEIGHT = 0.3; //how much the boid follows the direction of it's flock
+const LARGE_AREA = 200000; //drawn pixels of a fish that swims slowest
 
 
 const flock = ['A', 'B'] as const;
 
+// attributes the server derives from the drawing
+export interface FishAttributes {
+  colors: string[]
+  width: number
+  height: number
+  area: number
+  aspect_ratio: number
+  complexity: number
+  facing: 'left' | 'right'
+}
+
 export class Boid {
   position: Vector3;
   velocity: Vector3;
@@ -29,13 +43,23 @@ export class Boid {
   group: Group
   mesh: Mesh
   material: ShaderMaterial
-  flock: typeof flock[number] = flock[Math.floor(Math.random() * flock.length)];
+  flock: string = flock[Math.floor(Math.random() * flock.length)];
+  speed = SPEED;
 
-  constructor(game: Game, position: Vector3, velocity: Vector3, name: string = 'fish', texture: Texture = defaultTexture) {
+  constructor(game: Game, position: Vector3, velocity: Vector3, name: string = 'fish', texture: Texture = defaultTexture, attributes?: FishAttributes) {
     this.game = game;
     this.position = position;
     this.velocity = velocity;
 
+    if (attributes) {
+      // big and detailed drawings swim slower
+      const size = Math.min(attributes.area / LARGE_AREA, 1);
+      this.speed = SPEED * (1.3 - 0.6 * size) * (1.15 - 0.3 * attributes.complexity);
+      if (attributes.colors.length > 0) {
+        this.flock = colorFlock(attributes.colors[0]);
+      }
+    }
+
     // const material = new MeshBasicMaterial({ map: texture, transparent: true, side: DoubleSide, wireframe: true });
     this.material = new ShaderMaterial({
       vertexShader,
@@ -51,6 +75,10 @@ export class Boid {
     const geometry = new PlaneGeometry(0.6, 0.6, 20, 20);
     this.mesh = new Mesh(geometry, this.material)
     this.mesh.rotation.set(0, -Math.PI / 2, 0); 
+    // the right side of the texture leads, mirror drawings with the head on the left
+    if (attributes?.facing === 'left') {
+      this.mesh.scale.x = -1;
+    }
 
     this.group = new Group();
     this.group.add(this.mesh);
@@ -74,17 +102,22 @@ export class Boid {
     this.game.scene.add(this.group);
   }
 
+  setTexture(texture: Texture) {
+    this.material.uniforms.uTexture.value = texture;
+  }
+
   move(deltaTime: number) {
 
 		/* apply all rules*/
 		const deltaV = this.separation();
+		deltaV.add(this.alignment());
 		deltaV.add(this.avoidance());
 		deltaV.add(this.randomness());
 		deltaV.multiplyScalar(INERTIA);
 
 		/* add rules to current velocity and update position */
 		this.velocity.add(deltaV);
-		this.velocity.clampLength(SPEED*0.5, SPEED);
+		this.velocity.clampLength(this.speed*0.5, this.speed);
     this.velocity.z = 0;
 
 		const scaledVel = this.velocity.clone();
@@ -113,6 +146,7 @@ export class Boid {
     const result = new Vector3(0, 0, 0);
     for (const b of this.neighborhood) {
       const dist = b.position.distanceTo(this.position);
+      if (dist > SEP_RADIUS) continue;
       const oppositeDir = this.position.clone();
       oppositeDir.sub(b.position);
       if (dist != 0) oppositeDir.divideScalar(dist);
@@ -122,18 +156,30 @@ export class Boid {
     return result;
   }
 
-  /* move away from walls when boid is close to hitting them */
+  /* swim in the direction of the neighboids */
+  alignment() {
+    const result = new Vector3(0, 0, 0);
+    for (const b of this.neighborhood) {
+      result.add(b.velocity);
+    }
+    if (result.lengthSq() === 0) return result;
+    result.normalize().multiplyScalar(ALI_WEIGHT);
+    return result;
+  }
+
+  /* move away from walls when boid is close to hitting them, sides with another display of the wall are open */
   avoidance() {
     const result = new Vector3(0, 0, 0);
-    if (Math.abs(this.position.x) + AVOIDANCE_RADIUS >= 3.85) {
+    const open = this.game.wallSides;
+    if (Math.abs(this.position.x) + AVOIDANCE_RADIUS >= 3.85 && !(this.position.x > 0 ? open.right : open.left)) {
       result.x = -Math.sign(this.position.x);
     }
     // below floor
-    if (this.position.y <= 0.3) {
+    if (this.position.y <= 0.3 && !open.bottom) {
       result.y = 1
     }
     // above ceiling
-    if (this.position.y >= 5) {
+    if (this.position.y >= 5 && !open.top) {
       result.y = -1
     }
     if (Math.abs(this.position.z) + AVOIDANCE_RADIUS >= 0.5) {
@@ -151,6 +197,22 @@ export class Boid {
 	}
 }
 
+/* fishes with a similar main color swim in the same flock */
+export function colorFlock(hex: string) {
+  const r = parseInt(hex.slice(1, 3), 16) / 255;
+  const g = parseInt(hex.slice(3, 5), 16) / 255;
+  const b = parseInt(hex.slice(5, 7), 16) / 255;
+  const max = Math.max(r, g, b);
+  const min = Math.min(r, g, b);
+  if (max - min < 0.15) return 'gray';
+
+  let hue = 0;
+  if (max === r) hue = ((g - b) / (max - min) + 6) % 6;
+  else if (max === g) hue = (b - r) / (max - min) + 2;
+  else hue = (r - g) / (max - min) + 4;
+  return ['red', 'yellow', 'green', 'cyan', 'blue', 'magenta'][Math.round(hue) % 6];
+}
+
 export function randomVector(xBound: number, yBound: number, zBound: number) {
   const x = Math.random() * 2 * xBound - xBound;
   const y = Math.random() * 2 * yBound - yBound;
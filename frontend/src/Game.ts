@@ -1,12 +1,48 @@
-import { PerspectiveCamera, Scene, WebGLRenderer, AmbientLight, BoxGeometry, MeshNormalMaterial, Mesh, PlaneGeometry, MeshBasicMaterial, DoubleSide, Color, TextureLoader, Texture } from "three";
+import { PerspectiveCamera, Scene, WebGLRenderer, AmbientLight, BoxGeometry, MeshNormalMaterial, Mesh, PlaneGeometry, MeshBasicMaterial, DoubleSide, Color, TextureLoader, Texture, Vector3 } from "three";
 import { Boid, randomVector } from "./Boid";
 import ImmersiveControls from '@depasquale/three-immersive-controls';
 import { gradientShaderMaterial } from "./Gradient";
 import GUI from 'lil-gui'; 
+import { AquariumSocket } from "./AquariumSocket";
 
 const NUM_BOIDS = 0;
+const NEIGHBOR_RADIUS = 0.8; //how far a boid sees the boids of its flock
+const MAX_NEIGHBORS = 6;
+const NEIGHBOR_INTERVAL = 1000; //ms between neighborhood updates
+const SIM_DELAY = 200; //ms the server frames are shown late to blend between them
+const SIM_BOID_SIZE = 6; //bytes of a boid in a server frame
+const HANDOFF_INTERVAL = 200; //ms between two hand-offs, the server drops faster ones
+const TANK = { min_x: -3.85, min_y: 0.3, max_x: 3.85, max_y: 5 }; //where the boids swim in the scene
 
 const fishTextureMap = new Map<string, Texture>()
+const fishBoidsMap = new Map<string, Boid[]>()
+const fishDataMap = new Map<string, any>()
+
+// a frame of the server simulation, boids is x, y and heading as uint16 per boid
+interface SimFrame {
+  received: number
+  boids: DataView
+}
+
+// the part of the wall canvas the display shows in pixels, slot is -1 without wall
+interface Viewport {
+  slot: number
+  x: number
+  y: number
+  width: number
+  height: number
+  canvas_width: number
+  canvas_height: number
+  time: number
+}
+
+// the sides of the tank where the boids swim on to the next display
+export interface WallSides {
+  left: boolean
+  right: boolean
+  top: boolean
+  bottom: boolean
+}
 
 export class Game {
   boids: Boid[] = [];
@@ -93,7 +129,30 @@ export class Game {
   }
 
   async initServerConnection() {
-    const evtSource = new EventSource("/aquarium/38d7976d-3c27-4e74-8bfe-a9ec44318d3f/sse");
+    // ?display=Foyer names the display on the Admin Panel
+    // ?slot=auto or ?slot=<n> shows a part of a wall of displays
+    const query = new URLSearchParams(window.location.search)
+    const params = new URLSearchParams({ display: query.get('display') ?? '', slot: query.get('slot') ?? '' })
+    // the WebSocket carries the claims and hand-offs of the wall back to the server
+    const evtSource = new AquariumSocket(`/aquarium/38d7976d-3c27-4e74-8bfe-a9ec44318d3f/ws`, params);
+    this.socket = evtSource
+
+    evtSource.addEventListener("open", () => {
+      evtSource.send({ type: 'viewport', width: window.innerWidth, height: window.innerHeight })
+      evtSource.send({ type: 'time', client: Date.now() })
+    });
+    window.addEventListener('resize', () => {
+      evtSource.send({ type: 'viewport', width: window.innerWidth, height: window.innerHeight })
+    });
+
+    // another slot of the wall, auto takes the first free one
+    const wall = { slot: params.get('slot') ?? '' }
+    this.gui.add(wall, 'slot').name('Wand-Slot').onFinishChange((value: string) => {
+      params.set('slot', value)
+      const slot = parseInt(value, 10)
+      evtSource.send(isNaN(slot) ? { type: 'claim' } : { type: 'claim', slot })
+    });
+
     evtSource.addEventListener("ping", (event) => {
       console.log('ping', event.data)
     });
@@ -103,32 +162,385 @@ export class Game {
       const fish = JSON.parse(event.data);
       console.log(fish)
 
+      fishDataMap.set(fish.id, fish)
+
+      // a fish can arrive twice while the snapshot of a reconnect overlaps with live events
+      if (!this.simulated) {
+        if (fishBoidsMap.has(fish.id)) {
+          return
+        }
+        fishBoidsMap.set(fish.id, [])
+      }
+
       // load texture
       if(!fishTextureMap.has(fish.id)) {
-        const imageReponse = await fetch(`/aquarium/38d7976d-3c27-4e74-8bfe-a9ec44318d3f/fishes/${fish.filename}`)
+        const imageReponse = await fetch(`/aquarium/38d7976d-3c27-4e74-8bfe-a9ec44318d3f/fishes/${fish.filename}?size=medium&v=${Date.parse(fish.updated_at)}`)
         const imageBlob = await imageReponse.blob()
         const texture = new TextureLoader().load(URL.createObjectURL(imageBlob));
         fishTextureMap.set(fish.id, texture)
       }
 
+      // the server moves the boids, they come with the keyframe
+      if (this.simulated) {
+        for (const boid of fishBoidsMap.get(fish.id) ?? []) {
+          boid.setTexture(fishTextureMap.get(fish.id)!)
+        }
+        return
+      }
+
       // loop for 50 times
+      const fishBoids = fishBoidsMap.get(fish.id) ?? []
       for (let i = 0; i < 50; i++) {
         const position = randomVector(5, 1.3, 1.5)
         position.y = position.y +2
-        const boid = new Boid(this, position, randomVector(1, 0, 1), fish.name, fishTextureMap.get(fish.id));
+        const boid = new Boid(this, position, randomVector(1, 0, 1), fish.name, fishTextureMap.get(fish.id), fish.attributes);
+        boid.group.visible = this.startsHere(i);
         this.boids.push(boid);
+        fishBoids.push(boid);
       }
+      fishBoidsMap.set(fish.id, fishBoids)
       
     });
+
+    evtSource.addEventListener("fishleft", (event) => {
+      console.log('fishleft', event.data)
+      const fish = JSON.parse(event.data);
+
+      const fishBoids = fishBoidsMap.get(fish.id) ?? []
+      for (const boid of fishBoids) {
+        this.scene.remove(boid.group)
+      }
+      this.boids = this.boids.filter((boid) => !fishBoids.includes(boid))
+      fishBoidsMap.delete(fish.id)
+      fishDataMap.delete(fish.id)
+    });
+
+    evtSource.addEventListener("fishupdate", async (event) => {
+      console.log('fishupdate', event.data)
+      const fish = JSON.parse(event.data);
+      // e.g. renamed by the uploader
+      fishDataMap.set(fish.id, fish)
+
+      // swap the texture, the image changed but the url did not
+      const imageReponse = await fetch(`/aquarium/38d7976d-3c27-4e74-8bfe-a9ec44318d3f/fishes/${fish.filename}?size=medium&v=${Date.parse(fish.updated_at)}`)
+      const imageBlob = await imageReponse.blob()
+      const texture = new TextureLoader().load(URL.createObjectURL(imageBlob));
+      fishTextureMap.get(fish.id)?.dispose()
+      fishTextureMap.set(fish.id, texture)
+
+      for (const boid of fishBoidsMap.get(fish.id) ?? []) {
+        boid.setTexture(texture)
+      }
+    });
+
+    evtSource.addEventListener("resync", (event) => {
+      // events were lost, all fishes are sent again
+      console.log('resync', event.data)
+      // the boids of the server simulation stay, only the fishes are sent again
+      if (!this.simulated) {
+        this.removeAllFishes()
+      }
+    });
+
+    evtSource.addEventListener("restarting", (event) => {
+      // EventSource reconnects by itself, the restarted server sends all fishes again
+      console.log('restarting', event.data)
+      this.stopSimulation()
+    });
+
+    // the server simulates the aquarium, the keyframe lists the boids of the frames
+    evtSource.addEventListener("simkeyframe", (event) => {
+      console.log('simkeyframe', event.data)
+      const keyframe = JSON.parse(event.data)
+      if (!this.simulated) {
+        this.removeAllFishes()
+        this.simulated = true
+      }
+
+      // boids of fishes that still swim are kept
+      const previous = new Map(fishBoidsMap)
+      fishBoidsMap.clear()
+      this.simBoids = []
+      for (const { fish_id, boids } of keyframe.fishes) {
+        const fish = fishDataMap.get(fish_id)
+        const fishBoids = previous.get(fish_id) ?? []
+        previous.delete(fish_id)
+        while (fishBoids.length > boids) {
+          this.scene.remove(fishBoids.pop()!.group)
+        }
+        while (fishBoids.length < boids) {
+          const position = new Vector3(0, 0, Math.random() - 0.5)
+          fishBoids.push(new Boid(this, position, new Vector3(1, 0, 0), fish?.name, fishTextureMap.get(fish_id), fish?.attributes))
+        }
+        fishBoidsMap.set(fish_id, fishBoids)
+        this.simBoids.push(...fishBoids)
+      }
+      for (const fishBoids of previous.values()) {
+        for (const boid of fishBoids) {
+          this.scene.remove(boid.group)
+        }
+      }
+
+      this.boids = [...this.simBoids]
+      this.simBounds = keyframe
+      this.simFrames = []
+    });
+
+    evtSource.addEventListener("simframe", (event) => {
+      const frame = JSON.parse(event.data)
+      const bytes = Uint8Array.from(atob(frame.boids), (c) => c.charCodeAt(0))
+      if (!this.simulated || bytes.length !== this.simBoids.length * SIM_BOID_SIZE) {
+        return
+      }
+      this.simFrames.push({ received: performance.now(), boids: new DataView(bytes.buffer) })
+      if (this.simFrames.length > 4) {
+        this.simFrames.shift()
+      }
+    });
+
+    // the simulation was turned off, all fishes are sent again and swim on their own
+    evtSource.addEventListener("simstop", (event) => {
+      console.log('simstop', event.data)
+      this.stopSimulation()
+    });
+
+    // viewer count and commands of moderators
+    const viewers = document.createElement('div')
+    viewers.style.cssText = 'position:fixed;left:10px;bottom:10px;color:#fff;font-family:sans-serif;opacity:0.7'
+    document.body.appendChild(viewers)
+    evtSource.addEventListener("viewers", (event) => {
+      const { count } = JSON.parse(event.data)
+      viewers.textContent = `${count} schauen zu`
+    });
+
+    evtSource.addEventListener("reload", () => {
+      window.location.reload()
+    });
+
+    evtSource.addEventListener("disconnect", () => {
+      // the socket would reconnect by itself
+      evtSource.close()
+      viewers.textContent = 'Getrennt'
+    });
+
+    // the part of the wall this display shows, the boids of the fishes are shared out again
+    evtSource.addEventListener("viewport", (event) => {
+      const viewport: Viewport = JSON.parse(event.data)
+      this.clockOffset = viewport.time - Date.now()
+      console.log('viewport', viewport)
+
+      this.viewport = viewport.slot >= 0 ? viewport : undefined
+      this.wallSides = {
+        left: !!this.viewport && viewport.x > 0,
+        right: !!this.viewport && viewport.x + viewport.width < viewport.canvas_width,
+        top: !!this.viewport && viewport.y > 0,
+        bottom: !!this.viewport && viewport.y + viewport.height < viewport.canvas_height,
+      }
+      for (const fishBoids of fishBoidsMap.values()) {
+        fishBoids.forEach((boid, i) => boid.group.visible = this.simulated || this.startsHere(i))
+      }
+    });
+
+    // the round trip of the time request is split evenly
+    evtSource.addEventListener("time", (event) => {
+      const { client, server } = JSON.parse(event.data)
+      const now = Date.now()
+      this.clockOffset = server + (now - client) / 2 - now
+    });
+
+    // a boid swims over from another display of the wall
+    evtSource.addEventListener("fishhandoff", (event) => {
+      const handoff = JSON.parse(event.data)
+      const viewport = this.viewport
+      if (!viewport || this.simulated || handoff.from === viewport.slot) {
+        return
+      }
+
+      // where the boid is now on the shared timeline
+      const elapsed = Math.max(Date.now() + this.clockOffset - handoff.time, 0) / 1000
+      const x = handoff.x + handoff.vx * elapsed
+      const y = handoff.y + handoff.vy * elapsed
+      const boid = fishBoidsMap.get(handoff.fish_id)?.[handoff.boid]
+      if (!boid || x < viewport.x || x >= viewport.x + viewport.width || y < viewport.y || y >= viewport.y + viewport.height) {
+        return
+      }
+
+      const scaleX = (TANK.max_x - TANK.min_x) / viewport.width
+      const scaleY = (TANK.max_y - TANK.min_y) / viewport.height
+      boid.position.x = TANK.min_x + (x - viewport.x) * scaleX
+      boid.position.y = TANK.max_y - (y - viewport.y) * scaleY
+      boid.velocity.set(handoff.vx * scaleX / 60, -handoff.vy * scaleY / 60, 0)
+      boid.group.visible = true
+      boid.updateShape()
+    });
+
+    evtSource.addEventListener("aquariumsettings", (event) => {
+      // nothing on the display depends on the settings yet
+      console.log('aquariumsettings', event.data)
+    });
+
+    // interactions of visitors over the WebSocket
+    evtSource.addEventListener("feed", (event) => {
+      console.log('feed', event.data)
+    });
+
+    evtSource.addEventListener("fishtap", (event) => {
+      console.log('fishtap', event.data)
+    });
+  }
+
+  /* without wall every boid swims here, on a wall every display starts with its share of them */
+  startsHere(index: number) {
+    const viewport = this.viewport
+    if (!viewport) {
+      return true
+    }
+    const slots = Math.round(viewport.canvas_width / viewport.width) * Math.round(viewport.canvas_height / viewport.height)
+    return index % slots === viewport.slot
   }
 
+  /* a boid leaving the tank on a side with another display swims over to it */
+  handOver(boid: Boid, time: number) {
+    const viewport = this.viewport
+    if (!viewport) {
+      return
+    }
+
+    const { x, y } = boid.position
+    const side = x < TANK.min_x ? 'left' : x > TANK.max_x ? 'right' : y > TANK.max_y ? 'top' : y < TANK.min_y ? 'bottom' : undefined
+    if (!side || !this.wallSides[side]) {
+      return
+    }
+
+    // the server drops hand-offs sent too fast, the boid turns around instead
+    if (time - this.lastHandoff < HANDOFF_INTERVAL) {
+      boid.position.x = Math.min(Math.max(x, TANK.min_x), TANK.max_x)
+      boid.position.y = Math.min(Math.max(y, TANK.min_y), TANK.max_y)
+      if (side === 'left' || side === 'right') {
+        boid.velocity.x = -boid.velocity.x
+      } else {
+        boid.velocity.y = -boid.velocity.y
+      }
+      return
+    }
+
+    for (const [fishID, fishBoids] of fishBoidsMap) {
+      const index = fishBoids.indexOf(boid)
+      if (index < 0) {
+        continue
+      }
+
+      // canvas pixels and pixels per second, the scene moves by velocity every 1/60 second
+      const scaleX = viewport.width / (TANK.max_x - TANK.min_x)
+      const scaleY = viewport.height / (TANK.max_y - TANK.min_y)
+      this.socket?.send({ type: 'handoff', handoff: {
+        fish_id: fishID,
+        boid: index,
+        x: viewport.x + (x - TANK.min_x) * scaleX,
+        y: viewport.y + (TANK.max_y - y) * scaleY,
+        vx: boid.velocity.x * 60 * scaleX,
+        vy: -boid.velocity.y * 60 * scaleY,
+        time: Date.now() + this.clockOffset,
+      }})
+      boid.group.visible = false
+      this.lastHandoff = time
+      return
+    }
+  }
+
+  removeAllFishes() {
+    for (const boid of this.boids) {
+      this.scene.remove(boid.group)
+    }
+    this.boids = []
+    fishBoidsMap.clear()
+  }
+
+  stopSimulation() {
+    this.removeAllFishes()
+    // the fishes are sent again and shared out over the wall
+    this.simulated = false
+    this.simBoids = []
+    this.simFrames = []
+  }
+
+  /* place the boids between the two server frames around the time shown */
+  interpolateSimulation(time: number) {
+    const shown = time - SIM_DELAY
+    let from = 0
+    while (from + 1 < this.simFrames.length && this.simFrames[from + 1].received <= shown) {
+      from++
+    }
+    const a = this.simFrames[from]
+    const b = this.simFrames[from + 1] ?? a
+    if (!a) {
+      return
+    }
+    const t = b === a ? 0 : Math.min(Math.max((shown - a.received) / (b.received - a.received), 0), 1)
+
+    const { min_x, min_y, max_x, max_y } = this.simBounds
+    const read = (frame: SimFrame, i: number, field: number) => frame.boids.getUint16(i * SIM_BOID_SIZE + field * 2, true) / 65535
+    for (let i = 0; i < this.simBoids.length; i++) {
+      const boid = this.simBoids[i]
+      boid.position.x = min_x + (read(a, i, 0) + (read(b, i, 0) - read(a, i, 0)) * t) * (max_x - min_x)
+      boid.position.y = min_y + (read(a, i, 1) + (read(b, i, 1) - read(a, i, 1)) * t) * (max_y - min_y)
+
+      // the shorter way around the circle
+      let turn = read(b, i, 2) - read(a, i, 2)
+      if (turn > 0.5) turn -= 1
+      if (turn < -0.5) turn += 1
+      const heading = ((read(a, i, 2) + turn * t) * 2 - 1) * Math.PI
+      boid.velocity.set(Math.cos(heading), Math.sin(heading), 0).multiplyScalar(boid.speed)
+      boid.updateShape()
+    }
+  }
+
+  /* boids only see the nearest boids of their own flock */
+  updateNeighborhoods() {
+    const visible = this.boids.filter((b) => b.group.visible)
+    for (const b of visible) {
+      b.neighborhood = visible
+        .filter((o) => o !== b && o.flock === b.flock && o.position.distanceTo(b.position) < NEIGHBOR_RADIUS)
+        .sort((x, y) => x.position.distanceTo(b.position) - y.position.distanceTo(b.position))
+        .slice(0, MAX_NEIGHBORS);
+    }
+  }
+
+  // simulated is set while the server moves the boids, simBoids are in the order of its frames
+  simulated = false
+  simBoids: Boid[] = []
+  simFrames: SimFrame[] = []
+  simBounds = { min_x: -3.85, min_y: 0.3, max_x: 3.85, max_y: 5 }
+
+  // clockOffset is the difference of the server clock to the local clock in milliseconds
+  clockOffset = 0
+  // viewport is the part of the wall the display shows, wallSides the sides with another display
+  socket?: AquariumSocket
+  viewport?: Viewport
+  wallSides: WallSides = { left: false, right: false, top: false, bottom: false }
+  lastHandoff = 0
   lastTime = 0
+  lastNeighborhoodUpdate = 0
   animate(time: number) {
     const deltaTime = time - this.lastTime;
     this.lastTime = time;
 
-    for (const b of this.boids) {
-      b.move(deltaTime);
+    if (this.simulated) {
+      this.interpolateSimulation(time);
+    } else {
+      if (time - this.lastNeighborhoodUpdate > NEIGHBOR_INTERVAL) {
+        this.lastNeighborhoodUpdate = time;
+        this.updateNeighborhoods();
+      }
+
+      for (const b of this.boids) {
+        // boids on other displays of the wall wait for their hand-off
+        if (!b.group.visible) {
+          continue;
+        }
+        b.move(deltaTime);
+        this.handOver(b, time);
+      }
     }
 
     this.testMesh.rotation.x = time / 2000;
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+)
+
+// newBroker creates the pubsub of the aquarium events. With AQUARIUM_NATS_URL the events are
+// shared with all servers connected to the NATS server, e.g. replicas behind a load balancer.
+func newBroker(log *slog.Logger) (pubsub.Broker[models.Event], error) {
+	ps := pubsub.NewPubSub[models.Event]()
+
+	// what happens with slow subscribers, e.g. AQUARIUM_PUBSUB_OVERFLOW=block AQUARIUM_PUBSUB_BLOCK_TIMEOUT=200ms
+	overflow, err := pubsub.ParseOverflowPolicy(os.Getenv("AQUARIUM_PUBSUB_OVERFLOW"))
+	if err != nil {
+		return nil, err
+	}
+	blockTimeout := pubsub.DefaultBlockTimeout
+	if raw := os.Getenv("AQUARIUM_PUBSUB_BLOCK_TIMEOUT"); raw != "" {
+		if blockTimeout, err = time.ParseDuration(raw); err != nil {
+			return nil, err
+		}
+	}
+	ps.SetOverflow(overflow, blockTimeout)
+
+	url := os.Getenv("AQUARIUM_NATS_URL")
+	if url == "" {
+		return ps, nil
+	}
+
+	log.Info("Connecting to NATS", slog.String("url", url))
+	return pubsub.NewNATS(log, ps, url, "fish")
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/superbarne/fish/jobs"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/storage"
+)
+
+func NewReprocessCmd() *cobra.Command {
+	var aquarium, fish string
+
+	reprocessCmd := &cobra.Command{
+		Use:   "reprocess",
+		Short: "Run the image pipeline again on the stored originals",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var aquariumID, fishID uuid.UUID
+			var err error
+
+			if aquarium != "" {
+				if aquariumID, err = uuid.Parse(aquarium); err != nil {
+					return err
+				}
+			}
+			if fish != "" {
+				if fishID, err = uuid.Parse(fish); err != nil {
+					return err
+				}
+			}
+
+			reprocess(aquariumID, fishID)
+			return nil
+		},
+	}
+
+	reprocessCmd.Flags().StringVar(&aquarium, "aquarium", "", "only fishes of this aquarium")
+	reprocessCmd.Flags().StringVar(&fish, "fish", "", "only the upload of this fish")
+
+	return reprocessCmd
+}
+
+func reprocess(aquariumID uuid.UUID, fishID uuid.UUID) {
+	log := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+	}))
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	// with NATS the displays see the reprocessed fishes
+	ps, err := newBroker(log)
+	if err != nil {
+		log.Error("Failed to create pubsub", slog.String("error", err.Error()))
+		os.Exit(1)
+		return
+	}
+	defer ps.Close()
+
+	store := storage.NewStorage("./data")
+	processor := jobs.NewProcessor(log, store, ps)
+
+	uploads, err := store.Jobs()
+	if err != nil {
+		log.Error("Failed to get jobs", slog.String("error", err.Error()))
+		os.Exit(1)
+		return
+	}
+
+	for _, job := range uploads {
+		if aquariumID != uuid.Nil && job.AquariumID != aquariumID {
+			continue
+		}
+		if fishID != uuid.Nil && !slices.Contains(job.FishIDs, fishID) {
+			continue
+		}
+
+		if err := processor.Process(ctx, job); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Error("Failed to reprocess", slog.String("job", job.ID.String()), slog.String("error", err.Error()))
+			continue
+		}
+
+		job.Status = models.JobStatusDone
+		job.Error = ""
+		if err := store.InsertJob(job); err != nil {
+			log.Error("Failed to save job", slog.String("job", job.ID.String()), slog.String("error", err.Error()))
+			continue
+		}
+
+		log.Info("Reprocessed", slog.String("job", job.ID.String()), slog.Int("fishes", len(job.FishIDs)))
+	}
+}
@@ -15,6 +15,8 @@ func NewRootCmd() *cobra.Command {
 	}
 
 	rootCmd.AddCommand(NewServeCmd())
+	rootCmd.AddCommand(NewReprocessCmd())
+	rootCmd.AddCommand(NewSnapshotCmd())
 
 	return rootCmd
 }
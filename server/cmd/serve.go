@@ -6,12 +6,13 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"runtime"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/superbarne/fish/jobs"
 	"github.com/superbarne/fish/models"
-	"github.com/superbarne/fish/pubsub"
 	"github.com/superbarne/fish/storage"
 	"github.com/superbarne/fish/webserver"
 )
@@ -38,7 +39,12 @@ func serve() {
 	commit := gitCommit()
 	log.Info("Aquarium", slog.String("commit", commit))
 
-	ps := pubsub.NewPubSub()
+	ps, err := newBroker(log)
+	if err != nil {
+		log.Error("Failed to create pubsub", slog.String("error", err.Error()))
+		os.Exit(1)
+		return
+	}
 	store := storage.NewStorage("./data")
 
 	// create default aquarium
@@ -51,7 +57,20 @@ func serve() {
 		return
 	}
 
-	server := webserver.NewWebServer(log, ps, store, commit)
+	// keep originals for reprocessing, e.g. AQUARIUM_ORIGINAL_RETENTION=720h
+	var retention time.Duration
+	if raw := os.Getenv("AQUARIUM_ORIGINAL_RETENTION"); raw != "" {
+		if retention, err = time.ParseDuration(raw); err != nil {
+			log.Error("Invalid original retention", slog.String("error", err.Error()))
+			os.Exit(1)
+			return
+		}
+	}
+
+	queue := jobs.NewQueue(log, store, jobs.NewProcessor(log, store, ps), runtime.NumCPU(), 100, retention)
+	queue.Start(ctx)
+
+	server := webserver.NewWebServer(log, ps, store, queue, commit)
 
 	go func() {
 		defer cancel()
@@ -68,5 +87,10 @@ func serve() {
 
 	log.Info("Server shutdown...")
 
+	// end the SSE streams, Shutdown waits for them otherwise
+	ps.Close()
 	server.Shutdown(timeout)
+
+	// running jobs stop and continue on the next start
+	queue.Wait()
 }
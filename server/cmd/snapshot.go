@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/superbarne/fish/snapshot"
+	"github.com/superbarne/fish/storage"
+)
+
+func NewSnapshotCmd() *cobra.Command {
+	var aquarium, format, output string
+	var seed uint64
+
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Render the approved fishes of an aquarium to a picture or an animated loop",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			aquariumID, err := uuid.Parse(aquarium)
+			if err != nil {
+				return err
+			}
+			if !cmd.Flags().Changed("seed") {
+				seed = snapshot.DefaultSeed(aquariumID)
+			}
+			if output == "" {
+				output = "aquarium-" + aquariumID.String() + "." + format
+			}
+
+			return renderSnapshot(aquariumID, seed, snapshot.Format(format), output)
+		},
+	}
+
+	snapshotCmd.Flags().StringVar(&aquarium, "aquarium", "", "the aquarium to render")
+	snapshotCmd.Flags().Uint64Var(&seed, "seed", 0, "seed of the layout (default from the aquarium)")
+	snapshotCmd.Flags().StringVar(&format, "format", string(snapshot.PNG), "png or gif")
+	snapshotCmd.Flags().StringVarP(&output, "output", "o", "", "file to write (default aquarium-<aquariumID>.<format>)")
+	snapshotCmd.MarkFlagRequired("aquarium")
+
+	return snapshotCmd
+}
+
+func renderSnapshot(aquariumID uuid.UUID, seed uint64, format snapshot.Format, output string) error {
+	store := storage.NewStorage("./data")
+	if _, err := store.Aquarium(aquariumID); err != nil {
+		return errors.New("aquarium not found")
+	}
+
+	path, _, err := snapshot.NewRenderer(store).Render(aquariumID, seed, format)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,115 @@
+package imageprocess
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+
+	"github.com/superbarne/fish/models"
+)
+
+const (
+	// maxColors is the maximum number of dominant colors
+	maxColors = 3
+	// minColorShare is the share of drawn pixels a color needs to count as dominant
+	minColorShare = 0.05
+)
+
+type colorBucket struct {
+	count   int
+	r, g, b int
+}
+
+// Analyze derives the attributes of a fish from its processed image.
+// Returns nil if nothing is drawn.
+func Analyze(fish image.Image) *models.FishAttributes {
+	bounds := fish.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	drawn := func(x, y int) bool {
+		if x < 0 || y < 0 || x >= w || y >= h {
+			return false
+		}
+		_, _, _, a := fish.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+		return a > 0
+	}
+
+	area, border := 0, 0
+	sumX := 0
+	box := image.Rectangle{}
+	buckets := map[int]*colorBucket{}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if !drawn(x, y) {
+				continue
+			}
+
+			area++
+			sumX += x
+			box = box.Union(image.Rect(x, y, x+1, y+1))
+			if !drawn(x-1, y) || !drawn(x+1, y) || !drawn(x, y-1) || !drawn(x, y+1) {
+				border++
+			}
+
+			// 4 bits per channel are enough to group similar colors
+			r, g, b, _ := fish.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			key := int(r>>12)<<8 | int(g>>12)<<4 | int(b>>12)
+			bucket, ok := buckets[key]
+			if !ok {
+				bucket = &colorBucket{}
+				buckets[key] = bucket
+			}
+			bucket.count++
+			bucket.r += int(r >> 8)
+			bucket.g += int(g >> 8)
+			bucket.b += int(b >> 8)
+		}
+	}
+
+	if area == 0 {
+		return nil
+	}
+
+	attributes := &models.FishAttributes{
+		Colors:      dominantColors(buckets, area),
+		Width:       box.Dx(),
+		Height:      box.Dy(),
+		Area:        area,
+		AspectRatio: round(float64(box.Dx()) / float64(box.Dy())),
+		Facing:      models.FacingRight,
+	}
+
+	// a circle has the smallest border for its area
+	compactness := 4 * math.Pi * float64(area) / float64(border*border)
+	attributes.Complexity = round(math.Max(0, math.Min(1, 1-compactness)))
+
+	// the body is heavier than the tail, so the head is on the side with more pixels
+	center := float64(sumX)/float64(area) + 0.5
+	if center < float64(box.Min.X)+float64(box.Dx())/2 {
+		attributes.Facing = models.FacingLeft
+	}
+
+	return attributes
+}
+
+func dominantColors(buckets map[int]*colorBucket, area int) []string {
+	sorted := make([]*colorBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		sorted = append(sorted, bucket)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].count > sorted[j].count
+	})
+
+	colors := []string{}
+	for _, bucket := range sorted {
+		if len(colors) == maxColors || float64(bucket.count) < minColorShare*float64(area) {
+			break
+		}
+		colors = append(colors, fmt.Sprintf("#%02x%02x%02x", bucket.r/bucket.count, bucket.g/bucket.count, bucket.b/bucket.count))
+	}
+
+	return colors
+}
@@ -0,0 +1,47 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+func TestAnalyze(t *testing.T) {
+	t.Parallel()
+
+	// red body on the right, thin blue tail on the left
+	img := image.NewRGBA(image.Rect(0, 0, 120, 60))
+	draw.Draw(img, image.Rect(40, 10, 110, 50), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(10, 25, 40, 35), image.NewUniform(color.RGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+
+	attributes := Analyze(img)
+	require.NotNil(t, attributes)
+	assert.Equal(t, []string{"#ff0000", "#0000ff"}, attributes.Colors)
+	assert.Equal(t, 100, attributes.Width)
+	assert.Equal(t, 40, attributes.Height)
+	assert.Equal(t, 70*40+30*10, attributes.Area)
+	assert.InDelta(t, 2.5, attributes.AspectRatio, 0.01)
+	assert.Equal(t, models.FacingRight, attributes.Facing)
+	assert.Greater(t, attributes.Complexity, 0.0)
+	assert.Less(t, attributes.Complexity, 1.0)
+
+	// mirrored
+	flipped := image.NewRGBA(img.Bounds())
+	for y := 0; y < 60; y++ {
+		for x := 0; x < 120; x++ {
+			flipped.Set(119-x, y, img.At(x, y))
+		}
+	}
+	assert.Equal(t, models.FacingLeft, Analyze(flipped).Facing)
+}
+
+func TestAnalyzeEmpty(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, Analyze(image.NewRGBA(image.Rect(0, 0, 20, 20))))
+}
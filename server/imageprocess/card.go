@@ -0,0 +1,80 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"strconv"
+	"time"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// The fish card is a portrait picture (4:5) that fits phones and social media
+const (
+	CardWidth  = 1080
+	CardHeight = 1350
+
+	cardMargin = 60
+	// cardPanel is the height of the white panel with the texts at the bottom
+	cardPanel = 330
+)
+
+var (
+	cardTextColor = color.RGBA{0x1e, 0x84, 0xc5, 0xff}
+	cardDateColor = color.RGBA{0x66, 0x66, 0x66, 0xff}
+
+	germanMonths = [...]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli", "August", "September", "Oktober", "November", "Dezember"}
+)
+
+// RenderCard renders a take-home card of a fish with its name, the name of the aquarium and the date.
+// The fish stands in front of the aquarium backdrop, an empty aquarium name is left out.
+func RenderCard(fish image.Image, name, aquarium string, date time.Time) image.Image {
+	dc := gg.NewContext(CardWidth, CardHeight)
+
+	// backdrop and fish
+	dc.DrawImage(background(CardWidth, CardHeight-cardPanel), 0, 0)
+	area := CardHeight - cardPanel - 2*cardMargin
+	dc.DrawImageAnchored(Resize(fish, area), CardWidth/2, cardMargin+area/2, 0.5, 0.5)
+
+	// texts
+	dc.SetColor(color.White)
+	dc.DrawRectangle(0, CardHeight-cardPanel, CardWidth, cardPanel)
+	dc.Fill()
+
+	y := float64(CardHeight - cardPanel + cardMargin)
+	if bold, err := truetype.Parse(gobold.TTF); err == nil {
+		dc.SetColor(cardTextColor)
+		drawFitted(dc, bold, name, 96, y)
+		y += 130
+	}
+	if regular, err := truetype.Parse(goregular.TTF); err == nil {
+		if aquarium != "" {
+			dc.SetColor(cardTextColor)
+			drawFitted(dc, regular, aquarium, 48, y)
+			y += 70
+		}
+		dc.SetColor(cardDateColor)
+		drawFitted(dc, regular, GermanDate(date), 36, y)
+	}
+
+	return dc.Image()
+}
+
+// drawFitted draws text centered below y, the font size shrinks until the text fits the card
+func drawFitted(dc *gg.Context, f *truetype.Font, text string, size float64, y float64) {
+	for ; size > 12; size *= 0.9 {
+		dc.SetFontFace(truetype.NewFace(f, &truetype.Options{Size: size}))
+		if w, _ := dc.MeasureString(text); w <= CardWidth-2*cardMargin {
+			break
+		}
+	}
+	dc.DrawStringAnchored(text, CardWidth/2, y, 0.5, 1)
+}
+
+// GermanDate formats a date like "19. Oktober 2026"
+func GermanDate(t time.Time) string {
+	return strconv.Itoa(t.Day()) + ". " + germanMonths[t.Month()-1] + " " + strconv.Itoa(t.Year())
+}
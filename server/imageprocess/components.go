@@ -0,0 +1,103 @@
+package imageprocess
+
+import "image"
+
+// component is a connected blob of foreground pixels
+type component struct {
+	label  int
+	size   int
+	bounds image.Rectangle
+	labels [][]int
+
+	// sum of all pixel coordinates, used for the centroid
+	sumX, sumY int
+	// border is set if the blob touches the edge of the image
+	border bool
+}
+
+// centroid returns the center of mass of the blob
+func (c *component) centroid() (float64, float64) {
+	return float64(c.sumX)/float64(c.size) + 0.5, float64(c.sumY)/float64(c.size) + 0.5
+}
+
+// defaultMinComponentSize ignores blobs smaller than 0.5% of the image, e.g. specks of dirt or stray strokes
+func defaultMinComponentSize(bounds image.Rectangle) int {
+	size := bounds.Dx() * bounds.Dy() / 200
+	if size < 64 {
+		return 64
+	}
+	return size
+}
+
+// findComponents labels all 8-connected foreground (non background) pixels and
+// returns the blobs with at least minSize pixels in scan order.
+func findComponents(background [][]bool, minSize int) []*component {
+	h := len(background)
+	if h == 0 {
+		return nil
+	}
+	w := len(background[0])
+
+	labels := make([][]int, h)
+	for y := range labels {
+		labels[y] = make([]int, w)
+	}
+
+	directions := [8][2]int{
+		{1, 0}, {-1, 0}, {0, 1}, {0, -1}, {1, 1}, {1, -1}, {-1, 1}, {-1, -1},
+	}
+
+	components := []*component{}
+	label := 0
+	stack := []image.Point{}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if background[y][x] || labels[y][x] != 0 {
+				continue
+			}
+
+			label++
+			c := &component{
+				label:  label,
+				bounds: image.Rect(x, y, x+1, y+1),
+				labels: labels,
+			}
+
+			// iterative flood fill, drawings can be too large for recursion
+			labels[y][x] = label
+			stack = append(stack[:0], image.Pt(x, y))
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+
+				c.size++
+				c.sumX += p.X
+				c.sumY += p.Y
+				c.bounds = c.bounds.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+				if p.X == 0 || p.Y == 0 || p.X == w-1 || p.Y == h-1 {
+					c.border = true
+				}
+
+				for _, dir := range directions {
+					nx, ny := p.X+dir[0], p.Y+dir[1]
+					if nx < 0 || nx >= w || ny < 0 || ny >= h {
+						continue
+					}
+					if background[ny][nx] || labels[ny][nx] != 0 {
+						continue
+					}
+
+					labels[ny][nx] = label
+					stack = append(stack, image.Pt(nx, ny))
+				}
+			}
+
+			if c.size >= minSize {
+				components = append(components, c)
+			}
+		}
+	}
+
+	return components
+}
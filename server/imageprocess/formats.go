@@ -0,0 +1,54 @@
+package imageprocess
+
+import (
+	"errors"
+	"image"
+	"io"
+	"os"
+
+	// decoders for all accepted upload formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/gen2brain/heic"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Formats lists the accepted upload formats for humans
+const Formats = "JPG, PNG, HEIC, WebP, GIF, BMP, TIFF"
+
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+func init() {
+	// heic only registers the "heic" brand, iPhones write "heix" for 10 bit photos. The general HEIF
+	// brands mif1 and msf1 also start AVIF files and the decoder only supports HEIC still images.
+	image.RegisterFormat("heic", "????ftypheix", heic.Decode, heic.DecodeConfig)
+}
+
+// DetectFormat checks the header of an image and returns its format, e.g. "jpeg".
+func DetectFormat(r io.Reader) (string, error) {
+	_, format, err := image.DecodeConfig(r)
+	if err != nil {
+		return "", ErrUnsupportedFormat
+	}
+
+	return format, nil
+}
+
+// LoadImage decodes the image at path. Animated GIFs return their first frame.
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if errors.Is(err, image.ErrFormat) {
+		return nil, ErrUnsupportedFormat
+	}
+	return img, err
+}
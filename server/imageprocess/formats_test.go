@@ -0,0 +1,107 @@
+package imageprocess
+
+import (
+	"bytes"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+func TestLoadImageFormats(t *testing.T) {
+	t.Parallel()
+
+	src := testSheet()
+
+	encoders := map[string]func(w io.Writer, img image.Image) error{
+		"png":  png.Encode,
+		"jpeg": func(w io.Writer, img image.Image) error { return jpeg.Encode(w, img, nil) },
+		"gif":  func(w io.Writer, img image.Image) error { return gif.Encode(w, img, nil) },
+		"bmp":  bmp.Encode,
+		"tiff": func(w io.Writer, img image.Image) error { return tiff.Encode(w, img, nil) },
+	}
+
+	for format, encode := range encoders {
+		t.Run(format, func(t *testing.T) {
+			t.Parallel()
+
+			buf := &bytes.Buffer{}
+			require.NoError(t, encode(buf, src))
+
+			detected, err := DetectFormat(bytes.NewReader(buf.Bytes()))
+			require.NoError(t, err)
+			assert.Equal(t, format, detected)
+
+			path := filepath.Join(t.TempDir(), "upload")
+			require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o644))
+
+			img, err := LoadImage(path)
+			require.NoError(t, err)
+			assert.Equal(t, src.Bounds(), img.Bounds())
+		})
+	}
+}
+
+// the samples are testdata of github.com/gen2brain/heic and golang.org/x/image
+func TestLoadImageSamples(t *testing.T) {
+	t.Parallel()
+
+	heicSample, err := os.ReadFile(filepath.Join("testdata", "sample.heic"))
+	require.NoError(t, err)
+	webpSample, err := os.ReadFile(filepath.Join("testdata", "sample.webp"))
+	require.NoError(t, err)
+
+	// the brand of 10 bit iPhone photos
+	heixSample := bytes.Clone(heicSample)
+	copy(heixSample[8:12], "heix")
+
+	samples := map[string][]byte{
+		"heic": heicSample,
+		"heix": heixSample,
+		"webp": webpSample,
+	}
+	formats := map[string]string{"heic": "heic", "heix": "heic", "webp": "webp"}
+
+	for name, sample := range samples {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			detected, err := DetectFormat(bytes.NewReader(sample))
+			require.NoError(t, err)
+			assert.Equal(t, formats[name], detected)
+
+			path := filepath.Join(t.TempDir(), "upload")
+			require.NoError(t, os.WriteFile(path, sample, 0o644))
+
+			img, err := LoadImage(path)
+			require.NoError(t, err)
+			assert.False(t, img.Bounds().Empty())
+		})
+	}
+}
+
+func TestLoadImageUnsupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := DetectFormat(bytes.NewReader([]byte("%PDF-1.4")))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	// AVIF shares the general HEIF brands but is no HEIC
+	avif := []byte("\x00\x00\x00\x1cftypmif1\x00\x00\x00\x00mif1avifmiaf\x00\x00\x00\x08meta")
+	_, err = DetectFormat(bytes.NewReader(avif))
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+
+	path := filepath.Join(t.TempDir(), "upload")
+	require.NoError(t, os.WriteFile(path, []byte("%PDF-1.4"), 0o644))
+	_, err = LoadImage(path)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
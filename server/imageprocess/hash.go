@@ -0,0 +1,136 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"math/bits"
+
+	"github.com/superbarne/fish/models"
+)
+
+// DuplicateDistance is the maximum number of differing hash bits for two drawings to count as the same
+const DuplicateDistance = 10
+
+// DHash computes a difference hash of the drawn part of fish. Similar drawings have
+// hashes with few differing bits, independent of size and position on the sheet.
+func DHash(fish image.Image) uint64 {
+	box := image.Rectangle{}
+	bounds := fish.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := fish.At(x, y).RGBA(); a > 0 {
+				box = box.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if box.Empty() {
+		return 0
+	}
+
+	// 9x8 cells give 8 differences per row
+	var cells [8][9]float64
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 9; col++ {
+			cell := image.Rect(
+				box.Min.X+col*box.Dx()/9, box.Min.Y+row*box.Dy()/8,
+				box.Min.X+(col+1)*box.Dx()/9, box.Min.Y+(row+1)*box.Dy()/8,
+			)
+			cells[row][col] = cellLuminance(fish, cell)
+		}
+	}
+
+	var hash uint64
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			hash <<= 1
+			if cells[row][col] < cells[row][col+1] {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+// HashDistance counts the differing bits of two hashes
+func HashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// FindDuplicate returns the fish with the most similar hash, nil if none is close enough
+func FindDuplicate(hash uint64, fishes []*models.Fish) *models.Fish {
+	var duplicate *models.Fish
+	best := DuplicateDistance + 1
+	for _, fish := range fishes {
+		if fish.Hash == nil {
+			continue
+		}
+		if distance := HashDistance(hash, *fish.Hash); distance < best {
+			duplicate = fish
+			best = distance
+		}
+	}
+	return duplicate
+}
+
+// DuplicateGroups groups fishes with similar hashes. Only groups with more than one fish are returned.
+func DuplicateGroups(fishes []*models.Fish) [][]*models.Fish {
+	// union find over all similar pairs
+	parent := make([]int, len(fishes))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range fishes {
+		for j := i + 1; j < len(fishes); j++ {
+			if fishes[i].Hash == nil || fishes[j].Hash == nil {
+				continue
+			}
+			if HashDistance(*fishes[i].Hash, *fishes[j].Hash) <= DuplicateDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	members := map[int][]*models.Fish{}
+	order := []int{}
+	for i, fish := range fishes {
+		root := find(i)
+		if _, ok := members[root]; !ok {
+			order = append(order, root)
+		}
+		members[root] = append(members[root], fish)
+	}
+
+	groups := [][]*models.Fish{}
+	for _, root := range order {
+		if len(members[root]) > 1 {
+			groups = append(groups, members[root])
+		}
+	}
+	return groups
+}
+
+// cellLuminance is the average brightness of rect with transparent pixels as paper
+func cellLuminance(img image.Image, rect image.Rectangle) float64 {
+	if rect.Empty() {
+		rect = image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+1, rect.Min.Y+1)
+	}
+
+	sum := 0.0
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			alpha := float64(c.A) / 0xff
+			sum += alpha*luminance(color.NRGBA{R: c.R, G: c.G, B: c.B, A: 0xff}) + (1 - alpha)
+		}
+	}
+	return sum / float64(rect.Dx()*rect.Dy())
+}
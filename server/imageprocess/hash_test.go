@@ -0,0 +1,69 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/superbarne/fish/models"
+)
+
+// stripes draws a striped rectangle at rect, horizontal or vertical
+func stripes(size image.Point, rect image.Rectangle, vertical bool) image.Image {
+	img := image.NewRGBA(image.Rectangle{Max: size})
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			pos := (y - rect.Min.Y) * 8 / rect.Dy()
+			if vertical {
+				pos = (x - rect.Min.X) * 8 / rect.Dx()
+			}
+			if pos%2 == 0 {
+				img.Set(x, y, color.Black)
+			} else {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			}
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	t.Parallel()
+
+	hash := DHash(stripes(image.Pt(100, 100), image.Rect(10, 10, 90, 50), false))
+
+	// the same drawing bigger and somewhere else on the sheet
+	moved := stripes(image.Pt(300, 200), image.Rect(100, 80, 260, 160), false)
+	assert.LessOrEqual(t, HashDistance(hash, DHash(moved)), DuplicateDistance)
+
+	// a different drawing
+	other := stripes(image.Pt(100, 100), image.Rect(10, 10, 90, 50), true)
+	assert.Greater(t, HashDistance(hash, DHash(other)), DuplicateDistance)
+
+	assert.Zero(t, DHash(image.NewRGBA(image.Rect(0, 0, 10, 10))))
+}
+
+func TestDuplicateGroups(t *testing.T) {
+	t.Parallel()
+
+	hash := func(hash uint64) *uint64 { return &hash }
+
+	a := &models.Fish{ID: uuid.New(), Hash: hash(0xff00ff00ff00ff00)}
+	b := &models.Fish{ID: uuid.New(), Hash: hash(0xff00ff00ff00ff01)}
+	c := &models.Fish{ID: uuid.New(), Hash: hash(0x00ff00ff00ff00ff)}
+	d := &models.Fish{ID: uuid.New()}
+
+	groups := DuplicateGroups([]*models.Fish{a, c, d, b})
+	assert.Equal(t, [][]*models.Fish{{a, b}}, groups)
+	assert.Equal(t, b, FindDuplicate(*a.Hash, []*models.Fish{c, d, b}))
+	assert.Nil(t, FindDuplicate(*a.Hash, []*models.Fish{c, d}))
+
+	// blank drawings hash to zero and are duplicates of each other, fishes without hash are not
+	blank := &models.Fish{ID: uuid.New(), Hash: hash(0)}
+	empty := &models.Fish{ID: uuid.New(), Hash: hash(0)}
+	assert.Equal(t, [][]*models.Fish{{blank, empty}}, DuplicateGroups([]*models.Fish{blank, d, empty}))
+	assert.Equal(t, blank, FindDuplicate(0, []*models.Fish{d, blank}))
+	assert.Nil(t, FindDuplicate(0, []*models.Fish{d}))
+}
@@ -1,23 +1,167 @@
 package imageprocess
 
 import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/fogleman/gg"
 )
 
+// Options configure how fishes are extracted from an uploaded drawing
+type Options struct {
+	// Split turns every separate drawing on the sheet into its own fish
+	Split bool
+	// MinComponentSize is the minimum amount of pixels a drawing needs in split mode.
+	// Zero picks a size relative to the image.
+	MinComponentSize int
+	// Threshold is the brightness between 0 and 1 above which a pixel counts as paper. Zero uses the default.
+	Threshold float64
+	// Seeds are the points where the background removal starts. None starts in the top left corner.
+	Seeds []image.Point
+	// Crop limits the processing to a part of the image. Empty uses the whole image.
+	Crop image.Rectangle
+}
+
+// DefaultThreshold is the brightness above which a pixel counts as paper
+const DefaultThreshold = 150000.0 / (3 * 0xffff)
+
 // ProcessImage remove white background from image. TargetPath need a .png extension!
 func ProcessImage(srcPath string, targetPath string, log *slog.Logger) error {
-	src, err := gg.LoadImage(srcPath)
+	fishes, err := ProcessImageFishes(srcPath, Options{}, log)
+	if err != nil {
+		return err
+	}
+
+	return SaveImage(fishes[0], targetPath, log)
+}
+
+// ProcessImageFishes remove white background from image and returns the extracted fishes.
+// Without split mode the result always contains exactly one image.
+func ProcessImageFishes(srcPath string, opts Options, log *slog.Logger) ([]image.Image, error) {
+	src, err := LoadImage(srcPath)
 	if err != nil {
 		log.Error("Failed to load image", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	// photos of a template only use the drawing area
+	if template, err := DetectTemplate(src); err == nil {
+		src = template.Drawing
+	}
+
+	return ExtractFishes(src, opts), nil
+}
+
+// ExtractFishes remove white background from src.
+// In split mode every connected drawing above the minimum size is cropped into its own image.
+func ExtractFishes(src image.Image, opts Options) []image.Image {
+	fishes, _ := ExtractFishesWithSources(src, opts)
+	return fishes
+}
+
+// ExtractFishesWithSources is ExtractFishes, but also returns the unmasked part of src
+// every fish was cut from. Sources have the same size as their fish.
+func ExtractFishesWithSources(src image.Image, opts Options) ([]image.Image, []image.Image) {
+	if !opts.Crop.Empty() {
+		src = crop(src, opts.Crop)
+	}
+
+	threshold := opts.Threshold
+	if threshold <= 0 {
+		threshold = DefaultThreshold
+	}
+
+	seeds := opts.Seeds
+	if len(seeds) == 0 {
+		seeds = []image.Point{{1, 1}}
+	}
+
+	background := backgroundMask(src, threshold, seeds)
+
+	if !opts.Split {
+		return []image.Image{drawFish(src, background, nil)}, []image.Image{src}
+	}
+
+	minSize := opts.MinComponentSize
+	if minSize <= 0 {
+		minSize = defaultMinComponentSize(src.Bounds())
+	}
+
+	components := findComponents(background, minSize)
+	if len(components) == 0 {
+		// nothing big enough found, fall back to the whole drawing
+		return []image.Image{drawFish(src, background, nil)}, []image.Image{src}
+	}
+
+	fishes := make([]image.Image, 0, len(components))
+	sources := make([]image.Image, 0, len(components))
+	for _, component := range components {
+		fishes = append(fishes, drawFish(src, background, component))
+		sources = append(sources, crop(src, component.bounds))
+	}
+
+	return fishes, sources
+}
+
+// SaveImage writes img as png to targetPath and creates missing folders. The png is written to a
+// temp file first, readers never see a half written image.
+func SaveImage(img image.Image, targetPath string, log *slog.Logger) error {
+	filePath := filepath.Dir(targetPath)
+	if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
+		log.Error("Failed to create folder", slog.String("error", err.Error()))
 		return err
 	}
 
-	w := src.Bounds().Size().X
-	h := src.Bounds().Size().Y
+	if err := writePNG(img, targetPath); err != nil {
+		log.Error("Failed to save image", slog.String("error", err.Error()))
+		return err
+	}
+
+	return nil
+}
+
+func writePNG(img image.Image, targetPath string) error {
+	file, err := os.CreateTemp(filepath.Dir(targetPath), strings.TrimSuffix(filepath.Base(targetPath), filepath.Ext(targetPath))+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), targetPath)
+}
+
+// crop copies the part of src inside rect, relative to the bounds of src
+func crop(src image.Image, rect image.Rectangle) image.Image {
+	bounds := src.Bounds()
+	rect = rect.Add(bounds.Min).Intersect(bounds)
+	if rect.Empty() {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, rect.Min, draw.Src)
+	return dst
+}
+
+// backgroundMask marks all white pixels connected to one of the seeds as background
+func backgroundMask(src image.Image, threshold float64, seeds []image.Point) [][]bool {
+	bounds := src.Bounds()
+	w := bounds.Size().X
+	h := bounds.Size().Y
 
 	// create map
 	heightMap := make([][]bool, h)
@@ -25,52 +169,76 @@ func ProcessImage(srcPath string, targetPath string, log *slog.Logger) error {
 		heightMap[y] = make([]bool, w)
 
 		for x := 0; x < w; x++ {
-			c := src.At(x, y)
-			heightMap[y][x] = isWhite(c.RGBA())
+			c := src.At(bounds.Min.X+x, bounds.Min.Y+y)
+			heightMap[y][x] = isWhite(c, threshold)
 		}
 	}
 
-	pixels := findConnectedPixels(heightMap, 1, 1)
-
-	im := gg.NewContext(w, h)
+	background := make([][]bool, h)
+	for _, seed := range seeds {
+		if seed.X < 0 || seed.Y < 0 || seed.X >= w || seed.Y >= h {
+			continue
+		}
 
-	// draw all non-white pixel
-	for y := 0; y < h; y++ {
-		for x := 0; x < w; x++ {
-			if pixels[y][x] {
+		pixels := findConnectedPixels(heightMap, seed.Y, seed.X)
+		for y := range pixels {
+			if background[y] == nil {
+				background[y] = pixels[y]
 				continue
 			}
+			for x := range pixels[y] {
+				background[y][x] = background[y][x] || pixels[y][x]
+			}
+		}
+	}
 
-			c := src.At(x, y)
-
-			im.SetColor(c)
-			im.SetPixel(x, y)
+	for y := range background {
+		if background[y] == nil {
+			background[y] = make([]bool, w)
 		}
 	}
 
-	// save image
-	filePath := filepath.Dir(targetPath)
-	if err := os.MkdirAll(filePath, os.ModePerm); err != nil {
-		log.Error("Failed to create folder", slog.String("error", err.Error()))
-		return err
+	return background
+}
+
+// drawFish copies all non background pixels of src. If component is set,
+// only its pixels are drawn and the result is cropped to its bounds.
+func drawFish(src image.Image, background [][]bool, c *component) image.Image {
+	bounds := src.Bounds()
+	rect := image.Rect(0, 0, bounds.Dx(), bounds.Dy())
+	if c != nil {
+		rect = c.bounds
 	}
 
-	err = gg.SavePNG(targetPath, im.Image())
-	if err != nil {
-		log.Error("Failed to save image", slog.String("error", err.Error()))
-		return err
+	im := gg.NewContext(rect.Dx(), rect.Dy())
+
+	// draw all non-white pixel
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if background[y][x] {
+				continue
+			}
+
+			if c != nil && c.labels[y][x] != c.label {
+				continue
+			}
+
+			im.SetColor(src.At(bounds.Min.X+x, bounds.Min.Y+y))
+			im.SetPixel(x-rect.Min.X, y-rect.Min.Y)
+		}
 	}
 
-	return nil
+	return im.Image()
 }
 
-func isWhite(r, g, b, a uint32) bool {
+func isWhite(c color.Color, threshold float64) bool {
+	r, g, b, a := c.RGBA()
 	if a == 0 {
 		return true
 	}
 
-	whiteness := r + g + b
-	return whiteness > 150000
+	whiteness := float64(r+g+b) / (3 * 0xffff)
+	return whiteness > threshold
 }
 
 // dfs performing the depth search
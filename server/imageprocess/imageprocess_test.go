@@ -0,0 +1,99 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testSheet() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	// two fishes and a speck of dirt
+	draw.Draw(img, image.Rect(10, 10, 60, 40), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(120, 50, 190, 90), image.NewUniform(color.RGBA{R: 255, A: 255}), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(100, 10, 102, 12), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	return img
+}
+
+func TestExtractFishesSingle(t *testing.T) {
+	t.Parallel()
+
+	fishes := ExtractFishes(testSheet(), Options{})
+	assert.Len(t, fishes, 1)
+	assert.Equal(t, image.Rect(0, 0, 200, 100), fishes[0].Bounds())
+
+	// background removed, drawing kept
+	_, _, _, a := fishes[0].At(0, 0).RGBA()
+	assert.Zero(t, a)
+	_, _, _, a = fishes[0].At(20, 20).RGBA()
+	assert.NotZero(t, a)
+}
+
+func TestExtractFishesSplit(t *testing.T) {
+	t.Parallel()
+
+	fishes := ExtractFishes(testSheet(), Options{Split: true, MinComponentSize: 100})
+	assert.Len(t, fishes, 2)
+	assert.Equal(t, image.Rect(0, 0, 50, 30), fishes[0].Bounds())
+	assert.Equal(t, image.Rect(0, 0, 70, 40), fishes[1].Bounds())
+
+	r, _, _, a := fishes[1].At(10, 10).RGBA()
+	assert.NotZero(t, a)
+	assert.NotZero(t, r)
+}
+
+func TestExtractFishesSplitNothingFound(t *testing.T) {
+	t.Parallel()
+
+	fishes := ExtractFishes(testSheet(), Options{Split: true, MinComponentSize: 100000})
+	assert.Len(t, fishes, 1)
+}
+
+func TestExtractFishesOptions(t *testing.T) {
+	t.Parallel()
+
+	img := testSheet()
+	// light gray smudge, paper with the default threshold
+	draw.Draw(img, image.Rect(10, 60, 40, 90), image.NewUniform(color.Gray{Y: 0xd0}), image.Point{}, draw.Src)
+
+	fishes := ExtractFishes(img, Options{})
+	_, _, _, a := fishes[0].At(20, 70).RGBA()
+	assert.Zero(t, a)
+
+	// stricter threshold keeps the smudge
+	fishes = ExtractFishes(img, Options{Threshold: 0.9})
+	_, _, _, a = fishes[0].At(20, 70).RGBA()
+	assert.NotZero(t, a)
+
+	// crop to the red fish
+	fishes = ExtractFishes(img, Options{Crop: image.Rect(110, 40, 200, 100)})
+	assert.Equal(t, image.Rect(0, 0, 90, 60), fishes[0].Bounds())
+	_, _, _, a = fishes[0].At(30, 30).RGBA()
+	assert.NotZero(t, a)
+
+	// a seed inside a closed outline removes its inside too
+	outline := image.NewRGBA(image.Rect(0, 0, 100, 100))
+	draw.Draw(outline, outline.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i := 20; i < 80; i++ {
+		outline.Set(i, 20, color.Black)
+		outline.Set(i, 79, color.Black)
+		outline.Set(20, i, color.Black)
+		outline.Set(79, i, color.Black)
+	}
+
+	fishes = ExtractFishes(outline, Options{})
+	_, _, _, a = fishes[0].At(50, 50).RGBA()
+	assert.NotZero(t, a)
+
+	fishes = ExtractFishes(outline, Options{Seeds: []image.Point{{1, 1}, {50, 50}}})
+	_, _, _, a = fishes[0].At(50, 50).RGBA()
+	assert.Zero(t, a)
+	_, _, _, a = fishes[0].At(20, 50).RGBA()
+	assert.NotZero(t, a)
+}
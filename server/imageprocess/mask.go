@@ -0,0 +1,72 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/fogleman/gg"
+	"github.com/superbarne/fish/models"
+)
+
+// ApplyStrokes corrects the automatic mask of fish with strokes painted by a moderator.
+// Keep strokes restore the pixels of source, remove strokes make the pixels transparent.
+// Strokes are applied in order, so later strokes win.
+func ApplyStrokes(fish image.Image, source image.Image, strokes []models.MaskStroke) image.Image {
+	bounds := fish.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), fish, bounds.Min, draw.Src)
+
+	sourceBounds := source.Bounds()
+
+	// rasterize all strokes into one mask, white where pixels are kept and black where they are removed.
+	// The colors are opaque, so later strokes paint over earlier ones.
+	dc := gg.NewContext(bounds.Dx(), bounds.Dy())
+	dc.SetLineCapRound()
+	dc.SetLineJoinRound()
+	for _, stroke := range strokes {
+		if len(stroke.Points) == 0 {
+			continue
+		}
+
+		switch stroke.Mode {
+		case models.MaskStrokeKeep:
+			dc.SetColor(color.White)
+		case models.MaskStrokeRemove:
+			dc.SetColor(color.Black)
+		default:
+			continue
+		}
+
+		dc.SetLineWidth(max(stroke.Width, 1))
+		if len(stroke.Points) == 1 {
+			p := stroke.Points[0]
+			dc.DrawCircle(float64(p.X), float64(p.Y), max(stroke.Width, 1)/2)
+			dc.Fill()
+		} else {
+			for _, p := range stroke.Points {
+				dc.LineTo(float64(p.X), float64(p.Y))
+			}
+			dc.Stroke()
+		}
+	}
+	mask := dc.Image().(*image.RGBA)
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			// the mask is premultiplied, a pixel is covered by more than half and kept if it is more white than black
+			c := mask.RGBAAt(x, y)
+			if c.A < 0x80 {
+				continue
+			}
+
+			if 2*uint16(c.R) >= uint16(c.A) {
+				dst.Set(x, y, source.At(sourceBounds.Min.X+x, sourceBounds.Min.Y+y))
+			} else {
+				dst.Set(x, y, color.Transparent)
+			}
+		}
+	}
+
+	return dst
+}
@@ -0,0 +1,41 @@
+package imageprocess
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superbarne/fish/models"
+)
+
+func TestApplyStrokes(t *testing.T) {
+	t.Parallel()
+
+	fishes, sources := ExtractFishesWithSources(testSheet(), Options{})
+
+	fish := ApplyStrokes(fishes[0], sources[0], []models.MaskStroke{
+		// remove part of the black fish
+		{Mode: models.MaskStrokeRemove, Width: 10, Points: []image.Point{{20, 20}, {40, 20}}},
+		// keep some paper
+		{Mode: models.MaskStrokeKeep, Width: 4, Points: []image.Point{{100, 50}}},
+	})
+
+	_, _, _, a := fish.At(30, 20).RGBA()
+	assert.Zero(t, a)
+	_, _, _, a = fish.At(30, 35).RGBA()
+	assert.NotZero(t, a)
+
+	r, _, _, a := fish.At(100, 50).RGBA()
+	assert.NotZero(t, a)
+	assert.Equal(t, uint32(0xffff), r)
+
+	// later strokes win
+	fish = ApplyStrokes(fishes[0], sources[0], []models.MaskStroke{
+		{Mode: models.MaskStrokeRemove, Width: 10, Points: []image.Point{{20, 20}, {40, 20}}},
+		{Mode: models.MaskStrokeKeep, Width: 4, Points: []image.Point{{30, 20}}},
+	})
+	_, _, _, a = fish.At(30, 20).RGBA()
+	assert.NotZero(t, a)
+	_, _, _, a = fish.At(22, 20).RGBA()
+	assert.Zero(t, a)
+}
@@ -0,0 +1,138 @@
+package imageprocess
+
+import (
+	"image"
+	"math"
+
+	"github.com/fogleman/contourmap"
+	"github.com/superbarne/fish/models"
+)
+
+// outlineTolerance is the maximum distance of the simplified outline to the traced one,
+// relative to the diagonal of the fish
+const outlineTolerance = 0.005
+
+// TraceOutline follows the border of the visible pixels of fish and simplifies it
+// into a polygon. Only the largest shape is traced. Returns nil for empty images.
+func TraceOutline(fish image.Image) *models.Outline {
+	bounds := fish.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return nil
+	}
+
+	grid := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if _, _, _, a := fish.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA(); a > 0 {
+				grid[y*w+x] = 1
+			}
+		}
+	}
+
+	// closed adds a border around the grid, so shapes touching the edge are closed too
+	contours := contourmap.FromFloat64s(w, h, grid).Closed().Contours(0.5)
+
+	var largest contourmap.Contour
+	largestArea := 0.0
+	for _, contour := range contours {
+		if area := contourArea(contour); area > largestArea {
+			largest = contour
+			largestArea = area
+		}
+	}
+	if largest == nil {
+		return nil
+	}
+
+	tolerance := math.Max(1, outlineTolerance*math.Hypot(float64(w), float64(h)))
+	simplified := simplify(largest[:len(largest)-1], tolerance)
+
+	outline := &models.Outline{
+		Width:  w,
+		Height: h,
+		Points: make([][2]float64, 0, len(simplified)),
+	}
+	for _, p := range simplified {
+		// contour points are on pixel centers of the bordered grid
+		outline.Points = append(outline.Points, [2]float64{
+			round(p.X - 0.5),
+			round(p.Y - 0.5),
+		})
+	}
+
+	return outline
+}
+
+// contourArea is the area enclosed by a closed contour
+func contourArea(c contourmap.Contour) float64 {
+	area := 0.0
+	for i := 0; i < len(c)-1; i++ {
+		area += c[i].X*c[i+1].Y - c[i+1].X*c[i].Y
+	}
+	return math.Abs(area) / 2
+}
+
+// simplify reduces a closed polygon with the Ramer-Douglas-Peucker algorithm
+func simplify(points []contourmap.Point, tolerance float64) []contourmap.Point {
+	if len(points) < 4 {
+		return points
+	}
+
+	// split the ring at the point farthest from the start, so both halves are open lines
+	far := 0
+	farDist := 0.0
+	for i, p := range points {
+		if d := math.Hypot(p.X-points[0].X, p.Y-points[0].Y); d > farDist {
+			far = i
+			farDist = d
+		}
+	}
+
+	ring := append(append([]contourmap.Point{}, points...), points[0])
+	first := simplifyLine(ring[:far+1], tolerance)
+	second := simplifyLine(ring[far:], tolerance)
+
+	// drop the duplicated split points
+	return append(first[:len(first)-1], second[:len(second)-1]...)
+}
+
+func simplifyLine(points []contourmap.Point, tolerance float64) []contourmap.Point {
+	if len(points) < 3 {
+		return points
+	}
+
+	start, end := points[0], points[len(points)-1]
+	index := 0
+	maxDist := 0.0
+	for i := 1; i < len(points)-1; i++ {
+		if d := segmentDistance(points[i], start, end); d > maxDist {
+			index = i
+			maxDist = d
+		}
+	}
+
+	if maxDist <= tolerance {
+		return []contourmap.Point{start, end}
+	}
+
+	left := simplifyLine(points[:index+1], tolerance)
+	right := simplifyLine(points[index:], tolerance)
+	return append(left[:len(left)-1], right...)
+}
+
+// segmentDistance is the distance of p to the line segment from a to b
+func segmentDistance(p, a, b contourmap.Point) float64 {
+	dx, dy := b.X-a.X, b.Y-a.Y
+	length := dx*dx + dy*dy
+	if length == 0 {
+		return math.Hypot(p.X-a.X, p.Y-a.Y)
+	}
+
+	t := math.Max(0, math.Min(1, ((p.X-a.X)*dx+(p.Y-a.Y)*dy)/length))
+	return math.Hypot(p.X-a.X-t*dx, p.Y-a.Y-t*dy)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10) / 10
+}
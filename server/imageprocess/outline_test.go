@@ -0,0 +1,42 @@
+package imageprocess
+
+import (
+	"image"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceOutline(t *testing.T) {
+	t.Parallel()
+
+	fishes := ExtractFishes(testSheet(), Options{Split: true, MinComponentSize: 100})
+	require.Len(t, fishes, 2)
+
+	outline := TraceOutline(fishes[0])
+	require.NotNil(t, outline)
+	assert.Equal(t, 50, outline.Width)
+	assert.Equal(t, 30, outline.Height)
+
+	// the rectangle simplifies to its corners
+	assert.LessOrEqual(t, len(outline.Points), 8)
+
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range outline.Points {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	assert.InDelta(t, 0, minX, 1)
+	assert.InDelta(t, 0, minY, 1)
+	assert.InDelta(t, 50, maxX, 1)
+	assert.InDelta(t, 30, maxY, 1)
+}
+
+func TestTraceOutlineEmpty(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, TraceOutline(image.NewRGBA(image.Rect(0, 0, 20, 20))))
+}
@@ -0,0 +1,29 @@
+package imageprocess
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// Resize scales img down so its longest edge is at most maxEdge. Smaller images and
+// a maxEdge of zero return img unchanged.
+func Resize(img image.Image, maxEdge int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if maxEdge <= 0 || (w <= maxEdge && h <= maxEdge) {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxEdge/w)
+		w = maxEdge
+	} else {
+		w = max(1, w*maxEdge/h)
+		h = maxEdge
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
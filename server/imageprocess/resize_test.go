@@ -0,0 +1,21 @@
+package imageprocess
+
+import (
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResize(t *testing.T) {
+	t.Parallel()
+
+	src := testSheet()
+
+	assert.Equal(t, image.Rect(0, 0, 50, 25), Resize(src, 50).Bounds())
+	assert.Equal(t, image.Rect(0, 0, 20, 40), Resize(image.NewRGBA(image.Rect(0, 0, 100, 200)), 40).Bounds())
+
+	// never scaled up
+	assert.Same(t, src, Resize(src, 500))
+	assert.Same(t, src, Resize(src, 0))
+}
@@ -0,0 +1,257 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/fogleman/gg"
+	"github.com/superbarne/fish/models"
+)
+
+// Sizes of the rendered aquarium
+const (
+	SnapshotWidth   = 1920
+	SnapshotHeight  = 1080
+	AnimationWidth  = 640
+	AnimationHeight = 360
+	AnimationFrames = 36
+	// AnimationDelay between two frames in 100ths of a second
+	AnimationDelay = 8
+
+	// floorHeight is the part of the height covered by the floor
+	floorHeight = 0.12
+	// layoutCandidates is the number of random positions tried per fish, the one farthest from the others wins
+	layoutCandidates = 12
+)
+
+// colors of the frontend backdrop and floor
+var (
+	backdropTop    = color.RGBA{0x00, 0x07, 0x8a, 0xff}
+	backdropBottom = color.RGBA{0x0a, 0x81, 0x85, 0xff}
+	floorColor     = color.RGBA{0x00, 0x00, 0x30, 0xff}
+)
+
+// SceneFish is a fish to show in a scene
+type SceneFish struct {
+	Image  image.Image
+	Facing models.Facing
+	// Area is the number of drawn pixels, bigger drawings are shown bigger
+	Area int
+}
+
+// Scene is a seeded layout of fishes in the aquarium. The same fishes in the same order and seed
+// render the same pictures.
+type Scene struct {
+	fishes []placedFish
+}
+
+type placedFish struct {
+	image image.Image
+	// mirror the image, so the head leads in the direction it swims
+	mirror bool
+	// x and y of the center at the start of the loop, 0..1 of the canvas
+	x, y float64
+	// size is the longest edge relative to the canvas height
+	size float64
+	// laps are the crossings of the canvas per loop, negative to the left
+	laps int
+	// bobs are the ups and downs per loop
+	bobs  int
+	phase float64
+}
+
+func NewScene(fishes []SceneFish, seed uint64) *Scene {
+	rng := rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15))
+
+	scene := &Scene{}
+	for _, fish := range fishes {
+		laps := 1 + rng.IntN(2)
+		if rng.IntN(2) == 0 {
+			laps = -laps
+		}
+
+		placed := placedFish{
+			image:  fish.Image,
+			mirror: (fish.Facing == models.FacingLeft) != (laps < 0),
+			size:   0.14 + 0.1*min(float64(fish.Area)/200000, 1),
+			laps:   laps,
+			bobs:   1 + rng.IntN(2),
+			phase:  rng.Float64(),
+		}
+		placed.x, placed.y = scene.position(rng)
+		scene.fishes = append(scene.fishes, placed)
+	}
+
+	// big fishes swim in the back
+	slices.SortStableFunc(scene.fishes, func(a, b placedFish) int {
+		switch {
+		case a.size > b.size:
+			return -1
+		case a.size < b.size:
+			return 1
+		}
+		return 0
+	})
+
+	return scene
+}
+
+// position picks the candidate farthest from the fishes placed so far
+func (s *Scene) position(rng *rand.Rand) (float64, float64) {
+	var bestX, bestY, best float64
+	for i := range layoutCandidates {
+		x := 0.05 + 0.9*rng.Float64()
+		y := 0.1 + (0.85-floorHeight-0.1)*rng.Float64()
+
+		dist := math.Inf(1)
+		for _, other := range s.fishes {
+			dist = min(dist, math.Hypot(x-other.x, y-other.y))
+		}
+		if i == 0 || dist > best {
+			bestX, bestY, best = x, y, dist
+		}
+	}
+	return bestX, bestY
+}
+
+// Snapshot renders the scene at the start of the loop
+func (s *Scene) Snapshot(width, height int) image.Image {
+	dc := gg.NewContext(width, height)
+	s.draw(dc, background(width, height), s.scaled(height), 0)
+	return dc.Image()
+}
+
+// Animation renders a loop in which every fish crosses the aquarium once or twice
+func (s *Scene) Animation(width, height int) *gif.GIF {
+	bg := background(width, height)
+	images := s.scaled(height)
+
+	anim := &gif.GIF{}
+	dc := gg.NewContext(width, height)
+	for i := range AnimationFrames {
+		s.draw(dc, bg, images, float64(i)/AnimationFrames)
+
+		anim.Image = append(anim.Image, dither(dc.Image().(*image.RGBA)))
+		anim.Delay = append(anim.Delay, AnimationDelay)
+	}
+	return anim
+}
+
+// draw renders the scene at t (0..1) of the loop
+func (s *Scene) draw(dc *gg.Context, bg image.Image, images []image.Image, t float64) {
+	width, height := dc.Width(), dc.Height()
+	dc.DrawImage(bg, 0, 0)
+
+	for i, fish := range s.fishes {
+		img := images[i]
+		w := img.Bounds().Dx()
+
+		// the fish leaves the canvas completely before it comes back on the other side
+		track := float64(width + w)
+		left := math.Mod(fish.x*track+float64(fish.laps)*t*track, track)
+		if left < 0 {
+			left += track
+		}
+		x := math.Round(left - float64(w)/2)
+		y := math.Round(fish.y*float64(height) + 0.02*float64(height)*math.Sin(2*math.Pi*(float64(fish.bobs)*t+fish.phase)))
+
+		dc.Push()
+		dc.Translate(x, y)
+		if fish.mirror {
+			dc.Scale(-1, 1)
+		}
+		dc.DrawImageAnchored(img, 0, 0, 0.5, 0.5)
+		dc.Pop()
+	}
+}
+
+// scaled returns the images of the fishes in their size on a canvas of the given height
+func (s *Scene) scaled(height int) []image.Image {
+	images := make([]image.Image, len(s.fishes))
+	for i, fish := range s.fishes {
+		images[i] = Resize(fish.image, max(1, int(fish.size*float64(height))))
+	}
+	return images
+}
+
+// background is the gradient of the frontend backdrop with the floor at the bottom
+func background(width, height int) image.Image {
+	dc := gg.NewContext(width, height)
+	floor := float64(height) * (1 - floorHeight)
+
+	gradient := gg.NewLinearGradient(0, 0, 0, floor)
+	gradient.AddColorStop(0, backdropTop)
+	gradient.AddColorStop(1, backdropBottom)
+	dc.SetFillStyle(gradient)
+	dc.DrawRectangle(0, 0, float64(width), floor)
+	dc.Fill()
+
+	dc.SetColor(floorColor)
+	dc.DrawRectangle(0, floor, float64(width), float64(height)-floor)
+	dc.Fill()
+
+	return dc.Image()
+}
+
+// levels of red, green and blue of the animation palette, 6 * 7 * 6 = 252 colors
+const (
+	levelsR = 6
+	levelsG = 7
+	levelsB = 6
+)
+
+// ditherPalette is a color cube, the index of a color is computed instead of searched
+var ditherPalette = func() color.Palette {
+	p := make(color.Palette, 0, levelsR*levelsG*levelsB)
+	for r := range levelsR {
+		for g := range levelsG {
+			for b := range levelsB {
+				p = append(p, color.RGBA{
+					R: uint8(r * 255 / (levelsR - 1)),
+					G: uint8(g * 255 / (levelsG - 1)),
+					B: uint8(b * 255 / (levelsB - 1)),
+					A: 0xff,
+				})
+			}
+		}
+	}
+	return p
+}()
+
+// dither reduces an opaque image to the palette with Floyd-Steinberg error diffusion.
+// draw.FloydSteinberg searches the whole palette for every pixel and is too slow for many frames.
+func dither(src *image.RGBA) *image.Paletted {
+	bounds := src.Bounds()
+	width := bounds.Dx()
+	dst := image.NewPaletted(bounds, ditherPalette)
+
+	// errors of the current and the next row, one pixel of padding on both sides
+	current := make([][3]float64, width+2)
+	next := make([][3]float64, width+2)
+	levels := [3]float64{levelsR - 1, levelsG - 1, levelsB - 1}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := 0; x < width; x++ {
+			offset := src.PixOffset(bounds.Min.X+x, y)
+			var index [3]int
+			for c := range 3 {
+				v := min(max(float64(src.Pix[offset+c])+current[x+1][c], 0), 255)
+				index[c] = int(math.Round(v * levels[c] / 255))
+				diff := v - float64(index[c])*255/levels[c]
+
+				current[x+2][c] += diff * 7 / 16
+				next[x][c] += diff * 3 / 16
+				next[x+1][c] += diff * 5 / 16
+				next[x+2][c] += diff * 1 / 16
+			}
+			dst.Pix[dst.PixOffset(bounds.Min.X+x, y)] = uint8((index[0]*levelsG+index[1])*levelsB + index[2])
+		}
+		current, next = next, current
+		clear(next)
+	}
+	return dst
+}
@@ -0,0 +1,61 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fogleman/gg"
+	"github.com/stretchr/testify/assert"
+	"github.com/superbarne/fish/models"
+)
+
+func testSceneFishes() []SceneFish {
+	fishes := []SceneFish{}
+	for i, c := range []color.Color{color.RGBA{0xe0, 0x20, 0x20, 0xff}, color.RGBA{0x20, 0xc0, 0x40, 0xff}, color.RGBA{0xff, 0xff, 0, 0xff}} {
+		dc := gg.NewContext(200, 100)
+		dc.SetColor(c)
+		dc.DrawEllipse(90, 50, 80, 40)
+		dc.Fill()
+		dc.DrawRegularPolygon(3, 180, 50, 20, 0)
+		dc.Fill()
+		fishes = append(fishes, SceneFish{Image: dc.Image(), Facing: models.FacingRight, Area: i * 100000})
+	}
+	return fishes
+}
+
+func TestScene(t *testing.T) {
+	t.Parallel()
+
+	fishes := testSceneFishes()
+	snapshot := NewScene(fishes, 42).Snapshot(320, 180)
+	assert.Equal(t, image.Rect(0, 0, 320, 180), snapshot.Bounds())
+
+	// the same seed renders the same picture, another seed another one
+	assert.Equal(t, snapshot, NewScene(fishes, 42).Snapshot(320, 180))
+	assert.NotEqual(t, snapshot, NewScene(fishes, 43).Snapshot(320, 180))
+
+	// an empty aquarium is the backdrop
+	empty := NewScene(nil, 42).Snapshot(320, 180)
+	assert.Equal(t, floorColor, color.RGBAModel.Convert(empty.At(10, 179)))
+	assert.NotEqual(t, empty, snapshot)
+}
+
+func TestSceneAnimation(t *testing.T) {
+	t.Parallel()
+
+	scene := NewScene(testSceneFishes(), 1)
+	anim := scene.Animation(160, 90)
+	assert.Len(t, anim.Image, AnimationFrames)
+	assert.Len(t, anim.Delay, AnimationFrames)
+	assert.Equal(t, image.Rect(0, 0, 160, 90), anim.Image[0].Bounds())
+	assert.NotEqual(t, anim.Image[0].Pix, anim.Image[AnimationFrames/2].Pix, "the fishes swim")
+
+	// the end of the loop is its start
+	render := func(t float64) image.Image {
+		dc := gg.NewContext(160, 90)
+		scene.draw(dc, background(160, 90), scene.scaled(90), t)
+		return dc.Image()
+	}
+	assert.Equal(t, render(0), render(1))
+}
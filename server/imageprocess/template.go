@@ -0,0 +1,418 @@
+package imageprocess
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+
+	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
+	"github.com/google/uuid"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// The template is an A4 page at 150 dpi. All coordinates below are template pixels.
+const (
+	TemplateWidth  = 1240
+	TemplateHeight = 1754
+
+	templateMargin = 60
+	// markers are 7x7 modules: black ring, white ring, black 3x3 center
+	templateModule = 16
+	markerSize     = 7 * templateModule
+
+	// the aquarium id and a checksum are printed as a grid of black and white cells
+	codeCols = 40
+	codeRows = 4
+	codeCell = 20
+	codeX    = (TemplateWidth - codeCols*codeCell) / 2
+	codeY    = 1510
+
+	// detection runs on a downscaled copy of the photo
+	detectSize = 1000
+)
+
+var (
+	ErrNoTemplate = errors.New("no template found")
+
+	// drawingArea is the part of the template where the fish is drawn
+	drawingArea = image.Rect(templateMargin, 200, TemplateWidth-templateMargin, 1480)
+
+	// markerCenters in order top left, top right, bottom right, bottom left
+	markerCenters = [4][2]float64{
+		{templateMargin + markerSize/2, templateMargin + markerSize/2},
+		{TemplateWidth - templateMargin - markerSize/2, templateMargin + markerSize/2},
+		{TemplateWidth - templateMargin - markerSize/2, TemplateHeight - templateMargin - markerSize/2},
+		{templateMargin + markerSize/2, TemplateHeight - templateMargin - markerSize/2},
+	}
+)
+
+// Template is a detected fish template in a photo
+type Template struct {
+	// AquariumID is read from the printed code
+	AquariumID uuid.UUID
+	// Drawing is the perspective corrected drawing area
+	Drawing image.Image
+}
+
+// RenderTemplate renders a printable template with corner markers and the encoded aquarium id
+func RenderTemplate(aquariumID uuid.UUID) image.Image {
+	dc := gg.NewContext(TemplateWidth, TemplateHeight)
+	dc.SetColor(color.White)
+	dc.Clear()
+
+	// corner markers
+	for _, center := range markerCenters {
+		x := center[0] - markerSize/2
+		y := center[1] - markerSize/2
+
+		dc.SetColor(color.Black)
+		dc.DrawRectangle(x, y, markerSize, markerSize)
+		dc.Fill()
+		dc.SetColor(color.White)
+		dc.DrawRectangle(x+templateModule, y+templateModule, 5*templateModule, 5*templateModule)
+		dc.Fill()
+		dc.SetColor(color.Black)
+		dc.DrawRectangle(x+2*templateModule, y+2*templateModule, 3*templateModule, 3*templateModule)
+		dc.Fill()
+	}
+
+	// drawing area, light enough to be removed as background
+	dc.SetRGB255(0xdd, 0xdd, 0xdd)
+	dc.SetLineWidth(3)
+	dc.SetDash(12, 8)
+	dc.DrawRectangle(float64(drawingArea.Min.X), float64(drawingArea.Min.Y), float64(drawingArea.Dx()), float64(drawingArea.Dy()))
+	dc.Stroke()
+
+	// code
+	dc.SetColor(color.Black)
+	for i, bit := range encodeTemplateCode(aquariumID) {
+		if !bit {
+			continue
+		}
+		x := codeX + (i%codeCols)*codeCell
+		y := codeY + (i/codeCols)*codeCell
+		dc.DrawRectangle(float64(x), float64(y), codeCell, codeCell)
+	}
+	dc.Fill()
+
+	// labels
+	if f, err := truetype.Parse(goregular.TTF); err == nil {
+		dc.SetRGB255(0x44, 0x44, 0x44)
+		dc.SetFontFace(truetype.NewFace(f, &truetype.Options{Size: 36}))
+		dc.DrawStringAnchored("Male hier deinen Fisch!", TemplateWidth/2, markerCenters[0][1], 0.5, 0.5)
+		dc.SetFontFace(truetype.NewFace(f, &truetype.Options{Size: 16}))
+		dc.DrawStringAnchored("Aquarium "+aquariumID.String(), TemplateWidth/2, markerCenters[3][1]+10, 0.5, 0.5)
+	}
+
+	return dc.Image()
+}
+
+// encodeTemplateCode returns the bits of the aquarium id followed by its crc32
+func encodeTemplateCode(aquariumID uuid.UUID) []bool {
+	raw := make([]byte, 0, 20)
+	raw = append(raw, aquariumID[:]...)
+	raw = binary.BigEndian.AppendUint32(raw, crc32.ChecksumIEEE(aquariumID[:]))
+
+	bits := make([]bool, codeCols*codeRows)
+	for i := range bits {
+		bits[i] = raw[i/8]&(0x80>>(i%8)) != 0
+	}
+	return bits
+}
+
+// decodeTemplateCode is the reverse of encodeTemplateCode and validates the checksum
+func decodeTemplateCode(bits []bool) (uuid.UUID, bool) {
+	raw := make([]byte, codeCols*codeRows/8)
+	for i, bit := range bits {
+		if bit {
+			raw[i/8] |= 0x80 >> (i % 8)
+		}
+	}
+
+	id, err := uuid.FromBytes(raw[:16])
+	if err != nil {
+		return uuid.Nil, false
+	}
+	if crc32.ChecksumIEEE(raw[:16]) != binary.BigEndian.Uint32(raw[16:]) {
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+// DetectTemplate finds the corner markers of a template in a photo, reads the
+// aquarium id and warps the drawing area into a rectangle. Without a readable id it returns ErrNoTemplate.
+func DetectTemplate(src image.Image) (*Template, error) {
+	corners, err := findMarkers(src)
+	if err != nil {
+		return nil, err
+	}
+
+	// the photo can be rotated, try every orientation until the checksum matches. Four dark shapes
+	// without a valid code are no template, the photo is used as it is.
+	for rotation := 0; rotation < 4; rotation++ {
+		var dst [4][2]float64
+		for i := range dst {
+			dst[i] = corners[(i+rotation)%4]
+		}
+
+		h, ok := newHomography(markerCenters, dst)
+		if !ok {
+			continue
+		}
+
+		if id, ok := decodeTemplateCode(readTemplateCode(src, h)); ok {
+			return &Template{
+				AquariumID: id,
+				Drawing:    warp(src, h, drawingArea),
+			}, nil
+		}
+	}
+
+	return nil, ErrNoTemplate
+}
+
+// findMarkers returns the marker centers in photo coordinates, clockwise starting top left
+func findMarkers(src image.Image) ([4][2]float64, error) {
+	var corners [4][2]float64
+
+	bounds := src.Bounds()
+	scale := (max(bounds.Dx(), bounds.Dy()) + detectSize - 1) / detectSize
+	w, h := bounds.Dx()/scale, bounds.Dy()/scale
+	if w < 8 || h < 8 {
+		return corners, ErrNoTemplate
+	}
+
+	// background is everything that is not dark
+	background := make([][]bool, h)
+	for y := 0; y < h; y++ {
+		background[y] = make([]bool, w)
+		for x := 0; x < w; x++ {
+			var sum float64
+			for sy := 0; sy < scale; sy++ {
+				for sx := 0; sx < scale; sx++ {
+					sum += luminance(src.At(bounds.Min.X+x*scale+sx, bounds.Min.Y+y*scale+sy))
+				}
+			}
+			background[y][x] = !isDark(sum / float64(scale*scale))
+		}
+	}
+
+	components := findComponents(background, 8)
+
+	// a marker is a ring with a filled square in its center
+	type marker struct {
+		x, y float64
+		size int
+	}
+	markers := []marker{}
+	for _, ring := range components {
+		if ring.border {
+			continue
+		}
+		rx, ry := ring.centroid()
+		ringSize := float64(max(ring.bounds.Dx(), ring.bounds.Dy()))
+		if aspect := float64(ring.bounds.Dx()) / float64(ring.bounds.Dy()); aspect < 0.3 || aspect > 3.3 {
+			continue
+		}
+
+		for _, center := range components {
+			if center == ring || center.size >= ring.size {
+				continue
+			}
+			cx, cy := center.centroid()
+			if math.Hypot(cx-rx, cy-ry) > 0.15*ringSize {
+				continue
+			}
+			// ideal ratios are 9/24 for the area and 3/7 for the size
+			if ratio := float64(center.size) / float64(ring.size); ratio < 0.2 || ratio > 0.6 {
+				continue
+			}
+			if ratio := float64(max(center.bounds.Dx(), center.bounds.Dy())) / ringSize; ratio < 0.25 || ratio > 0.65 {
+				continue
+			}
+
+			markers = append(markers, marker{
+				x:    float64(bounds.Min.X) + rx*float64(scale),
+				y:    float64(bounds.Min.Y) + ry*float64(scale),
+				size: ring.size,
+			})
+			break
+		}
+	}
+
+	if len(markers) < 4 {
+		return corners, ErrNoTemplate
+	}
+
+	// prefer the biggest markers, the perspective may shrink the ones further away
+	sort.Slice(markers, func(i, j int) bool { return markers[i].size > markers[j].size })
+	if len(markers) > 8 {
+		markers = markers[:8]
+	}
+
+	// pick the four markers spanning the biggest quad
+	bestArea := 0.0
+	for a := 0; a < len(markers); a++ {
+		for b := a + 1; b < len(markers); b++ {
+			for c := b + 1; c < len(markers); c++ {
+				for d := c + 1; d < len(markers); d++ {
+					quad := orderCorners([4][2]float64{
+						{markers[a].x, markers[a].y},
+						{markers[b].x, markers[b].y},
+						{markers[c].x, markers[c].y},
+						{markers[d].x, markers[d].y},
+					})
+					if area := quadArea(quad); area > bestArea {
+						bestArea = area
+						corners = quad
+					}
+				}
+			}
+		}
+	}
+
+	if bestArea == 0 {
+		return corners, ErrNoTemplate
+	}
+
+	return corners, nil
+}
+
+// orderCorners sorts the points clockwise (in image coordinates) starting with the top left one
+func orderCorners(points [4][2]float64) [4][2]float64 {
+	var cx, cy float64
+	for _, p := range points {
+		cx += p[0] / 4
+		cy += p[1] / 4
+	}
+
+	sorted := points[:]
+	sort.Slice(sorted, func(i, j int) bool {
+		return math.Atan2(sorted[i][1]-cy, sorted[i][0]-cx) < math.Atan2(sorted[j][1]-cy, sorted[j][0]-cx)
+	})
+
+	start := 0
+	for i, p := range sorted {
+		if p[0]+p[1] < sorted[start][0]+sorted[start][1] {
+			start = i
+		}
+	}
+
+	var ordered [4][2]float64
+	for i := range ordered {
+		ordered[i] = sorted[(start+i)%4]
+	}
+	return ordered
+}
+
+// quadArea is the shoelace formula for ordered points
+func quadArea(quad [4][2]float64) float64 {
+	area := 0.0
+	for i := range quad {
+		j := (i + 1) % 4
+		area += quad[i][0]*quad[j][1] - quad[j][0]*quad[i][1]
+	}
+	return math.Abs(area) / 2
+}
+
+// readTemplateCode samples the code cells of the template in the photo
+func readTemplateCode(src image.Image, h homography) []bool {
+	bits := make([]bool, codeCols*codeRows)
+	for i := range bits {
+		u := codeX + (float64(i%codeCols)+0.5)*codeCell
+		v := codeY + (float64(i/codeCols)+0.5)*codeCell
+
+		// average a small neighbourhood around the cell center
+		var sum float64
+		for _, d := range [5][2]float64{{0, 0}, {-4, 0}, {4, 0}, {0, -4}, {0, 4}} {
+			x, y := h.apply(u+d[0], v+d[1])
+			sum += luminance(src.At(int(x), int(y)))
+		}
+		bits[i] = isDark(sum / 5)
+	}
+	return bits
+}
+
+// warp maps the template rectangle rect through h back into a straight image
+func warp(src image.Image, h homography, rect image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	bounds := src.Bounds()
+
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			sx, sy := h.apply(float64(rect.Min.X+x)+0.5, float64(rect.Min.Y+y)+0.5)
+			px, py := int(math.Floor(sx)), int(math.Floor(sy))
+			if !(image.Point{px, py}.In(bounds)) {
+				dst.Set(x, y, color.White)
+				continue
+			}
+			dst.Set(x, y, src.At(px, py))
+		}
+	}
+
+	return dst
+}
+
+// luminance returns the brightness of c between 0 and 1
+func luminance(c color.Color) float64 {
+	r, g, b, _ := c.RGBA()
+	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 0xffff
+}
+
+func isDark(luminance float64) bool {
+	return luminance < 0.45
+}
+
+// homography is a projective transform from template to photo coordinates
+type homography [8]float64
+
+func (h homography) apply(u, v float64) (float64, float64) {
+	w := h[6]*u + h[7]*v + 1
+	return (h[0]*u + h[1]*v + h[2]) / w, (h[3]*u + h[4]*v + h[5]) / w
+}
+
+// newHomography solves the projective transform mapping every src point onto its dst point
+func newHomography(src, dst [4][2]float64) (homography, bool) {
+	var m [8][9]float64
+	for i := 0; i < 4; i++ {
+		u, v := src[i][0], src[i][1]
+		x, y := dst[i][0], dst[i][1]
+		m[2*i] = [9]float64{u, v, 1, 0, 0, 0, -u * x, -v * x, x}
+		m[2*i+1] = [9]float64{0, 0, 0, u, v, 1, -u * y, -v * y, y}
+	}
+
+	// gaussian elimination with partial pivoting
+	for col := 0; col < 8; col++ {
+		pivot := col
+		for row := col + 1; row < 8; row++ {
+			if math.Abs(m[row][col]) > math.Abs(m[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(m[pivot][col]) < 1e-12 {
+			return homography{}, false
+		}
+		m[col], m[pivot] = m[pivot], m[col]
+
+		for row := 0; row < 8; row++ {
+			if row == col {
+				continue
+			}
+			factor := m[row][col] / m[col][col]
+			for k := col; k < 9; k++ {
+				m[row][k] -= factor * m[col][k]
+			}
+		}
+	}
+
+	var h homography
+	for i := range h {
+		h[i] = m[i][8] / m[i][i]
+	}
+	return h, true
+}
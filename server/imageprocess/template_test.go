@@ -0,0 +1,108 @@
+package imageprocess
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// photograph puts the template page in perspective onto a table
+func photograph(t *testing.T, page image.Image, corners [4][2]float64) image.Image {
+	pageCorners := [4][2]float64{{0, 0}, {TemplateWidth, 0}, {TemplateWidth, TemplateHeight}, {0, TemplateHeight}}
+	h, ok := newHomography(corners, pageCorners)
+	require.True(t, ok)
+
+	photo := image.NewRGBA(image.Rect(0, 0, 1600, 2000))
+	table := color.RGBA{R: 0x8b, G: 0x5a, B: 0x2b, A: 0xff}
+	for y := 0; y < 2000; y++ {
+		for x := 0; x < 1600; x++ {
+			u, v := h.apply(float64(x)+0.5, float64(y)+0.5)
+			p := image.Pt(int(u), int(v))
+			if !p.In(page.Bounds()) {
+				photo.Set(x, y, table)
+				continue
+			}
+			photo.Set(x, y, page.At(p.X, p.Y))
+		}
+	}
+	return photo
+}
+
+func templateWithFish(aquariumID uuid.UUID) image.Image {
+	page := image.NewRGBA(image.Rect(0, 0, TemplateWidth, TemplateHeight))
+	draw.Draw(page, page.Bounds(), RenderTemplate(aquariumID), image.Point{}, draw.Src)
+
+	fish := image.Rect(drawingArea.Min.X+300, drawingArea.Min.Y+400, drawingArea.Min.X+700, drawingArea.Min.Y+600)
+	draw.Draw(page, fish, image.NewUniform(color.RGBA{B: 0xff, A: 0xff}), image.Point{}, draw.Src)
+	return page
+}
+
+func TestTemplateCode(t *testing.T) {
+	t.Parallel()
+
+	id := uuid.New()
+	decoded, ok := decodeTemplateCode(encodeTemplateCode(id))
+	assert.True(t, ok)
+	assert.Equal(t, id, decoded)
+
+	bits := encodeTemplateCode(id)
+	bits[3] = !bits[3]
+	_, ok = decodeTemplateCode(bits)
+	assert.False(t, ok)
+}
+
+func TestDetectTemplate(t *testing.T) {
+	t.Parallel()
+
+	id := uuid.New()
+	page := templateWithFish(id)
+
+	tests := map[string][4][2]float64{
+		"skewed":  {{250, 150}, {1400, 230}, {1480, 1850}, {120, 1750}},
+		"upside":  {{1450, 1800}, {180, 1880}, {120, 220}, {1380, 100}},
+		"rotated": {{1500, 180}, {1450, 1750}, {110, 1800}, {90, 200}},
+	}
+
+	for name, corners := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			template, err := DetectTemplate(photograph(t, page, corners))
+			require.NoError(t, err)
+			assert.Equal(t, id, template.AquariumID)
+			assert.Equal(t, image.Rect(0, 0, drawingArea.Dx(), drawingArea.Dy()), template.Drawing.Bounds())
+
+			// fish center is blue, corners of the drawing area are white
+			r, _, b, _ := template.Drawing.At(500, 500).RGBA()
+			assert.Less(t, r, uint32(0x4000))
+			assert.Greater(t, b, uint32(0xc000))
+			r, _, _, _ = template.Drawing.At(50, 50).RGBA()
+			assert.Greater(t, r, uint32(0xc000))
+		})
+	}
+}
+
+func TestDetectTemplateWithoutTemplate(t *testing.T) {
+	t.Parallel()
+
+	_, err := DetectTemplate(testSheet())
+	assert.ErrorIs(t, err, ErrNoTemplate)
+}
+
+func TestDetectTemplateWithoutCode(t *testing.T) {
+	t.Parallel()
+
+	// the markers are there but the code is covered
+	page := image.NewRGBA(image.Rect(0, 0, TemplateWidth, TemplateHeight))
+	draw.Draw(page, page.Bounds(), templateWithFish(uuid.New()), image.Point{}, draw.Src)
+	code := image.Rect(codeX, codeY, codeX+codeCols*codeCell, codeY+codeRows*codeCell)
+	draw.Draw(page, code, image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	_, err := DetectTemplate(photograph(t, page, [4][2]float64{{250, 150}, {1400, 230}, {1480, 1850}, {120, 1750}}))
+	assert.ErrorIs(t, err, ErrNoTemplate)
+}
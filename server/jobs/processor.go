@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"image"
+	"io/fs"
+	"log/slog"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/names"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/storage"
+)
+
+// ErrNoOriginal is returned for uploads whose original was already removed
+var ErrNoOriginal = errors.New("original image is not stored anymore")
+
+// ErrDuplicate is returned for uploads that only contain drawings already in the aquarium
+var ErrDuplicate = errors.New("duplicate drawing")
+
+// Processor turns uploaded images into fishes
+type Processor struct {
+	log     *slog.Logger
+	storage *storage.Storage
+	pubsub  pubsub.Broker[models.Event]
+}
+
+func NewProcessor(log *slog.Logger, store *storage.Storage, ps pubsub.Broker[models.Event]) *Processor {
+	return &Processor{
+		log:     log,
+		storage: store,
+		pubsub:  ps,
+	}
+}
+
+// ExtractFishes runs the image pipeline on the original of the job and returns the
+// aquarium the fishes belong to, the fishes and the unmasked sources they were cut from.
+// The job is not changed, so it can be used for previews.
+func ExtractFishes(store *storage.Storage, job *models.Job, log *slog.Logger) (*models.Aquarium, []image.Image, []image.Image, error) {
+	if job.Original == "" {
+		return nil, nil, nil, Permanent(ErrNoOriginal)
+	}
+
+	src, err := imageprocess.LoadImage(store.OriginalPath(job.Original))
+	if err != nil {
+		return nil, nil, nil, Permanent(err)
+	}
+
+	// Find template
+	aquariumID := job.AquariumID
+	if template, err := imageprocess.DetectTemplate(src); err == nil {
+		src = template.Drawing
+
+		if template.AquariumID != aquariumID {
+			if _, err := store.Aquarium(template.AquariumID); err != nil {
+				log.Error("Failed to get aquarium of template", slog.String("aquarium", template.AquariumID.String()), slog.String("error", err.Error()))
+			} else {
+				aquariumID = template.AquariumID
+			}
+		}
+	}
+
+	if aquariumID == uuid.Nil {
+		return nil, nil, nil, Permanent(imageprocess.ErrNoTemplate)
+	}
+
+	aquarium, err := store.Aquarium(aquariumID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Process Image
+	settings := Settings(aquarium, job)
+	opts := imageprocess.Options{
+		Split:     *settings.Split,
+		Threshold: settings.Threshold,
+		Seeds:     settings.Seeds,
+		Crop:      settings.Crop,
+	}
+
+	images, sources := imageprocess.ExtractFishesWithSources(src, opts)
+	return aquarium, images, sources, nil
+}
+
+// Settings are the settings the upload job is processed with in aquarium, the split mode of the
+// aquarium fills in a missing one
+func Settings(aquarium *models.Aquarium, job *models.Job) models.ProcessSettings {
+	settings := job.Settings
+	if settings.Split == nil {
+		split := aquarium.SplitFishes
+		settings.Split = &split
+	}
+
+	return settings
+}
+
+// Process runs the image pipeline on the original of the job. Running it again
+// updates the fishes of the job in place.
+func (p *Processor) Process(ctx context.Context, job *models.Job) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	aquarium, images, sources, err := ExtractFishes(p.storage, job, p.log)
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// the template moved the upload to another aquarium
+	if job.AquariumID != uuid.Nil && job.AquariumID != aquarium.ID {
+		for _, fishID := range job.FishIDs {
+			if err := p.storage.DeleteFish(job.AquariumID, fishID); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+		job.FishIDs = nil
+		job.Slots = nil
+		job.DeletedSlots = nil
+	}
+	job.AquariumID = aquarium.ID
+
+	candidates, err := p.duplicateCandidates(aquarium, job)
+	if err != nil {
+		return err
+	}
+
+	// kept are the fishes of the job cut again, duplicates and deleted drawings do not get one.
+	// A fish stays with its drawing, the slot is the position of the drawing on the sheet.
+	kept := []uuid.UUID{}
+	job.Duplicates = nil
+	for i, img := range images {
+		if slices.Contains(job.DeletedSlots, i) {
+			continue
+		}
+		fishID, ok := job.SlotFish(i)
+		if !ok {
+			fishID = uuid.New()
+		}
+
+		fish, err := p.storage.Fish(aquarium.ID, fishID)
+		if err != nil {
+			name, flagged := names.Moderate(job.Name, aquarium.NamePolicy)
+			fish = &models.Fish{
+				ID:          fishID,
+				AquariumID:  aquarium.ID,
+				UploadID:    job.ID,
+				Name:        name,
+				Status:      models.FishStatusProcessing,
+				NameFlagged: flagged,
+				Approved:    !aquarium.NeedApproval && !flagged, // flagged names always need approval
+			}
+		}
+		// fishes already swimming are updated instead of announced again
+		announce := !fish.Ready()
+
+		// moderator corrections survive reprocessing with the same settings
+		mask, err := p.storage.FishMask(aquarium.ID, fishID)
+		if err != nil {
+			return err
+		}
+		if len(mask.Strokes) > 0 && mask.Settings != nil && !mask.Settings.Equal(Settings(aquarium, job)) {
+			p.log.Info("Dropped mask painted with other settings", slog.String("job", job.ID.String()), slog.String("fish", fishID.String()))
+			if err := p.storage.SaveFishMask(aquarium.ID, fishID, &models.FishMask{Strokes: []models.MaskStroke{}}); err != nil {
+				return err
+			}
+		} else if len(mask.Strokes) > 0 {
+			img = imageprocess.ApplyStrokes(img, sources[i], mask.Strokes)
+		}
+
+		hash := imageprocess.DHash(img)
+		fish.Hash = &hash
+
+		// only new fishes are checked, reprocessing keeps what the moderator decided
+		if announce {
+			if original := imageprocess.FindDuplicate(hash, candidates); original != nil {
+				switch aquarium.DuplicatePolicy {
+				case models.DuplicatePolicyReject, models.DuplicatePolicyMerge:
+					p.log.Info("Skipped duplicate fish", slog.String("job", job.ID.String()), slog.String("duplicate_of", original.ID.String()))
+					job.Duplicates = append(job.Duplicates, original.ID)
+					continue
+				case models.DuplicatePolicyFlag:
+					fish.Approved = false
+					fish.DuplicateOf = &original.ID
+				}
+			}
+		}
+		if !ok {
+			job.AddFish(fishID, i)
+		}
+		kept = append(kept, fishID)
+
+		targetPath, err := p.storage.FishImagePath(aquarium.ID, fishID)
+		if err != nil {
+			return err
+		}
+		if err := imageprocess.SaveImage(img, targetPath, p.log); err != nil {
+			return err
+		}
+		for _, size := range models.ImageVariants {
+			variantPath, err := p.storage.FishImageVariantPath(aquarium.ID, fishID, size)
+			if err != nil {
+				return err
+			}
+			if err := imageprocess.SaveImage(imageprocess.Resize(img, size.MaxEdge()), variantPath, p.log); err != nil {
+				return err
+			}
+		}
+
+		fish.Filename = fishID.String() + ".png"
+		fish.Outline = imageprocess.TraceOutline(img)
+		fish.Attributes = imageprocess.Analyze(img)
+		fish.Status = models.FishStatusReady
+		if err := p.storage.InsertFish(aquarium.ID, fish); err != nil {
+			return err
+		}
+
+		if announce {
+			p.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishJoin, fish))
+		} else {
+			p.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishUpdate, fish))
+		}
+	}
+
+	// fishes the drawing does not contain anymore
+	fishIDs, slots := job.FishIDs, job.Slots
+	job.FishIDs, job.Slots = []uuid.UUID{}, []int{}
+	for i, fishID := range fishIDs {
+		if slices.Contains(kept, fishID) {
+			job.AddFish(fishID, slots[i])
+			continue
+		}
+
+		fish, err := p.storage.Fish(aquarium.ID, fishID)
+		if err != nil {
+			continue
+		}
+
+		if err := p.storage.DeleteFish(aquarium.ID, fishID); err != nil {
+			return err
+		}
+
+		p.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishLeft, fish))
+	}
+
+	if len(kept) == 0 && aquarium.DuplicatePolicy == models.DuplicatePolicyReject {
+		return Permanent(ErrDuplicate)
+	}
+
+	return nil
+}
+
+// duplicateCandidates returns the fishes an upload may duplicate, all ready fishes not created by the job
+func (p *Processor) duplicateCandidates(aquarium *models.Aquarium, job *models.Job) ([]*models.Fish, error) {
+	if aquarium.DuplicatePolicy == models.DuplicatePolicyOff {
+		return nil, nil
+	}
+
+	fishes, err := p.storage.Fishes(aquarium.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []*models.Fish{}
+	for _, fish := range fishes {
+		if fish.Ready() && fish.UploadID != job.ID {
+			candidates = append(candidates, fish)
+		}
+	}
+	return candidates, nil
+}
+
+// Failed marks the fishes of the job as failed
+func (p *Processor) Failed(job *models.Job, err error) {
+	if job.AquariumID == uuid.Nil {
+		return
+	}
+
+	for _, fishID := range job.FishIDs {
+		fish, err := p.storage.Fish(job.AquariumID, fishID)
+		if err != nil {
+			continue
+		}
+
+		fish.Status = models.FishStatusFailed
+		if err := p.storage.InsertFish(job.AquariumID, fish); err != nil {
+			p.log.Error("Failed to save fish", slog.String("error", err.Error()))
+		}
+	}
+}
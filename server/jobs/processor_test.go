@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/draw"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/storage"
+)
+
+// uploadDrawing stores a drawing as original and processes it like a fresh upload
+func uploadDrawing(t *testing.T, store *storage.Storage, processor *Processor, aquarium *models.Aquarium) (*models.Job, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 200, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(20, 30, 150, 70), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(150, 10, 180, 90), image.NewUniform(color.RGBA{B: 255, A: 255}), image.Point{}, draw.Src)
+
+	job := &models.Job{ID: uuid.New(), AquariumID: aquarium.ID, Name: "Boid"}
+	job.Original = job.ID.String() + ".png"
+	require.NoError(t, os.MkdirAll(filepath.Dir(store.OriginalPath(job.Original)), os.ModePerm))
+	require.NoError(t, imageprocess.SaveImage(img, store.OriginalPath(job.Original), slog.Default()))
+
+	return job, processor.Process(context.Background(), job)
+}
+
+func TestProcessDuplicates(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []models.DuplicatePolicy{
+		models.DuplicatePolicyOff,
+		models.DuplicatePolicyFlag,
+		models.DuplicatePolicyReject,
+		models.DuplicatePolicyMerge,
+	} {
+		t.Run(string(policy), func(t *testing.T) {
+			t.Parallel()
+
+			store := storage.NewStorage(t.TempDir())
+			processor := NewProcessor(slog.Default(), store, pubsub.NewPubSub[models.Event]())
+
+			aquarium := &models.Aquarium{ID: uuid.New(), DuplicatePolicy: policy}
+			require.NoError(t, store.InsertAquarium(aquarium))
+
+			first, err := uploadDrawing(t, store, processor, aquarium)
+			require.NoError(t, err)
+			require.Len(t, first.FishIDs, 1)
+
+			second, err := uploadDrawing(t, store, processor, aquarium)
+			switch policy {
+			case models.DuplicatePolicyOff, models.DuplicatePolicyFlag:
+				require.NoError(t, err)
+				require.Len(t, second.FishIDs, 1)
+
+				fish, err := store.Fish(aquarium.ID, second.FishIDs[0])
+				require.NoError(t, err)
+				if policy == models.DuplicatePolicyFlag {
+					assert.False(t, fish.Approved)
+					assert.Equal(t, &first.FishIDs[0], fish.DuplicateOf)
+				} else {
+					assert.True(t, fish.Approved)
+					assert.Nil(t, fish.DuplicateOf)
+				}
+			case models.DuplicatePolicyReject:
+				assert.ErrorIs(t, err, ErrDuplicate)
+				assert.ErrorIs(t, err, ErrPermanent)
+				assert.Empty(t, second.FishIDs)
+				assert.Equal(t, first.FishIDs, second.Duplicates)
+			case models.DuplicatePolicyMerge:
+				require.NoError(t, err)
+				assert.Empty(t, second.FishIDs)
+				assert.Equal(t, first.FishIDs, second.Duplicates)
+			}
+		})
+	}
+}
+
+func TestProcessMask(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	processor := NewProcessor(slog.Default(), store, pubsub.NewPubSub[models.Event]())
+
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	job, err := uploadDrawing(t, store, processor, aquarium)
+	require.NoError(t, err)
+	require.Len(t, job.FishIDs, 1)
+	fishID := job.FishIDs[0]
+
+	alpha := func(x, y int) uint32 {
+		img, err := store.FishImage(aquarium.ID, fishID)
+		require.NoError(t, err)
+		_, _, _, a := img.At(x, y).RGBA()
+		return a
+	}
+	require.NotZero(t, alpha(25, 30))
+
+	// painted for the current settings the strokes survive reprocessing
+	settings := Settings(aquarium, job)
+	require.NoError(t, store.SaveFishMask(aquarium.ID, fishID, &models.FishMask{
+		Settings: &settings,
+		Strokes:  []models.MaskStroke{{Mode: models.MaskStrokeRemove, Width: 10, Points: []image.Point{{10, 30}, {40, 30}}}},
+	}))
+	require.NoError(t, processor.Process(context.Background(), job))
+	assert.Zero(t, alpha(25, 30))
+	require.NoError(t, processor.Process(context.Background(), job))
+	assert.Zero(t, alpha(25, 30))
+
+	// other settings cut the drawing differently
+	job.Settings.Threshold = 0.6
+	require.NoError(t, processor.Process(context.Background(), job))
+	assert.NotZero(t, alpha(25, 30))
+	mask, err := store.FishMask(aquarium.ID, fishID)
+	require.NoError(t, err)
+	assert.Empty(t, mask.Strokes)
+}
+
+func TestProcessDeletedSlot(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	processor := NewProcessor(slog.Default(), store, pubsub.NewPubSub[models.Event]())
+
+	aquarium := &models.Aquarium{ID: uuid.New(), SplitFishes: true}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	// three drawings side by side
+	img := image.NewRGBA(image.Rect(0, 0, 300, 100))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	for i, c := range []color.RGBA{{R: 200, A: 255}, {G: 200, A: 255}, {B: 200, A: 255}} {
+		draw.Draw(img, image.Rect(20+i*100, 30, 80+i*100, 70), image.NewUniform(c), image.Point{}, draw.Src)
+	}
+
+	job := &models.Job{ID: uuid.New(), AquariumID: aquarium.ID}
+	job.Original = job.ID.String() + ".png"
+	require.NoError(t, os.MkdirAll(filepath.Dir(store.OriginalPath(job.Original)), os.ModePerm))
+	require.NoError(t, imageprocess.SaveImage(img, store.OriginalPath(job.Original), slog.Default()))
+	require.NoError(t, processor.Process(context.Background(), job))
+	require.Len(t, job.FishIDs, 3)
+
+	colorOf := func(fishID uuid.UUID) color.Color {
+		img, err := store.FishImage(aquarium.ID, fishID)
+		require.NoError(t, err)
+		center := img.Bounds().Size().Div(2)
+		return color.RGBAModel.Convert(img.At(center.X, center.Y))
+	}
+	colors := map[uuid.UUID]color.Color{}
+	for _, fishID := range job.FishIDs {
+		colors[fishID] = colorOf(fishID)
+	}
+	require.NotEqual(t, colors[job.FishIDs[0]], colors[job.FishIDs[1]])
+	require.NotEqual(t, colors[job.FishIDs[1]], colors[job.FishIDs[2]])
+
+	// the middle fish is deleted like the moderator does
+	deleted, _ := job.SlotFish(1)
+	require.NoError(t, store.DeleteFish(aquarium.ID, deleted))
+	job.DeleteFish(deleted)
+	remaining := slices.Clone(job.FishIDs)
+
+	require.NoError(t, processor.Process(context.Background(), job))
+	assert.Equal(t, remaining, job.FishIDs)
+	assert.Equal(t, []int{0, 2}, job.Slots)
+	for _, fishID := range job.FishIDs {
+		assert.Equal(t, colors[fishID], colorOf(fishID), fishID.String())
+	}
+	_, err := store.Fish(aquarium.ID, deleted)
+	assert.Error(t, err)
+	fishes, err := store.Fishes(aquarium.ID)
+	require.NoError(t, err)
+	assert.Len(t, fishes, 2)
+}
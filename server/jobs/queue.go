@@ -0,0 +1,339 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/storage"
+)
+
+const (
+	maxAttempts   = 3
+	retryDelay    = 5 * time.Second
+	sweepInterval = 2 * time.Second
+	// cleanupInterval is how often the originals of finished jobs are checked, it reads all jobs
+	cleanupInterval = 10 * time.Minute
+	// claimTimeout is how long the claim of a job holds without renewal, then its server is considered gone
+	claimTimeout = time.Minute
+	// renewInterval is how often a running job renews its claim
+	renewInterval = claimTimeout / 4
+)
+
+// ErrPermanent marks errors where a retry will not help
+var ErrPermanent = errors.New("permanent error")
+
+// Permanent wraps err, the job fails without retries
+func Permanent(err error) error {
+	return fmt.Errorf("%w: %w", ErrPermanent, err)
+}
+
+type Handler interface {
+	// Process runs the job. It should stop early when ctx is done.
+	Process(ctx context.Context, job *models.Job) error
+	// Failed is called once the job failed for good
+	Failed(job *models.Job, err error)
+}
+
+// Queue is a bounded worker pool for jobs. Jobs are persisted in the storage,
+// so pending jobs survive a restart and are picked up again. Servers sharing the storage
+// claim a job before running it, every job runs on one server at a time.
+type Queue struct {
+	log     *slog.Logger
+	storage *storage.Storage
+	handler Handler
+	workers int
+	// retention is how long originals are kept after processing, zero keeps them forever
+	retention time.Duration
+
+	pending chan uuid.UUID
+
+	lock   sync.Mutex
+	queued map[uuid.UUID]struct{}
+
+	wg sync.WaitGroup
+}
+
+func NewQueue(log *slog.Logger, store *storage.Storage, handler Handler, workers int, size int, retention time.Duration) *Queue {
+	return &Queue{
+		log:       log,
+		storage:   store,
+		handler:   handler,
+		workers:   workers,
+		retention: retention,
+		pending:   make(chan uuid.UUID, size),
+		queued:    make(map[uuid.UUID]struct{}),
+	}
+}
+
+// Start runs the workers until ctx is done
+func (q *Queue) Start(ctx context.Context) {
+	// jobs stored before the index are picked up too
+	if err := q.storage.IndexJobs(); err != nil {
+		q.log.Error("Failed to index jobs", slog.String("error", err.Error()))
+	}
+	q.requeue()
+	q.cleanup()
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work(ctx)
+	}
+
+	q.wg.Add(1)
+	go q.sweep(ctx)
+}
+
+// Wait blocks until all workers stopped
+func (q *Queue) Wait() {
+	q.wg.Wait()
+}
+
+// Enqueue persists the job and schedules it. If the queue is full, the job is picked up later.
+func (q *Queue) Enqueue(job *models.Job) error {
+	job.Status = models.JobStatusPending
+	job.Attempts = 0
+	job.Error = ""
+	job.RunAfter = time.Time{}
+
+	if err := q.storage.InsertJob(job); err != nil {
+		return err
+	}
+
+	q.schedule(job.ID)
+
+	return nil
+}
+
+func (q *Queue) schedule(jobID uuid.UUID) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if _, ok := q.queued[jobID]; ok {
+		return
+	}
+
+	select {
+	case q.pending <- jobID:
+		q.queued[jobID] = struct{}{}
+	default:
+		q.log.Debug("Job queue is full", slog.String("job", jobID.String()))
+	}
+}
+
+func (q *Queue) work(ctx context.Context) {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case jobID := <-q.pending:
+			q.run(ctx, jobID)
+
+			q.lock.Lock()
+			delete(q.queued, jobID)
+			q.lock.Unlock()
+		}
+	}
+}
+
+func (q *Queue) run(ctx context.Context, jobID uuid.UUID) {
+	claimed, err := q.storage.ClaimJob(jobID, claimTimeout)
+	if err != nil {
+		q.log.Error("Failed to claim job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		return
+	}
+	if !claimed {
+		// another server runs it
+		return
+	}
+	defer q.release(jobID)
+
+	// read after the claim, the job may have run on another server meanwhile
+	job, err := q.storage.Job(jobID)
+	if err != nil {
+		q.log.Error("Failed to get job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		return
+	}
+
+	if job.Status != models.JobStatusPending || job.RunAfter.After(time.Now()) {
+		return
+	}
+
+	job.Status = models.JobStatusRunning
+	job.Attempts++
+	if err := q.storage.InsertJob(job); err != nil {
+		q.log.Error("Failed to save job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		return
+	}
+
+	renewed := make(chan struct{})
+	go q.renew(jobID, renewed)
+	err = q.handler.Process(ctx, job)
+	close(renewed)
+
+	switch {
+	case err == nil:
+		job.Status = models.JobStatusDone
+		job.Error = ""
+	case ctx.Err() != nil:
+		// shutdown, does not count as attempt
+		job.Status = models.JobStatusPending
+		job.Attempts--
+	case errors.Is(err, ErrPermanent) || job.Attempts >= maxAttempts:
+		q.log.Error("Job failed", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		job.Status = models.JobStatusFailed
+		job.Error = err.Error()
+		q.handler.Failed(job, err)
+	default:
+		q.log.Warn("Job failed, retry later", slog.String("job", jobID.String()), slog.Int("attempts", job.Attempts), slog.String("error", err.Error()))
+		job.Status = models.JobStatusPending
+		job.Error = err.Error()
+		job.RunAfter = time.Now().Add(time.Duration(job.Attempts) * retryDelay)
+	}
+
+	if err := q.storage.InsertJob(job); err != nil {
+		q.log.Error("Failed to save job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+	}
+}
+
+// renew keeps the claim of a running job until done is closed
+func (q *Queue) renew(jobID uuid.UUID, done <-chan struct{}) {
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := q.storage.RenewJobClaim(jobID); err != nil {
+				q.log.Error("Failed to renew job claim", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+func (q *Queue) release(jobID uuid.UUID) {
+	if err := q.storage.ReleaseJob(jobID); err != nil {
+		q.log.Error("Failed to release job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+	}
+}
+
+// sweep schedules jobs that did not fit into the queue or wait for a retry
+// and removes originals after the retention period
+func (q *Queue) sweep(ctx context.Context) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	cleanupTicker := time.NewTicker(cleanupInterval)
+	defer cleanupTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.requeue()
+		case <-cleanupTicker.C:
+			q.cleanup()
+		}
+	}
+}
+
+// requeue schedules the open jobs that are due. Running jobs whose server stopped renewing
+// the claim, e.g. after a crash, start again.
+func (q *Queue) requeue() {
+	jobs, err := q.storage.OpenJobs()
+	if err != nil {
+		q.log.Error("Failed to get jobs", slog.String("error", err.Error()))
+		return
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if job.Status == models.JobStatusRunning {
+			if !q.recover(job.ID) {
+				continue
+			}
+			job.Status = models.JobStatusPending
+		}
+
+		if job.Status != models.JobStatusPending || job.RunAfter.After(now) {
+			continue
+		}
+
+		q.schedule(job.ID)
+	}
+}
+
+// recover sets a running job without claim back to pending, it reports true if it did
+func (q *Queue) recover(jobID uuid.UUID) bool {
+	claimed, err := q.storage.ClaimJob(jobID, claimTimeout)
+	if err != nil {
+		q.log.Error("Failed to claim job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		return false
+	}
+	if !claimed {
+		return false
+	}
+	defer q.release(jobID)
+
+	job, err := q.storage.Job(jobID)
+	if err != nil {
+		q.log.Error("Failed to get job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		return false
+	}
+	if job.Status != models.JobStatusRunning {
+		return false
+	}
+
+	q.log.Warn("Job was interrupted, run it again", slog.String("job", jobID.String()))
+	job.Status = models.JobStatusPending
+	if err := q.storage.InsertJob(job); err != nil {
+		q.log.Error("Failed to save job", slog.String("job", jobID.String()), slog.String("error", err.Error()))
+		return false
+	}
+
+	return true
+}
+
+// cleanup removes the originals of finished jobs once the retention period is over
+func (q *Queue) cleanup() {
+	if q.retention <= 0 {
+		return
+	}
+
+	jobs, err := q.storage.Jobs()
+	if err != nil {
+		q.log.Error("Failed to get jobs", slog.String("error", err.Error()))
+		return
+	}
+
+	now := time.Now()
+	for _, job := range jobs {
+		if job.Status != models.JobStatusDone && job.Status != models.JobStatusFailed {
+			continue
+		}
+		if job.Original == "" || now.Sub(job.CreatedAt) < q.retention {
+			continue
+		}
+
+		if err := q.storage.DeleteOriginal(job.Original); err != nil {
+			q.log.Error("Failed to delete original", slog.String("job", job.ID.String()), slog.String("error", err.Error()))
+			continue
+		}
+
+		job.Original = ""
+		if err := q.storage.InsertJob(job); err != nil {
+			q.log.Error("Failed to save job", slog.String("job", job.ID.String()), slog.String("error", err.Error()))
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/storage"
+)
+
+type testHandler struct {
+	calls  atomic.Int32
+	failed atomic.Int32
+	err    func(calls int32) error
+}
+
+func (h *testHandler) Process(ctx context.Context, job *models.Job) error {
+	return h.err(h.calls.Add(1))
+}
+
+func (h *testHandler) Failed(job *models.Job, err error) {
+	h.failed.Add(1)
+}
+
+func runJob(t *testing.T, handler *testHandler) *models.Job {
+	store := storage.NewStorage(t.TempDir())
+	queue := NewQueue(slog.Default(), store, handler, 1, 1, 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		queue.Wait()
+	}()
+	queue.Start(ctx)
+
+	job := &models.Job{ID: uuid.New()}
+	require.NoError(t, queue.Enqueue(job))
+
+	var stored *models.Job
+	require.Eventually(t, func() bool {
+		var err error
+		stored, err = store.Job(job.ID)
+		require.NoError(t, err)
+		if stored.Status == models.JobStatusPending && !stored.RunAfter.IsZero() {
+			// skip the retry delay
+			stored.RunAfter = time.Time{}
+			require.NoError(t, store.InsertJob(stored))
+		}
+		return stored.Status == models.JobStatusDone || stored.Status == models.JobStatusFailed
+	}, 10*time.Second, 10*time.Millisecond)
+
+	return stored
+}
+
+func TestQueueRetry(t *testing.T) {
+	t.Parallel()
+
+	handler := &testHandler{err: func(calls int32) error {
+		if calls < 2 {
+			return errors.New("busy")
+		}
+		return nil
+	}}
+
+	job := runJob(t, handler)
+	assert.Equal(t, models.JobStatusDone, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Zero(t, handler.failed.Load())
+}
+
+func TestQueuePermanent(t *testing.T) {
+	t.Parallel()
+
+	handler := &testHandler{err: func(calls int32) error {
+		return Permanent(errors.New("broken"))
+	}}
+
+	job := runJob(t, handler)
+	assert.Equal(t, models.JobStatusFailed, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.EqualValues(t, 1, handler.failed.Load())
+}
+
+func TestQueueReplicas(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	handler := &testHandler{err: func(calls int32) error {
+		close(started)
+		<-proceed
+		return nil
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queues := []*Queue{
+		NewQueue(slog.Default(), store, handler, 1, 1, 0),
+		NewQueue(slog.Default(), store, handler, 1, 1, 0),
+	}
+	defer func() {
+		cancel()
+		for _, queue := range queues {
+			queue.Wait()
+		}
+	}()
+
+	queues[0].Start(ctx)
+	job := &models.Job{ID: uuid.New()}
+	require.NoError(t, queues[0].Enqueue(job))
+	<-started
+
+	// a server starting while another runs the job leaves it alone
+	queues[1].Start(ctx)
+	queues[1].schedule(job.ID)
+	time.Sleep(2 * sweepInterval)
+	close(proceed)
+
+	require.Eventually(t, func() bool {
+		stored, err := store.Job(job.ID)
+		require.NoError(t, err)
+		return stored.Status == models.JobStatusDone
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, handler.calls.Load())
+}
+
+func TestQueueInterrupted(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := storage.NewStorage(dir)
+
+	// the server running the job crashed a while ago
+	job := &models.Job{ID: uuid.New(), Status: models.JobStatusRunning, Attempts: 1}
+	require.NoError(t, store.InsertJob(job))
+	claimed, err := store.ClaimJob(job.ID, claimTimeout)
+	require.NoError(t, err)
+	require.True(t, claimed)
+	crashed := time.Now().Add(-2 * claimTimeout)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "jobs", "claims", job.ID.String()), crashed, crashed))
+
+	handler := &testHandler{err: func(calls int32) error { return nil }}
+	queue := NewQueue(slog.Default(), store, handler, 1, 1, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		queue.Wait()
+	}()
+	queue.Start(ctx)
+
+	require.Eventually(t, func() bool {
+		stored, err := store.Job(job.ID)
+		require.NoError(t, err)
+		return stored.Status == models.JobStatusDone
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 1, handler.calls.Load())
+}
@@ -6,10 +6,41 @@ import (
 	"github.com/google/uuid"
 )
 
+// DuplicatePolicy decides what happens with uploads that look like a fish already in the aquarium
+type DuplicatePolicy string
+
+const (
+	DuplicatePolicyOff    DuplicatePolicy = ""
+	DuplicatePolicyFlag   DuplicatePolicy = "flag"
+	DuplicatePolicyReject DuplicatePolicy = "reject"
+	DuplicatePolicyMerge  DuplicatePolicy = "merge"
+)
+
+// NamePolicy limits the fish names shown on the screen
+type NamePolicy struct {
+	// MaxLength in characters, zero uses the default
+	MaxLength int `json:"max_length"`
+	// Deny and Allow extend the built-in German and English word lists
+	Deny  []string `json:"deny"`
+	Allow []string `json:"allow"`
+}
+
 type Aquarium struct {
 	ID uuid.UUID `json:"id"`
+	// Name is shown to visitors, e.g. on fish cards
+	Name string `json:"name"`
 
 	NeedApproval bool `json:"need_approval"`
+	// SplitFishes is the default upload mode: every drawing on a sheet becomes its own fish
+	SplitFishes bool `json:"split_fishes"`
+	// DuplicatePolicy flags, rejects or merges uploads of drawings already swimming
+	DuplicatePolicy DuplicatePolicy `json:"duplicate_policy"`
+	// NamePolicy cleans names, flagged names wait for approval
+	NamePolicy NamePolicy `json:"name_policy"`
+	// Wall splits the aquarium over several displays side by side, nil shows it on every display as a whole
+	Wall *Wall `json:"wall,omitempty"`
+	// Simulation moves the boids on the server, nil lets every display simulate on its own
+	Simulation *Simulation `json:"simulation,omitempty"`
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
@@ -0,0 +1,25 @@
+package models
+
+type Facing string
+
+const (
+	FacingLeft  Facing = "left"
+	FacingRight Facing = "right"
+)
+
+// FishAttributes describe the drawing of a fish, the frontend uses them to vary how it swims
+type FishAttributes struct {
+	// Colors are the dominant colors as hex, most common first
+	Colors []string `json:"colors"`
+	// Width and Height of the drawn part in pixels
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Area is the number of drawn pixels
+	Area int `json:"area"`
+	// AspectRatio is Width / Height
+	AspectRatio float64 `json:"aspect_ratio"`
+	// Complexity is between 0 for a circle and 1 for very ragged outlines
+	Complexity float64 `json:"complexity"`
+	// Facing is the side the head is on
+	Facing Facing `json:"facing"`
+}
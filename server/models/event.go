@@ -0,0 +1,153 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EventKind is the kind of an event sent to aquarium displays, it is used as SSE event name
+type EventKind string
+
+const (
+	EventFishJoin         EventKind = "fishjoin"
+	EventFishLeft         EventKind = "fishleft"
+	EventFishUpdate       EventKind = "fishupdate"
+	EventAquariumSettings EventKind = "aquariumsettings"
+	// EventFeed and EventFishTap are interactions of visitors
+	EventFeed    EventKind = "feed"
+	EventFishTap EventKind = "fishtap"
+	// EventViewerCommand is a command of a moderator for one connected viewer
+	EventViewerCommand EventKind = "viewercommand"
+	// EventFishHandoff moves a boid from one display of a wall to the next
+	EventFishHandoff EventKind = "fishhandoff"
+	// EventViewerPresence lists the viewers of one server, it is published on the ViewersTopic
+	EventViewerPresence EventKind = "viewerpresence"
+	// EventSimulationUpdate is a frame of the server simulation, it is published on the SimulationTopic
+	EventSimulationUpdate EventKind = "simulationupdate"
+)
+
+// Event is the envelope of everything published about an aquarium
+type Event struct {
+	Kind       EventKind `json:"kind"`
+	AquariumID uuid.UUID `json:"aquarium_id"`
+	// Fish is the payload of fish events
+	Fish *Fish `json:"fish,omitempty"`
+	// Aquarium is the payload of settings events
+	Aquarium *Aquarium `json:"aquarium,omitempty"`
+	// Interaction is the payload of interaction events
+	Interaction *Interaction `json:"interaction,omitempty"`
+	// Command is the payload of viewer commands
+	Command *ViewerCommand `json:"command,omitempty"`
+	// Handoff is the payload of hand-off events
+	Handoff *Handoff `json:"handoff,omitempty"`
+	// Presence is the payload of viewer presence events
+	Presence *ViewerPresence `json:"presence,omitempty"`
+	// SimulationUpdate is the payload of simulation updates
+	SimulationUpdate *SimulationUpdate `json:"simulation_update,omitempty"`
+	Timestamp        time.Time         `json:"timestamp"`
+	// Sequence numbers the events of an aquarium, it is set when the event is published
+	Sequence uint64 `json:"sequence"`
+}
+
+const aquariumTopicPrefix = "aquarium:"
+
+// AllAquariumsTopic is the pubsub topic pattern of the events of all aquariums
+const AllAquariumsTopic = aquariumTopicPrefix + "*"
+
+// AquariumTopic is the pubsub topic of all events of an aquarium
+func AquariumTopic(aquariumID uuid.UUID) string {
+	return aquariumTopicPrefix + aquariumID.String()
+}
+
+const viewersTopicPrefix = "viewers:"
+
+// AllViewersTopic is the pubsub topic pattern of the viewers of all aquariums
+const AllViewersTopic = viewersTopicPrefix + "*"
+
+// ViewersTopic is the pubsub topic of the viewers of an aquarium on all servers
+func ViewersTopic(aquariumID uuid.UUID) string {
+	return viewersTopicPrefix + aquariumID.String()
+}
+
+// InteractionTopic is the pubsub topic of the interactions and hand-offs of an aquarium. They are only
+// of use the moment they happen, resumed streams do not get them and they do not push the fish events
+// out of the replay log of the AquariumTopic.
+func InteractionTopic(aquariumID uuid.UUID) string {
+	return "interaction:" + aquariumID.String()
+}
+
+// SimulationTopic is the pubsub topic of the frames of the server simulation of an aquarium,
+// displays get them through the simulation of their server
+func SimulationTopic(aquariumID uuid.UUID) string {
+	return "simulation:" + aquariumID.String()
+}
+
+func NewFishEvent(kind EventKind, fish *Fish) Event {
+	return Event{
+		Kind:       kind,
+		AquariumID: fish.AquariumID,
+		Fish:       fish,
+		Timestamp:  time.Now(),
+	}
+}
+
+func NewAquariumEvent(aquarium *Aquarium) Event {
+	return Event{
+		Kind:       EventAquariumSettings,
+		AquariumID: aquarium.ID,
+		Aquarium:   aquarium,
+		Timestamp:  time.Now(),
+	}
+}
+
+func NewInteractionEvent(kind EventKind, aquariumID uuid.UUID, interaction *Interaction) Event {
+	return Event{
+		Kind:        kind,
+		AquariumID:  aquariumID,
+		Interaction: interaction,
+		Timestamp:   time.Now(),
+	}
+}
+
+func NewViewerCommandEvent(aquariumID uuid.UUID, command *ViewerCommand) Event {
+	return Event{
+		Kind:       EventViewerCommand,
+		AquariumID: aquariumID,
+		Command:    command,
+		Timestamp:  time.Now(),
+	}
+}
+
+func NewHandoffEvent(aquariumID uuid.UUID, handoff *Handoff) Event {
+	return Event{
+		Kind:       EventFishHandoff,
+		AquariumID: aquariumID,
+		Handoff:    handoff,
+		Timestamp:  time.Now(),
+	}
+}
+
+func NewViewerPresenceEvent(aquariumID uuid.UUID, presence *ViewerPresence) Event {
+	return Event{
+		Kind:       EventViewerPresence,
+		AquariumID: aquariumID,
+		Presence:   presence,
+		Timestamp:  time.Now(),
+	}
+}
+
+func NewSimulationEvent(aquariumID uuid.UUID, update *SimulationUpdate) Event {
+	return Event{
+		Kind:             EventSimulationUpdate,
+		AquariumID:       aquariumID,
+		SimulationUpdate: update,
+		Timestamp:        time.Now(),
+	}
+}
+
+// WithSequence implements pubsub.Sequenced
+func (e Event) WithSequence(seq uint64) Event {
+	e.Sequence = seq
+	return e
+}
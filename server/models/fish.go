@@ -6,14 +6,44 @@ import (
 	"github.com/google/uuid"
 )
 
+type FishStatus string
+
+const (
+	FishStatusProcessing FishStatus = "processing"
+	FishStatusFailed     FishStatus = "failed"
+	FishStatusReady      FishStatus = "ready"
+)
+
 type Fish struct {
-	ID         uuid.UUID `json:"id"`
-	AquariumID uuid.UUID `json:"aquarium_id"`
-	Filename   string    `json:"filename"`
-	Name       string    `json:"name"`
-	Approved   bool      `json:"approved"`
+	ID         uuid.UUID  `json:"id"`
+	AquariumID uuid.UUID  `json:"aquarium_id"`
+	UploadID   uuid.UUID  `json:"upload_id"`
+	Filename   string     `json:"filename"`
+	Name       string     `json:"name"`
+	Approved   bool       `json:"approved"`
+	Status     FishStatus `json:"status"`
+
+	Outline    *Outline        `json:"outline,omitempty"`
+	Attributes *FishAttributes `json:"attributes,omitempty"`
+	// Hash is the perceptual hash of the image, nil if not computed yet. Blank drawings hash to zero.
+	Hash *uint64 `json:"hash,omitempty,string"`
+	// NameFlagged is set if the name contains a denied word and waits for the moderator
+	NameFlagged bool `json:"name_flagged,omitempty"`
+	// DuplicateOf is set if the upload looked like this fish and was flagged for the moderator
+	DuplicateOf *uuid.UUID `json:"duplicate_of,omitempty"`
 
 	CreatedAt  time.Time  `json:"created_at"`
 	UpdatedAt  time.Time  `json:"updated_at"`
 	ApprovedAt *time.Time `json:"approved_at"`
 }
+
+// Ready reports if the image of the fish is processed. Fishes uploaded before processing jobs have no status.
+func (f *Fish) Ready() bool {
+	return f.Status == "" || f.Status == FishStatusReady
+}
+
+// Duplicate reports if the fish was flagged as duplicate and waits for the moderator
+func (f *Fish) Duplicate() bool {
+	// fishes stored before always have the field, the nil id means no duplicate
+	return f.DuplicateOf != nil && *f.DuplicateOf != uuid.Nil
+}
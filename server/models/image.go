@@ -0,0 +1,35 @@
+package models
+
+// ImageSize is a variant of the fish image
+type ImageSize string
+
+const (
+	ImageSizeThumb  ImageSize = "thumb"
+	ImageSizeMedium ImageSize = "medium"
+	ImageSizeFull   ImageSize = "full"
+)
+
+// ImageVariants are the sizes generated next to the full image
+var ImageVariants = []ImageSize{ImageSizeThumb, ImageSizeMedium}
+
+// ParseImageSize parses the size query parameter, empty is the full image
+func ParseImageSize(value string) (ImageSize, bool) {
+	switch ImageSize(value) {
+	case "", ImageSizeFull:
+		return ImageSizeFull, true
+	case ImageSizeThumb, ImageSizeMedium:
+		return ImageSize(value), true
+	}
+	return "", false
+}
+
+// MaxEdge is the longest edge of the variant in pixels, zero keeps the original size
+func (s ImageSize) MaxEdge() int {
+	switch s {
+	case ImageSizeThumb:
+		return 160
+	case ImageSizeMedium:
+		return 512
+	}
+	return 0
+}
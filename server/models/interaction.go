@@ -0,0 +1,11 @@
+package models
+
+import "github.com/google/uuid"
+
+// Interaction is something a visitor did in the aquarium, e.g. feeding or tapping a fish (FishID).
+// X and Y are relative to the aquarium, 0..1 from the top left corner.
+type Interaction struct {
+	FishID uuid.UUID `json:"fish_id"`
+	X      float64   `json:"x"`
+	Y      float64   `json:"y"`
+}
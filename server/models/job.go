@@ -0,0 +1,131 @@
+package models
+
+import (
+	"encoding/json"
+	"image"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JobStatus string
+
+const (
+	JobStatusPending JobStatus = "pending"
+	JobStatusRunning JobStatus = "running"
+	JobStatusDone    JobStatus = "done"
+	JobStatusFailed  JobStatus = "failed"
+)
+
+// ProcessSettings tune the image processing of an upload
+type ProcessSettings struct {
+	// Split overrides the aquarium split mode if set
+	Split *bool `json:"split,omitempty"`
+	// Threshold is the brightness between 0 and 1 above which a pixel counts as paper, zero uses the default
+	Threshold float64 `json:"threshold,omitempty"`
+	// Seeds are the points where the background removal starts, none starts in the top left corner
+	Seeds []image.Point `json:"seeds,omitempty"`
+	// Crop limits the processing to a part of the image, empty uses the whole image
+	Crop image.Rectangle `json:"crop"`
+}
+
+// Equal reports whether both settings process an upload the same way
+func (s ProcessSettings) Equal(other ProcessSettings) bool {
+	if (s.Split == nil) != (other.Split == nil) || (s.Split != nil && *s.Split != *other.Split) {
+		return false
+	}
+
+	return s.Threshold == other.Threshold && s.Crop == other.Crop && slices.Equal(s.Seeds, other.Seeds)
+}
+
+// Job processes one uploaded image into fishes
+type Job struct {
+	ID uuid.UUID `json:"id"`
+	// AquariumID is uuid.Nil until a template of an upload without aquarium is detected
+	AquariumID uuid.UUID `json:"aquarium_id"`
+	// Original is the filename of the stored upload
+	Original string `json:"original"`
+	Name     string `json:"name"`
+	// Settings tune the image processing, e.g. by a moderator
+	Settings ProcessSettings `json:"settings"`
+	// FishIDs are the fishes created by the job, the first one is created with the upload
+	FishIDs []uuid.UUID `json:"fish_ids"`
+	// Slots are the drawings of the upload the fishes of FishIDs were cut from, by their position on the sheet
+	Slots []int `json:"slots"`
+	// DeletedSlots are drawings whose fishes were deleted, reprocessing does not bring them back
+	DeletedSlots []int `json:"deleted_slots,omitempty"`
+	// Duplicates are existing fishes the upload was rejected or merged for
+	Duplicates []uuid.UUID `json:"duplicates,omitempty"`
+
+	Status   JobStatus `json:"status"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+	RunAfter time.Time `json:"run_after"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SlotFish returns the fish cut from the drawing slot
+func (j *Job) SlotFish(slot int) (uuid.UUID, bool) {
+	i := slices.Index(j.Slots, slot)
+	if i < 0 {
+		return uuid.Nil, false
+	}
+	return j.FishIDs[i], true
+}
+
+// Slot returns the drawing fishID was cut from
+func (j *Job) Slot(fishID uuid.UUID) (int, bool) {
+	i := slices.Index(j.FishIDs, fishID)
+	if i < 0 {
+		return 0, false
+	}
+	return j.Slots[i], true
+}
+
+// AddFish adds the fish cut from the drawing slot
+func (j *Job) AddFish(fishID uuid.UUID, slot int) {
+	j.FishIDs = append(j.FishIDs, fishID)
+	j.Slots = append(j.Slots, slot)
+}
+
+// DeleteFish removes the fish from the job, its drawing is skipped from now on
+func (j *Job) DeleteFish(fishID uuid.UUID) {
+	i := slices.Index(j.FishIDs, fishID)
+	if i < 0 {
+		return
+	}
+
+	j.DeletedSlots = append(j.DeletedSlots, j.Slots[i])
+	j.FishIDs = slices.Delete(j.FishIDs, i, i+1)
+	j.Slots = slices.Delete(j.Slots, i, i+1)
+}
+
+// UnmarshalJSON reads jobs stored before the processing settings, they kept the split mode in the top level field split.
+// Jobs stored before the slots cut their fishes in order.
+func (j *Job) UnmarshalJSON(data []byte) error {
+	type job Job
+	stored := struct {
+		*job
+		Split *bool `json:"split,omitempty"`
+	}{job: (*job)(j)}
+
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return err
+	}
+
+	if j.Settings.Split == nil {
+		j.Settings.Split = stored.Split
+	}
+
+	if len(j.Slots) != len(j.FishIDs) {
+		j.Slots = make([]int, len(j.FishIDs))
+		for i := range j.Slots {
+			j.Slots[i] = i
+		}
+	}
+
+	return nil
+}
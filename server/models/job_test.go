@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobLegacySplit(t *testing.T) {
+	t.Parallel()
+
+	job := Job{}
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"Wanda","split":false,"status":"done"}`), &job))
+	require.NotNil(t, job.Settings.Split)
+	assert.False(t, *job.Settings.Split)
+	assert.Equal(t, "Wanda", job.Name)
+	assert.Equal(t, JobStatusDone, job.Status)
+
+	// saved again the mode moves to the settings
+	data, err := json.Marshal(job)
+	require.NoError(t, err)
+	job = Job{}
+	require.NoError(t, json.Unmarshal(data, &job))
+	require.NotNil(t, job.Settings.Split)
+	assert.False(t, *job.Settings.Split)
+
+	job = Job{}
+	require.NoError(t, json.Unmarshal([]byte(`{"settings":{"threshold":0.5}}`), &job))
+	assert.Nil(t, job.Settings.Split)
+	assert.Equal(t, 0.5, job.Settings.Threshold)
+}
+
+func TestJobLegacySlots(t *testing.T) {
+	t.Parallel()
+
+	a, b := uuid.New(), uuid.New()
+	job := Job{}
+	require.NoError(t, json.Unmarshal([]byte(`{"fish_ids":["`+a.String()+`","`+b.String()+`"]}`), &job))
+	assert.Equal(t, []int{0, 1}, job.Slots)
+
+	job.DeleteFish(a)
+	assert.Equal(t, []uuid.UUID{b}, job.FishIDs)
+	assert.Equal(t, []int{1}, job.Slots)
+	assert.Equal(t, []int{0}, job.DeletedSlots)
+	fishID, ok := job.SlotFish(1)
+	assert.True(t, ok)
+	assert.Equal(t, b, fishID)
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"encoding/json"
+	"image"
+)
+
+type MaskStrokeMode string
+
+const (
+	MaskStrokeKeep   MaskStrokeMode = "keep"
+	MaskStrokeRemove MaskStrokeMode = "remove"
+)
+
+// MaskStroke is a brush stroke painted by a moderator on top of the automatic mask of a fish.
+// Points are in pixel coordinates of the fish image.
+type MaskStroke struct {
+	Mode   MaskStrokeMode `json:"mode"`
+	Width  float64        `json:"width"`
+	Points []image.Point  `json:"points"`
+}
+
+// FishMask are the strokes of a fish with the processing settings of the upload they were painted for.
+// Other settings cut the drawing differently, the strokes would land on the wrong pixels.
+type FishMask struct {
+	// Settings are nil for masks stored before the settings were recorded
+	Settings *ProcessSettings `json:"settings"`
+	Strokes  []MaskStroke     `json:"strokes"`
+}
+
+// UnmarshalJSON reads masks stored before the settings, they were only the list of strokes
+func (m *FishMask) UnmarshalJSON(data []byte) error {
+	var strokes []MaskStroke
+	if err := json.Unmarshal(data, &strokes); err == nil {
+		m.Settings = nil
+		m.Strokes = strokes
+		return nil
+	}
+
+	type mask FishMask
+	return json.Unmarshal(data, (*mask)(m))
+}
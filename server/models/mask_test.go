@@ -0,0 +1,39 @@
+package models
+
+import (
+	"encoding/json"
+	"image"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFishMaskLegacy(t *testing.T) {
+	t.Parallel()
+
+	mask := FishMask{}
+	require.NoError(t, json.Unmarshal([]byte(`[{"mode":"keep","width":4,"points":[{"X":1,"Y":2}]}]`), &mask))
+	assert.Nil(t, mask.Settings)
+	require.Len(t, mask.Strokes, 1)
+	assert.Equal(t, []image.Point{{1, 2}}, mask.Strokes[0].Points)
+
+	mask = FishMask{}
+	require.NoError(t, json.Unmarshal([]byte(`{"settings":{"threshold":0.5,"crop":{"Min":{"X":0,"Y":0},"Max":{"X":0,"Y":0}}},"strokes":[]}`), &mask))
+	require.NotNil(t, mask.Settings)
+	assert.Equal(t, 0.5, mask.Settings.Threshold)
+	assert.Empty(t, mask.Strokes)
+}
+
+func TestProcessSettingsEqual(t *testing.T) {
+	t.Parallel()
+
+	split, single := true, false
+	base := ProcessSettings{Split: &split, Threshold: 0.5, Seeds: []image.Point{{1, 2}}, Crop: image.Rect(0, 0, 10, 10)}
+
+	assert.True(t, base.Equal(ProcessSettings{Split: &split, Threshold: 0.5, Seeds: []image.Point{{1, 2}}, Crop: image.Rect(0, 0, 10, 10)}))
+	assert.False(t, base.Equal(ProcessSettings{Split: &single, Threshold: 0.5, Seeds: []image.Point{{1, 2}}, Crop: image.Rect(0, 0, 10, 10)}))
+	assert.False(t, base.Equal(ProcessSettings{Threshold: 0.5, Seeds: []image.Point{{1, 2}}, Crop: image.Rect(0, 0, 10, 10)}))
+	assert.False(t, base.Equal(ProcessSettings{Split: &split, Threshold: 0.5, Crop: image.Rect(0, 0, 10, 10)}))
+	assert.False(t, base.Equal(ProcessSettings{Split: &split, Threshold: 0.5, Seeds: []image.Point{{1, 2}}, Crop: image.Rect(0, 0, 20, 10)}))
+}
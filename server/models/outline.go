@@ -0,0 +1,9 @@
+package models
+
+// Outline is the simplified polygon around a fish, in pixels of the fish image.
+// The polygon is closed, the last point connects to the first.
+type Outline struct {
+	Width  int          `json:"width"`
+	Height int          `json:"height"`
+	Points [][2]float64 `json:"points"`
+}
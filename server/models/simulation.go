@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Simulation moves the boids of an aquarium on the server, all displays show the same positions
+type Simulation struct {
+	// Seed makes the simulation repeatable, the same seed and fishes swim the same way
+	Seed uint64 `json:"seed"`
+	// BoidsPerFish is the number of boids every fish swims with
+	BoidsPerFish int `json:"boids_per_fish"`
+}
+
+// SimulationKeyframe is the layout of the boids in the frames: the boids of the first fish come first, then the next.
+// It changes when fishes join or leave.
+type SimulationKeyframe struct {
+	Tick   uint64                `json:"tick"`
+	Fishes []SimulationFishBoids `json:"fishes"`
+	// Bounds of the positions in the frames
+	MinX float64 `json:"min_x"`
+	MinY float64 `json:"min_y"`
+	MaxX float64 `json:"max_x"`
+	MaxY float64 `json:"max_y"`
+}
+
+// SimulationFishBoids is the number of boids of a fish
+type SimulationFishBoids struct {
+	FishID uuid.UUID `json:"fish_id"`
+	Boids  int       `json:"boids"`
+}
+
+// SimulationFrame are the positions of all boids at a tick, Time is the server time in unix milliseconds.
+// Every boid is x, y and heading as little endian uint16: x and y from the bounds minimum (0) to
+// maximum (65535), heading from -π (0) to π (65535). JSON encodes Boids as base64.
+type SimulationFrame struct {
+	Tick  uint64 `json:"tick"`
+	Time  int64  `json:"time"`
+	Boids []byte `json:"boids"`
+}
+
+// SimulationUpdate is a frame of the simulation of an aquarium, sent by the server running it to all servers.
+// Keyframe is set when Layout changed and every second for servers that start listening.
+type SimulationUpdate struct {
+	// Runner is the simulation that sent the update, Since when it started to run
+	Runner uuid.UUID `json:"runner"`
+	Since  time.Time `json:"since"`
+	// Layout is the version of the keyframe of the runner
+	Layout   uint64              `json:"layout"`
+	Keyframe *SimulationKeyframe `json:"keyframe,omitempty"`
+	Frame    SimulationFrame     `json:"frame"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Viewer is a display or browser connected to a server
+type Viewer struct {
+	ID uuid.UUID `json:"id"`
+	// Transport is sse or ws
+	Transport   string    `json:"transport"`
+	UserAgent   string    `json:"user_agent"`
+	Display     string    `json:"display"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	ConnectedAt time.Time `json:"connected_at"`
+	LastPing    time.Time `json:"last_ping"`
+	// Slot is the wall slot the viewer shows, -1 if it shows the whole aquarium
+	Slot int `json:"slot"`
+	// ClaimedAt is when the viewer got its slot
+	ClaimedAt time.Time `json:"claimed_at"`
+	// AutoSlot is true if the viewer took the first free slot instead of asking for one
+	AutoSlot bool `json:"auto_slot"`
+}
+
+// ViewerPresence are the viewers of an aquarium connected to one server, it replaces the list the server sent before
+type ViewerPresence struct {
+	Server  uuid.UUID `json:"server"`
+	Viewers []Viewer  `json:"viewers"`
+	// Expires is when the list is outdated, servers stopping without goodbye are forgotten then
+	Expires time.Time `json:"expires"`
+}
+
+// ViewerAction is what a moderator wants a connected viewer to do
+type ViewerAction string
+
+const (
+	ViewerActionReload     ViewerAction = "reload"
+	ViewerActionDisconnect ViewerAction = "disconnect"
+)
+
+// ViewerCommand asks the viewer with ViewerID to run Action
+type ViewerCommand struct {
+	ViewerID uuid.UUID    `json:"viewer_id"`
+	Action   ViewerAction `json:"action"`
+}
+
+// ParseViewerAction parses an action name
+func ParseViewerAction(raw string) (ViewerAction, bool) {
+	switch action := ViewerAction(raw); action {
+	case ViewerActionReload, ViewerActionDisconnect:
+		return action, true
+	default:
+		return "", false
+	}
+}
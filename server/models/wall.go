@@ -0,0 +1,72 @@
+package models
+
+import "github.com/google/uuid"
+
+// Wall is a virtual canvas shown by several displays, every slot is the viewport of one display
+type Wall struct {
+	Width  int        `json:"width"`
+	Height int        `json:"height"`
+	Slots  []WallSlot `json:"slots"`
+}
+
+// WallSlot is a rectangle of the canvas in pixels
+type WallSlot struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// NewWall creates a wall of columns × rows slots of the same size, numbered row by row from the top left
+func NewWall(columns, rows, slotWidth, slotHeight int) *Wall {
+	wall := &Wall{
+		Width:  columns * slotWidth,
+		Height: rows * slotHeight,
+	}
+
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			wall.Slots = append(wall.Slots, WallSlot{
+				X:      column * slotWidth,
+				Y:      row * slotHeight,
+				Width:  slotWidth,
+				Height: slotHeight,
+			})
+		}
+	}
+
+	return wall
+}
+
+// Columns returns the number of slots in the first row
+func (w *Wall) Columns() int {
+	for i, slot := range w.Slots {
+		if slot.Y != 0 {
+			return i
+		}
+	}
+	return len(w.Slots)
+}
+
+// Rows returns the number of slot rows
+func (w *Wall) Rows() int {
+	if columns := w.Columns(); columns > 0 {
+		return len(w.Slots) / columns
+	}
+	return 0
+}
+
+// Handoff is a boid leaving the viewport of one display, the display showing X and Y takes it over.
+// X and Y are canvas pixels, VX and VY pixels per second and Time the server time in unix milliseconds.
+type Handoff struct {
+	FishID uuid.UUID `json:"fish_id"`
+	// Boid is the index of the boid of the fish
+	Boid int `json:"boid"`
+	// From is the slot the boid left
+	From int     `json:"from"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	VX   float64 `json:"vx"`
+	VY   float64 `json:"vy"`
+	Time int64   `json:"time"`
+}
@@ -0,0 +1,34 @@
+package names
+
+import (
+	"embed"
+	"strings"
+)
+
+//go:embed lists/*.txt
+var lists embed.FS
+
+var (
+	denyWords  = parseEntries(loadList("deny_de.txt", "deny_en.txt"))
+	allowWords = normalizeAll(loadList("allow_de.txt", "allow_en.txt"))
+)
+
+// loadList reads the built-in word lists, lines starting with # are comments
+func loadList(files ...string) []string {
+	words := []string{}
+	for _, file := range files {
+		raw, err := lists.ReadFile("lists/" + file)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, line := range strings.Split(string(raw), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			words = append(words, line)
+		}
+	}
+	return words
+}
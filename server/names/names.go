@@ -0,0 +1,239 @@
+// Package names cleans and moderates the fish names shown on public screens.
+package names
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/superbarne/fish/models"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// DefaultName is used for uploads without a name
+	DefaultName = "Boid"
+	// DefaultMaxLength is the maximum name length in characters if the aquarium sets none
+	DefaultMaxLength = 32
+	// maxCombining limits stacked accents
+	maxCombining = 2
+)
+
+// Moderate cleans name and reports if it contains a denied word
+func Moderate(name string, policy models.NamePolicy) (string, bool) {
+	name = Clean(name, policy.MaxLength)
+	_, flagged := Check(name, policy)
+	return name, flagged
+}
+
+// Clean normalizes name, strips invisible characters, collapses whitespace and
+// cuts it to maxLength characters. Empty names become DefaultName.
+func Clean(name string, maxLength int) string {
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLength
+	}
+
+	var b strings.Builder
+	space := false
+	combining := 0
+	for _, r := range norm.NFKC.String(name) {
+		switch {
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.In(r, unicode.Cc, unicode.Cf, unicode.Co, unicode.Cs):
+			// control, zero-width, direction overrides, private use
+			continue
+		case unicode.Is(unicode.Mn, r):
+			combining++
+			if combining > maxCombining {
+				continue
+			}
+		default:
+			combining = 0
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteRune(' ')
+		}
+		space = false
+		b.WriteRune(r)
+	}
+
+	cleaned := []rune(b.String())
+	if len(cleaned) > maxLength {
+		cleaned = cleaned[:maxLength]
+	}
+
+	name = strings.TrimSpace(string(cleaned))
+	if name == "" {
+		return DefaultName
+	}
+	return name
+}
+
+// Check reports the first denied word in name that is not part of an allowed word.
+// Names are matched word by word, so denied words never span two words of a name.
+func Check(name string, policy models.NamePolicy) (string, bool) {
+	deny := append(append([]entry{}, denyWords...), parseEntries(policy.Deny)...)
+	allow := append(append([]string{}, allowWords...), normalizeAll(policy.Allow)...)
+
+	for _, variant := range words(name) {
+		for _, entry := range deny {
+			if entry.word == "" {
+				continue
+			}
+			if variant == entry.word || entry.compound && denied(variant, entry.word, allow) {
+				return entry.word, true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// entry is a denied word, compound words also match inside longer words like "Arschgesicht"
+type entry struct {
+	word     string
+	compound bool
+}
+
+// parseEntry reads a line of a deny list, a trailing * marks a compound word
+func parseEntry(line string) entry {
+	compound := strings.HasSuffix(line, "*")
+	return entry{
+		word:     listWord(strings.TrimSuffix(line, "*")),
+		compound: compound,
+	}
+}
+
+func parseEntries(lines []string) []entry {
+	entries := make([]entry, 0, len(lines))
+	for _, line := range lines {
+		entries = append(entries, parseEntry(line))
+	}
+	return entries
+}
+
+// denied reports if word appears in name outside of all allowed words
+func denied(name, word string, allow []string) bool {
+	for start := 0; ; {
+		i := strings.Index(name[start:], word)
+		if i < 0 {
+			return false
+		}
+		i += start
+
+		if !covered(name, i, i+len(word), allow) {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+// covered reports if name[from:to] is inside an occurrence of an allowed word
+func covered(name string, from, to int, allow []string) bool {
+	for _, word := range allow {
+		for start := 0; ; {
+			i := strings.Index(name[start:], word)
+			if i < 0 || word == "" {
+				break
+			}
+			i += start
+
+			if i <= from && to <= i+len(word) {
+				return true
+			}
+			start = i + 1
+		}
+	}
+	return false
+}
+
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i', '€': 'e',
+}
+
+var umlauts = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// words returns the words of name that are matched against the word lists: lower case letters
+// only, leetspeak replaced and repeated letters collapsed. Runs of single letters are joined
+// ("f.u.c.k", "f u c k"). Every word comes once with umlauts spelled out and once without accents.
+func words(name string) []string {
+	name = strings.ToLower(norm.NFKC.String(name))
+
+	result := []string{}
+	for _, variant := range []string{umlauts.Replace(name), name} {
+		// split at everything that is no letter, invisible characters and accents are dropped
+		parts := strings.FieldsFunc(norm.NFD.String(variant), func(r rune) bool {
+			if _, ok := leetspeak[r]; ok {
+				return false
+			}
+			return !unicode.IsLetter(r) && !unicode.In(r, unicode.Mn, unicode.Cf)
+		})
+
+		var single strings.Builder
+		for _, part := range parts {
+			word := normalizeWord(part)
+			if utf8.RuneCountInString(word) == 1 {
+				single.WriteString(word)
+				continue
+			}
+			if single.Len() > 0 {
+				result = append(result, collapse(single.String()))
+				single.Reset()
+			}
+			if word != "" {
+				result = append(result, word)
+			}
+		}
+		if single.Len() > 0 {
+			result = append(result, collapse(single.String()))
+		}
+	}
+
+	return result
+}
+
+// normalizeWord returns the letters of word in lower case with leetspeak replaced,
+// accents removed and repeated letters collapsed
+func normalizeWord(word string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(strings.ToLower(norm.NFKC.String(word))) {
+		if replacement, ok := leetspeak[r]; ok {
+			r = replacement
+		}
+		if !unicode.IsLetter(r) || unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return collapse(b.String())
+}
+
+// collapse removes repeated letters, "fuuuck" becomes "fuck"
+func collapse(word string) string {
+	var b strings.Builder
+	var last rune
+	for _, r := range word {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+	return b.String()
+}
+
+// listWord normalizes a word of a list like the first spelling of a name
+func listWord(word string) string {
+	return normalizeWord(umlauts.Replace(strings.ToLower(word)))
+}
+
+func normalizeAll(words []string) []string {
+	normalized := make([]string, 0, len(words))
+	for _, word := range words {
+		normalized = append(normalized, listWord(word))
+	}
+	return normalized
+}
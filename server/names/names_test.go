@@ -0,0 +1,122 @@
+package names
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/superbarne/fish/models"
+)
+
+func TestClean(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		name      string
+		maxLength int
+		want      string
+	}{
+		"empty":          {name: "", want: DefaultName},
+		"only invisible": {name: "\u200b\u200d \t", want: DefaultName},
+		"whitespace":     {name: "  Nemo \n\t der   Fisch ", want: "Nemo der Fisch"},
+		"zero width":     {name: "Ne\u200bmo\ufeff", want: "Nemo"},
+		"control":        {name: "Ne\x00mo\x1b[31m", want: "Nemo[31m"},
+		"bidi override":  {name: "\u202eomeN", want: "omeN"},
+		"full width":     {name: "Ｎｅｍｏ", want: "Nemo"},
+		"zalgo":          {name: "Ne\u0301\u0302\u0303\u0304mo", want: "N\u00e9\u0302\u0303mo"},
+		"max length":     {name: "Wanda die Wunderbare", maxLength: 10, want: "Wanda die"},
+		"default length": {name: "abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz", want: "abcdefghijklmnopqrstuvwxyzabcdef"},
+		"emoji":          {name: "Blubb 🐟", want: "Blubb 🐟"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, Clean(tt.name, tt.maxLength))
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]bool{
+		"Nemo":                false,
+		"Fritz der Barsch":    false,
+		"Heilbutt":            false,
+		"Schwanzflosse":       false,
+		"Peacock":             false,
+		"Shiitake":            false,
+		"Arsch":               true,
+		"Scheiße":             true,
+		"SCH31SS3":            true,
+		"f.u.c.k":             true,
+		"fuuuuuck":            true,
+		"sh1t":                true,
+		"Barsch Arsch":        true,
+		"Fück":                true,
+		"Ｆｕｃｋ":                true,
+		"f\u200buck":          true,
+		"Kleiner Flussbarsch": false,
+		"f u c k":             true,
+		"Arschgesicht":        true,
+		"Hurensohn":           true,
+		"Bullshit Bob":        true,
+		"Sex":                 true,
+		"Nazi Fisch":          true,
+		// denied words never span two words, only compound words match inside longer words
+		"Lars Christian": false,
+		"Anna Zischke":   false,
+		"Hans Exner":     false,
+		"Mathis Exler":   false,
+		"Cocktail":       false,
+		"Hitchcock":      false,
+		"Pennerfisch":    false,
+		"Essex Fisch":    false,
+		"Ignazio":        false,
+		"A. B. Schmidt":  false,
+	}
+
+	for name, flagged := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, got := Check(name, models.NamePolicy{})
+			assert.Equal(t, flagged, got)
+		})
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy := models.NamePolicy{
+		Deny:  []string{"Blubb"},
+		Allow: []string{"Arschbombe"},
+	}
+
+	_, flagged := Check("Bl00bb", policy)
+	assert.False(t, flagged)
+	word, flagged := Check("BLUBB", policy)
+	assert.True(t, flagged)
+	assert.Equal(t, "blub", word)
+
+	_, flagged = Check("Arschbombe", policy)
+	assert.False(t, flagged)
+
+	// own words match whole words, a trailing * inside longer words too
+	_, flagged = Check("Blubbfisch", policy)
+	assert.False(t, flagged)
+	_, flagged = Check("Blubbfisch", models.NamePolicy{Deny: []string{"Blubb*"}})
+	assert.True(t, flagged)
+}
+
+func TestModerate(t *testing.T) {
+	t.Parallel()
+
+	name, flagged := Moderate(" Sch\u200beiße ", models.NamePolicy{MaxLength: 5})
+	assert.Equal(t, "Schei", name)
+	assert.False(t, flagged)
+
+	name, flagged = Moderate(" Sch\u200beiße ", models.NamePolicy{})
+	assert.Equal(t, "Scheiße", name)
+	assert.True(t, flagged)
+}
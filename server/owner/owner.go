@@ -0,0 +1,94 @@
+// Package owner issues the ownership tokens of uploads. The holder of a token may rename, remove
+// and re-upload the fishes of the upload until the token expires.
+package owner
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultWindow is how long uploaders may change their fishes
+const DefaultWindow = 24 * time.Hour
+
+var (
+	ErrInvalidToken = errors.New("invalid ownership token")
+	ErrExpired      = errors.New("ownership token expired")
+)
+
+// token layout: job id, expiry in unix seconds, HMAC-SHA256 of both
+const (
+	idSize      = 16
+	expirySize  = 8
+	payloadSize = idSize + expirySize
+	tokenSize   = payloadSize + sha256.Size
+)
+
+// Signer signs and verifies ownership tokens with a server secret
+type Signer struct {
+	secret []byte
+	window time.Duration
+}
+
+func NewSigner(secret []byte, window time.Duration) *Signer {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	return &Signer{
+		secret: secret,
+		window: window,
+	}
+}
+
+// Window is how long a token is valid after it was issued
+func (s *Signer) Window() time.Duration {
+	return s.window
+}
+
+// Issue returns a token for the upload jobID, it expires after the window
+func (s *Signer) Issue(jobID uuid.UUID, now time.Time) (string, time.Time) {
+	expires := now.Add(s.window).Truncate(time.Second)
+
+	raw := make([]byte, payloadSize, tokenSize)
+	copy(raw, jobID[:])
+	binary.BigEndian.PutUint64(raw[idSize:], uint64(expires.Unix()))
+	raw = append(raw, s.sign(raw)...)
+
+	return base64.RawURLEncoding.EncodeToString(raw), expires
+}
+
+// Verify returns the upload and expiry of token. Expired tokens return ErrExpired with both set.
+func (s *Signer) Verify(token string, now time.Time) (uuid.UUID, time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(raw) != tokenSize {
+		return uuid.Nil, time.Time{}, ErrInvalidToken
+	}
+
+	if !hmac.Equal(raw[payloadSize:], s.sign(raw[:payloadSize])) {
+		return uuid.Nil, time.Time{}, ErrInvalidToken
+	}
+
+	jobID, err := uuid.FromBytes(raw[:idSize])
+	if err != nil {
+		return uuid.Nil, time.Time{}, ErrInvalidToken
+	}
+	expires := time.Unix(int64(binary.BigEndian.Uint64(raw[idSize:payloadSize])), 0)
+
+	if !now.Before(expires) {
+		return jobID, expires, ErrExpired
+	}
+
+	return jobID, expires, nil
+}
+
+func (s *Signer) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
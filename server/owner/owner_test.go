@@ -0,0 +1,51 @@
+package owner
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigner(t *testing.T) {
+	t.Parallel()
+
+	signer := NewSigner([]byte("secret"), time.Hour)
+	jobID := uuid.New()
+	now := time.Now()
+
+	token, expires := signer.Issue(jobID, now)
+	assert.WithinDuration(t, now.Add(time.Hour), expires, time.Second)
+
+	got, gotExpires, err := signer.Verify(token, now)
+	require.NoError(t, err)
+	assert.Equal(t, jobID, got)
+	assert.True(t, expires.Equal(gotExpires))
+
+	// two uploads never share a token
+	other, _ := signer.Issue(uuid.New(), now)
+	assert.NotEqual(t, token, other)
+
+	// after the window the upload is known, but the token does not allow changes anymore
+	got, _, err = signer.Verify(token, now.Add(time.Hour+time.Second))
+	assert.ErrorIs(t, err, ErrExpired)
+	assert.Equal(t, jobID, got)
+
+	// another secret, a changed upload or garbage are rejected
+	_, _, err = NewSigner([]byte("other"), time.Hour).Verify(token, now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	require.NoError(t, err)
+	raw[0] ^= 1
+	_, _, err = signer.Verify(base64.RawURLEncoding.EncodeToString(raw), now)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	for _, token := range []string{"", "abc", "!!!!", token[:len(token)-2]} {
+		_, _, err = signer.Verify(token, now)
+		assert.ErrorIs(t, err, ErrInvalidToken, token)
+	}
+}
@@ -0,0 +1,14 @@
+package pubsub
+
+import "context"
+
+// Broker delivers published messages to the subscribers of a topic.
+// PubSub delivers within the process, NATS across server replicas.
+type Broker[T Sequenced[T]] interface {
+	Publish(topic string, msg T)
+	Subscribe(topic string, ctx context.Context, bufferSize int) *Subscription[T]
+	// LastSequence and Since are the replay log of the subscribers of this process
+	LastSequence(topic string) uint64
+	Since(topic string, seq uint64) ([]T, bool)
+	Close()
+}
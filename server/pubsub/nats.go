@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATS is a Broker for more server replicas, e.g. behind a load balancer. Messages are
+// published to a NATS server as JSON and every replica delivers them to its own subscribers.
+// Sequences and replay logs are per replica, event ids of another replica need a snapshot.
+type NATS[T Sequenced[T]] struct {
+	// PubSub delivers the received messages in this process
+	*PubSub[T]
+
+	log    *slog.Logger
+	conn   *nats.Conn
+	sub    *nats.Subscription
+	prefix string
+}
+
+// NewNATS connects to the NATS server at url and delivers the messages through ps.
+// Topics are published as subject <subject>.<topic>, they must not contain whitespace.
+func NewNATS[T Sequenced[T]](log *slog.Logger, ps *PubSub[T], url string, subject string) (*NATS[T], error) {
+	conn, err := nats.Connect(url, nats.Name("fish"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, err
+	}
+
+	n := &NATS[T]{
+		PubSub: ps,
+		log:    log,
+		conn:   conn,
+		prefix: subject + ".",
+	}
+
+	// the own messages come back from the server like the ones of other replicas
+	if n.sub, err = conn.Subscribe(n.prefix+">", n.receive); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// the subscription is known to the server before the first publish
+	if err := conn.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Publish sends msg to all replicas. It is delivered asynchronously, even in this process.
+func (n *NATS[T]) Publish(topic string, msg T) {
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		n.log.Error("Failed to encode message", slog.String("topic", topic), slog.String("error", err.Error()))
+		return
+	}
+
+	if err := n.conn.Publish(n.prefix+topic, raw); err != nil {
+		n.log.Error("Failed to publish message", slog.String("topic", topic), slog.String("error", err.Error()))
+	}
+}
+
+func (n *NATS[T]) receive(m *nats.Msg) {
+	var msg T
+	if err := json.Unmarshal(m.Data, &msg); err != nil {
+		n.log.Error("Failed to decode message", slog.String("subject", m.Subject), slog.String("error", err.Error()))
+		return
+	}
+
+	n.PubSub.Publish(strings.TrimPrefix(m.Subject, n.prefix), msg)
+}
+
+// Close sends the pending messages, disconnects and closes the subscriptions of this process
+func (n *NATS[T]) Close() {
+	if err := n.conn.Flush(); err != nil && !n.conn.IsClosed() {
+		n.log.Error("Failed to flush messages", slog.String("error", err.Error()))
+	}
+	n.conn.Close()
+	n.PubSub.Close()
+}
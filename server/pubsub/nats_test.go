@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/pubsub/natstest"
+)
+
+var (
+	_ Broker[message] = (*PubSub[message])(nil)
+	_ Broker[message] = (*NATS[message])(nil)
+)
+
+// receive waits for the next message of sub
+func receive(t *testing.T, sub *Subscription[message]) message {
+	t.Helper()
+
+	select {
+	case msg, ok := <-sub.C:
+		require.True(t, ok, "channel should be open")
+		return msg
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "no message received")
+		return message{}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	t.Parallel()
+
+	url := natstest.Server(t)
+
+	// two replicas
+	a, err := NewNATS(slog.Default(), NewPubSub[message](), url, "test")
+	require.NoError(t, err)
+	defer a.Close()
+	b, err := NewNATS(slog.Default(), NewPubSub[message](), url, "test")
+	require.NoError(t, err)
+	defer b.Close()
+
+	ctx := context.Background()
+	subA := a.Subscribe("aquarium:a", ctx, 10)
+	subB := b.Subscribe("aquarium:a", ctx, 10)
+	allB := b.Subscribe("aquarium:*", ctx, 10)
+	otherB := b.Subscribe("aquarium:b", ctx, 10)
+
+	// messages of one replica reach the subscribers of all replicas, numbered by each replica
+	a.Publish("aquarium:a", message{Body: "join"})
+	assert.Equal(t, message{Body: "join", Sequence: 1}, receive(t, subA))
+	assert.Equal(t, message{Body: "join", Sequence: 1}, receive(t, subB))
+	assert.Equal(t, message{Body: "join", Sequence: 1}, receive(t, allB))
+
+	b.Publish("aquarium:a", message{Body: "left"})
+	assert.Equal(t, message{Body: "left", Sequence: 2}, receive(t, subA))
+	assert.Equal(t, message{Body: "left", Sequence: 2}, receive(t, subB))
+	assert.Equal(t, message{Body: "left", Sequence: 2}, receive(t, allB))
+
+	// replay logs are per replica
+	messages, ok := b.Since("aquarium:a", 1)
+	assert.True(t, ok)
+	assert.Equal(t, []message{{Body: "left", Sequence: 2}}, messages)
+
+	assert.Empty(t, otherB.C)
+
+	// close ends the subscriptions of the replica only
+	b.Close()
+	_, ok = <-subB.C
+	assert.False(t, ok, "channel should be closed")
+
+	a.Publish("aquarium:a", message{Body: "update"})
+	assert.Equal(t, "update", receive(t, subA).Body)
+}
+
+func TestNATSConnect(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewNATS(slog.Default(), NewPubSub[message](), "nats://127.0.0.1:1", "test")
+	assert.Error(t, err)
+}
@@ -0,0 +1,33 @@
+// Package natstest runs an embedded NATS server for tests
+package natstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// Server starts a NATS server on a random local port, stops it when the test ends and returns its url
+func Server(t testing.TB) string {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{
+		Host:   "127.0.0.1",
+		Port:   server.RANDOM_PORT,
+		NoLog:  true,
+		NoSigs: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create NATS server: %v", err)
+	}
+
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server did not start")
+	}
+
+	return s.ClientURL()
+}
@@ -0,0 +1,34 @@
+package pubsub
+
+import (
+	"fmt"
+	"time"
+)
+
+// OverflowPolicy decides what Publish does when the buffer of a subscriber is full
+type OverflowPolicy string
+
+const (
+	// DropOldest drops the oldest buffered message to make room for the new one
+	DropOldest OverflowPolicy = "drop-oldest"
+	// Disconnect closes the channel of the subscriber, it has to subscribe again and resync
+	Disconnect OverflowPolicy = "disconnect"
+	// Block waits for the subscriber until the block timeout and drops the message then.
+	// Publishers of all topics wait meanwhile.
+	Block OverflowPolicy = "block"
+)
+
+// DefaultBlockTimeout is the block timeout of new PubSubs
+const DefaultBlockTimeout = 100 * time.Millisecond
+
+// ParseOverflowPolicy parses a policy name, empty is DropOldest
+func ParseOverflowPolicy(raw string) (OverflowPolicy, error) {
+	switch policy := OverflowPolicy(raw); policy {
+	case "":
+		return DropOldest, nil
+	case DropOldest, Disconnect, Block:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown overflow policy %q", raw)
+	}
+}
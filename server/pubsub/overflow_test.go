@@ -0,0 +1,103 @@
+package pubsub
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverflowDropOldest(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+
+	ctx := context.Background()
+	sub := ps.Subscribe("topic", ctx, 2)
+	ch := sub.C
+
+	for _, body := range []string{"a", "b", "c", "d"} {
+		ps.Publish("topic", message{Body: body})
+	}
+
+	// the latest messages are kept
+	assert.Equal(t, "c", (<-ch).Body)
+	assert.Equal(t, "d", (<-ch).Body)
+	assert.Equal(t, uint64(2), sub.Dropped())
+}
+
+func TestOverflowDisconnect(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+	ps.SetOverflow(Disconnect, 0)
+
+	ctx := context.Background()
+	sub := ps.Subscribe("topic", ctx, 1)
+	ch := sub.C
+
+	ps.Publish("topic", message{Body: "a"})
+	ps.Publish("topic", message{Body: "b"})
+	ps.Publish("topic", message{Body: "c"})
+
+	// buffered messages are delivered before the channel ends
+	assert.Equal(t, "a", (<-ch).Body)
+	_, ok := <-ch
+	assert.False(t, ok, "channel should be closed")
+	assert.Equal(t, uint64(1), sub.Dropped())
+
+	// unsubscribe does not close it twice
+	sub.Close()
+	assert.Equal(t, uint64(1), sub.Dropped())
+
+	// a new subscription starts over
+	sub = ps.Subscribe("topic", ctx, 1)
+	ch = sub.C
+	assert.Equal(t, uint64(0), sub.Dropped())
+	ps.Publish("topic", message{Body: "d"})
+	assert.Equal(t, "d", (<-ch).Body)
+}
+
+func TestOverflowBlock(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+	ps.SetOverflow(Block, 50*time.Millisecond)
+
+	ctx := context.Background()
+	sub := ps.Subscribe("topic", ctx, 1)
+	ch := sub.C
+	ps.Publish("topic", message{Body: "a"})
+
+	// a subscriber catching up in time gets everything
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	ps.Publish("topic", message{Body: "b"})
+	assert.Equal(t, uint64(0), sub.Dropped())
+
+	// a stuck subscriber loses the message after the timeout
+	start := time.Now()
+	ps.Publish("topic", message{Body: "c"})
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, uint64(1), sub.Dropped())
+	assert.Equal(t, "b", (<-ch).Body)
+}
+
+func TestParseOverflowPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := ParseOverflowPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, DropOldest, policy)
+
+	policy, err = ParseOverflowPolicy("block")
+	require.NoError(t, err)
+	assert.Equal(t, Block, policy)
+
+	_, err = ParseOverflowPolicy("never")
+	assert.Error(t, err)
+}
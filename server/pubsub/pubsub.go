@@ -2,88 +2,198 @@ package pubsub
 
 import (
 	"context"
+	"strings"
 	"sync"
+	"time"
 )
 
-type PubSub struct {
+// Sequenced messages are numbered when they are published
+type Sequenced[T any] interface {
+	// WithSequence returns a copy of the message with its position in the topic
+	WithSequence(seq uint64) T
+}
+
+type PubSub[T Sequenced[T]] struct {
 	lock sync.Mutex
 
-	subs map[string]map[context.Context]chan interface{}
+	// subs are the subscriptions by topic, patterns the prefix subscriptions by prefix
+	subs     map[string]map[uint64]*Subscription[T]
+	patterns map[string]map[uint64]*Subscription[T]
+	lastID   uint64
+
+	// replays are the logs of the latest messages by topic
+	replays map[string]*replay[T]
+
+	overflow     OverflowPolicy
+	blockTimeout time.Duration
 
 	closed bool
 }
 
-func NewPubSub() *PubSub {
-	return &PubSub{
-		subs: make(map[string]map[context.Context]chan interface{}),
+func NewPubSub[T Sequenced[T]]() *PubSub[T] {
+	return &PubSub[T]{
+		subs:         make(map[string]map[uint64]*Subscription[T]),
+		patterns:     make(map[string]map[uint64]*Subscription[T]),
+		replays:      make(map[string]*replay[T]),
+		overflow:     DropOldest,
+		blockTimeout: DefaultBlockTimeout,
 	}
 }
 
-func (ps *PubSub) Publish(topic string, msg interface{}) {
+// SetOverflow sets what Publish does when the buffer of a subscriber is full.
+// timeout is the longest time Publish waits for subscribers with the Block policy.
+func (ps *PubSub[T]) SetOverflow(policy OverflowPolicy, timeout time.Duration) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.overflow = policy
+	ps.blockTimeout = timeout
+}
+
+// Publish numbers msg in the replay log of topic and sends it to all subscribers
+func (ps *PubSub[T]) Publish(topic string, msg T) {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
 
+	msg = ps.record(topic, msg)
+
 	if ps.closed {
 		return
 	}
 
-	if _, ok := ps.subs[topic]; !ok {
-		ps.subs[topic] = make(map[context.Context]chan interface{})
+	// all blocked subscribers share one timeout
+	deadline := time.Now().Add(ps.blockTimeout)
+
+	send := func(subs map[uint64]*Subscription[T]) {
+		for _, sub := range subs {
+			if sub.disconnected {
+				continue
+			}
+
+			select {
+			case sub.ch <- msg:
+				continue
+			default:
+			}
+
+			ps.overflowed(sub, msg, deadline)
+		}
 	}
 
-	for _, ch := range ps.subs[topic] {
+	send(ps.subs[topic])
+	for prefix, subs := range ps.patterns {
+		if strings.HasPrefix(topic, prefix) {
+			send(subs)
+		}
+	}
+}
+
+// overflowed applies the overflow policy to a subscriber with a full buffer, the lock must be held
+func (ps *PubSub[T]) overflowed(sub *Subscription[T], msg T, deadline time.Time) {
+	switch ps.overflow {
+	case DropOldest:
+		select {
+		case <-sub.ch:
+		default:
+		}
 		select {
-		case ch <- msg:
+		case sub.ch <- msg:
 		default:
 		}
+		sub.dropped++
+	case Disconnect:
+		sub.dropped++
+		sub.disconnected = true
+		close(sub.ch)
+	case Block:
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+
+		select {
+		case sub.ch <- msg:
+		case <-timer.C:
+			sub.dropped++
+		}
+	default:
+		sub.dropped++
 	}
 }
 
-func (ps *PubSub) Subscribe(topic string, ctx context.Context, bufferSize int) <-chan interface{} {
+// Subscribe returns a subscription to the messages of topic. A topic ending with * subscribes
+// to all topics starting with the rest, e.g. aquarium:*. The subscription ends with Close or
+// when ctx is done. After Close of the PubSub the channel is closed right away.
+func (ps *PubSub[T]) Subscribe(topic string, ctx context.Context, bufferSize int) *Subscription[T] {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
 
+	ps.lastID++
+	ch := make(chan T, bufferSize)
+	sub := &Subscription[T]{
+		ID:    ps.lastID,
+		Topic: topic,
+		C:     ch,
+		ps:    ps,
+		ch:    ch,
+	}
+
 	if ps.closed {
-		return nil
+		sub.closed = true
+		close(ch)
+		return sub
 	}
 
-	if _, ok := ps.subs[topic]; !ok {
-		ps.subs[topic] = make(map[context.Context]chan interface{})
+	subs := ps.subs
+	if prefix, ok := strings.CutSuffix(topic, Wildcard); ok {
+		subs, topic = ps.patterns, prefix
+	}
+	if _, ok := subs[topic]; !ok {
+		subs[topic] = make(map[uint64]*Subscription[T])
 	}
+	subs[topic][sub.ID] = sub
 
-	ch := make(chan interface{}, bufferSize)
-	ps.subs[topic][ctx] = ch
+	sub.stop = context.AfterFunc(ctx, sub.Close)
 
-	return ch
+	return sub
 }
 
-func (ps *PubSub) Unsubscribe(topic string, ctx context.Context) {
-	ps.lock.Lock()
-	defer ps.lock.Unlock()
-
-	if ps.closed {
+// unsubscribe removes sub and closes its channel, the lock must be held
+func (ps *PubSub[T]) unsubscribe(sub *Subscription[T]) {
+	if sub.closed {
 		return
 	}
+	sub.closed = true
 
-	if _, ok := ps.subs[topic]; !ok {
-		return
+	if !sub.disconnected {
+		close(sub.ch)
 	}
 
-	if _, ok := ps.subs[topic][ctx]; ok {
-		close(ps.subs[topic][ctx])
+	subs, topic := ps.subs, sub.Topic
+	if prefix, ok := strings.CutSuffix(topic, Wildcard); ok {
+		subs, topic = ps.patterns, prefix
+	}
+	delete(subs[topic], sub.ID)
+	if len(subs[topic]) == 0 {
+		delete(subs, topic)
 	}
-
-	delete(ps.subs[topic], ctx)
 }
 
-func (ps *PubSub) Close() {
+// Close closes the channels of all subscriptions and removes them, buffered messages can still be read.
+// Publish, Subscribe and Subscription.Close are safe after Close, Close can be called more than once.
+func (ps *PubSub[T]) Close() {
 	ps.lock.Lock()
 	defer ps.lock.Unlock()
+
+	if ps.closed {
+		return
+	}
 	ps.closed = true
 
-	for _, m := range ps.subs {
-		for _, ch := range m {
-			close(ch)
+	for _, subs := range []map[string]map[uint64]*Subscription[T]{ps.subs, ps.patterns} {
+		for _, m := range subs {
+			for _, sub := range m {
+				sub.stop()
+				ps.unsubscribe(sub)
+			}
 		}
 	}
 }
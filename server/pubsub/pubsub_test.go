@@ -2,32 +2,255 @@ package pubsub
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
 
+// message is a minimal Sequenced message for tests
+type message struct {
+	Body     string
+	Sequence uint64
+}
+
+func (m message) WithSequence(seq uint64) message {
+	m.Sequence = seq
+	return m
+}
+
 func TestPubSub(t *testing.T) {
 	t.Parallel()
 
-	ps := NewPubSub()
+	ps := NewPubSub[message]()
 
 	ctx := context.Background()
-	ch := ps.Subscribe("topic", ctx, 10)
-	assert.NotNil(t, ch)
+	sub := ps.Subscribe("topic", ctx, 10)
+	assert.NotNil(t, sub.C)
+
+	// one context can hold more subscriptions of a topic
+	other := ps.Subscribe("topic", ctx, 10)
+	assert.NotEqual(t, sub.ID, other.ID)
 
-	ps.Publish("topic", "msg")
-	msg, ok := <-ch
+	ps.Publish("topic", message{Body: "msg"})
+	msg, ok := <-sub.C
 	assert.True(t, ok)
-	assert.Equal(t, "msg", msg)
+	assert.Equal(t, message{Body: "msg", Sequence: 1}, msg)
+	assert.Equal(t, msg, <-other.C)
 
 	// unsubscribe
-	ps.Unsubscribe("topic", ctx)
-	assert.Nil(t, ps.subs["topic"][ctx])
+	sub.Close()
+	assert.Nil(t, ps.subs["topic"][sub.ID])
+	assert.NotNil(t, ps.subs["topic"][other.ID])
+
+	_, ok = <-sub.C
+	assert.False(t, ok, "channel should be closed")
+
+	// closing twice is fine
+	sub.Close()
+	other.Close()
+	assert.Empty(t, ps.subs)
+
+	ps.Publish("topic", message{Body: "msg2"})
+}
+
+func TestSubscriptionContext(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := ps.Subscribe("topic", ctx, 10)
+
+	// the subscription ends with the context
+	cancel()
+	_, ok := <-sub.C
+	assert.False(t, ok, "channel should be closed")
+
+	ps.lock.Lock()
+	assert.Empty(t, ps.subs)
+	ps.lock.Unlock()
+
+	// contexts that are done already end the subscription right away
+	sub = ps.Subscribe("topic", ctx, 10)
+	_, ok = <-sub.C
+	assert.False(t, ok, "channel should be closed")
+}
 
+func TestSubscriptionWildcard(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+
+	ctx := context.Background()
+	all := ps.Subscribe("aquarium:*", ctx, 10)
+	one := ps.Subscribe("aquarium:a", ctx, 10)
+
+	ps.Publish("aquarium:a", message{Body: "a"})
+	ps.Publish("aquarium:b", message{Body: "b"})
+	ps.Publish("other", message{Body: "other"})
+
+	assert.Equal(t, "a", (<-all.C).Body)
+	assert.Equal(t, "b", (<-all.C).Body)
+	assert.Equal(t, "a", (<-one.C).Body)
+	assert.Empty(t, all.C)
+	assert.Empty(t, one.C)
+
+	all.Close()
+	assert.Empty(t, ps.patterns)
+	ps.Publish("aquarium:c", message{Body: "c"})
+	_, ok := <-all.C
+	assert.False(t, ok, "channel should be closed")
+}
+
+func TestPubSubClose(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+
+	ctx := context.Background()
+	sub := ps.Subscribe("topic", ctx, 10)
+	all := ps.Subscribe("*", ctx, 10)
+	ps.Publish("topic", message{Body: "msg"})
+
+	ps.Close()
+	assert.Empty(t, ps.subs)
+	assert.Empty(t, ps.patterns)
+	_, ok := <-all.C
+	assert.True(t, ok)
+	ch := sub.C
+
+	// buffered messages are still delivered, then the channel ends
+	assert.Equal(t, "msg", (<-ch).Body)
 	_, ok = <-ch
 	assert.False(t, ok, "channel should be closed")
-	assert.Nil(t, ps.subs["topic"][ctx])
 
-	ps.Publish("topic", "msg2")
+	// everything is safe after close
+	ps.Close()
+	sub.Close()
+	ps.Publish("topic", message{Body: "msg2"})
+
+	_, ok = <-ps.Subscribe("topic", ctx, 10).C
+	assert.False(t, ok, "subscriptions after close should be closed")
+	assert.Empty(t, ps.subs)
+}
+
+func TestPubSubConcurrent(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []OverflowPolicy{DropOldest, Disconnect, Block} {
+		ps := NewPubSub[message]()
+		ps.SetOverflow(policy, time.Millisecond)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(2)
+
+			// slow subscribers that come and go
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 20; j++ {
+					ctx, cancel := context.WithCancel(context.Background())
+					sub := ps.Subscribe("topic", ctx, 1)
+					all := ps.Subscribe("*", ctx, 1)
+					for range 3 {
+						<-sub.C
+						<-all.C
+					}
+					sub.Dropped()
+					sub.Close()
+					// the wildcard subscription ends with the context
+					cancel()
+				}
+			}()
+
+			go func(i int) {
+				defer wg.Done()
+
+				for j := 0; j < 100; j++ {
+					ps.Publish("topic", message{Body: fmt.Sprint(i, j)})
+				}
+			}(i)
+		}
+
+		// close while everything is running
+		go ps.Close()
+		wg.Wait()
+		ps.Close()
+
+		ps.lock.Lock()
+		assert.Empty(t, ps.subs, policy)
+		assert.Empty(t, ps.patterns, policy)
+		ps.lock.Unlock()
+	}
+}
+
+func TestPubSubReplay(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+
+	ctx := context.Background()
+	ch := ps.Subscribe("aquarium", ctx, 10).C
+
+	ps.Publish("aquarium", message{Body: "join"})
+	ps.Publish("aquarium", message{Body: "left"})
+	first, second := <-ch, <-ch
+	assert.Equal(t, message{Body: "join", Sequence: 1}, first)
+	assert.Equal(t, message{Body: "left", Sequence: 2}, second)
+	assert.Equal(t, uint64(2), ps.LastSequence("aquarium"))
+
+	messages, ok := ps.Since("aquarium", 1)
+	assert.True(t, ok)
+	assert.Equal(t, []message{second}, messages)
+
+	messages, ok = ps.Since("aquarium", 2)
+	assert.True(t, ok)
+	assert.Empty(t, messages)
+
+	// sequences from the future are from another server run
+	_, ok = ps.Since("aquarium", 3)
+	assert.False(t, ok)
+
+	// new topics have nothing to replay
+	_, ok = ps.Since("other", 0)
+	assert.True(t, ok)
+
+	// topics are numbered on their own
+	ps.Publish("other", message{})
+	assert.Equal(t, uint64(1), ps.LastSequence("other"))
+}
+
+func TestPubSubReplayGap(t *testing.T) {
+	t.Parallel()
+
+	ps := NewPubSub[message]()
+	for i := 0; i < replaySize+10; i++ {
+		ps.Publish("aquarium", message{Body: "join"})
+	}
+
+	// the log is bounded, a too old sequence needs a snapshot
+	_, ok := ps.Since("aquarium", 5)
+	assert.False(t, ok)
+
+	messages, ok := ps.Since("aquarium", 10)
+	assert.True(t, ok)
+	assert.Len(t, messages, replaySize)
+	assert.Equal(t, uint64(11), messages[0].Sequence)
+}
+
+func TestEventID(t *testing.T) {
+	t.Parallel()
+
+	id, ok := ParseEventID(EventID(42))
+	assert.True(t, ok)
+	assert.Equal(t, uint64(42), id)
+
+	_, ok = ParseEventID("otherrun-42")
+	assert.False(t, ok)
+	_, ok = ParseEventID("42")
+	assert.False(t, ok)
 }
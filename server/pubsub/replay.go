@@ -0,0 +1,90 @@
+package pubsub
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// replaySize is the number of messages kept per topic for reconnecting subscribers
+const replaySize = 256
+
+// replay is the bounded log of the latest messages of a topic
+type replay[T any] struct {
+	last     uint64
+	messages []T
+}
+
+// epoch tells messages of different server runs apart, sequences start again after a restart
+var epoch = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// EventID formats a sequence for clients, e.g. as SSE id
+func EventID(seq uint64) string {
+	return fmt.Sprintf("%s-%d", epoch, seq)
+}
+
+// ParseEventID parses an id formatted by EventID. Ids of other server runs are invalid.
+func ParseEventID(raw string) (uint64, bool) {
+	prefix, seq, ok := strings.Cut(raw, "-")
+	if !ok || prefix != epoch {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(seq, 10, 64)
+	return id, err == nil
+}
+
+// record numbers msg and appends it to the replay log of topic, the lock must be held
+func (ps *PubSub[T]) record(topic string, msg T) T {
+	log, ok := ps.replays[topic]
+	if !ok {
+		log = &replay[T]{}
+		ps.replays[topic] = log
+	}
+
+	log.last++
+	msg = msg.WithSequence(log.last)
+
+	log.messages = append(log.messages, msg)
+	if len(log.messages) > replaySize {
+		log.messages = log.messages[len(log.messages)-replaySize:]
+	}
+
+	return msg
+}
+
+// LastSequence returns the sequence of the latest message of topic, zero if there is none
+func (ps *PubSub[T]) LastSequence(topic string) uint64 {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if log, ok := ps.replays[topic]; ok {
+		return log.last
+	}
+	return 0
+}
+
+// Since returns the messages of topic after seq. It reports false if messages after seq
+// are not in the log anymore, the subscriber needs a full snapshot then.
+func (ps *PubSub[T]) Since(topic string, seq uint64) ([]T, bool) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	log, ok := ps.replays[topic]
+	if !ok {
+		return []T{}, seq == 0
+	}
+
+	if seq > log.last {
+		return nil, false
+	}
+
+	// the log holds the sequences first..last without gaps
+	first := log.last - uint64(len(log.messages)) + 1
+	if seq+1 < first {
+		return nil, false
+	}
+
+	return append([]T{}, log.messages[seq+1-first:]...), true
+}
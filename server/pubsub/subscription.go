@@ -0,0 +1,42 @@
+package pubsub
+
+// Wildcard at the end of a topic subscribes to all topics with the same prefix
+const Wildcard = "*"
+
+// Subscription is a subscriber of a topic
+type Subscription[T Sequenced[T]] struct {
+	ID    uint64
+	Topic string
+	// C receives the messages, it is closed when the subscription ends
+	C <-chan T
+
+	ps *PubSub[T]
+	ch chan T
+	// stop cancels the unsubscribe when the context is done
+	stop func() bool
+
+	// dropped counts the messages the subscriber missed
+	dropped uint64
+	// disconnected subscribers were too slow, their channel is closed
+	disconnected bool
+	closed       bool
+}
+
+// Close ends the subscription and closes C, it can be called more than once
+func (s *Subscription[T]) Close() {
+	s.ps.lock.Lock()
+	defer s.ps.lock.Unlock()
+
+	if s.stop != nil {
+		s.stop()
+	}
+	s.ps.unsubscribe(s)
+}
+
+// Dropped returns the number of messages the subscriber missed because its buffer was full
+func (s *Subscription[T]) Dropped() uint64 {
+	s.ps.lock.Lock()
+	defer s.ps.lock.Unlock()
+
+	return s.dropped
+}
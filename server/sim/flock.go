@@ -0,0 +1,76 @@
+package sim
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+
+	"github.com/superbarne/fish/models"
+)
+
+// flocks of fishes by their main color, fishes without colors swim in one of the two last
+const (
+	flockGray uint8 = iota
+	flockRed
+	flockYellow
+	flockGreen
+	flockCyan
+	flockBlue
+	flockMagenta
+	flockA
+	flockB
+)
+
+// flockOf groups fishes with a similar main color like the frontend does
+func flockOf(attributes *models.FishAttributes, rng *rand.Rand) uint8 {
+	if attributes == nil || len(attributes.Colors) == 0 {
+		return flockA + uint8(rng.IntN(2))
+	}
+
+	flock, ok := colorFlock(attributes.Colors[0])
+	if !ok {
+		return flockA + uint8(rng.IntN(2))
+	}
+	return flock
+}
+
+// colorFlock returns the flock of the hue of a #rrggbb color
+func colorFlock(hex string) (uint8, bool) {
+	if len(hex) != 7 || hex[0] != '#' {
+		return 0, false
+	}
+	rgb, err := strconv.ParseUint(hex[1:], 16, 32)
+	if err != nil {
+		return 0, false
+	}
+
+	r := float64(rgb>>16&0xff) / 255
+	g := float64(rgb>>8&0xff) / 255
+	b := float64(rgb&0xff) / 255
+	high := max(r, g, b)
+	low := min(r, g, b)
+	if high-low < 0.15 {
+		return flockGray, true
+	}
+
+	var hue float64
+	switch high {
+	case r:
+		hue = math.Mod((g-b)/(high-low)+6, 6)
+	case g:
+		hue = (b-r)/(high-low) + 2
+	default:
+		hue = (r-g)/(high-low) + 4
+	}
+	return flockRed + uint8(int(math.Round(hue))%6), true
+}
+
+// speedOf lets big and detailed drawings swim slower
+func speedOf(attributes *models.FishAttributes) float64 {
+	if attributes == nil {
+		return speed
+	}
+
+	size := min(float64(attributes.Area)/largeArea, 1)
+	return speed * (1.3 - 0.6*size) * (1.15 - 0.3*attributes.Complexity)
+}
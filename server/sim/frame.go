@@ -0,0 +1,51 @@
+package sim
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/superbarne/fish/models"
+)
+
+// frameBoidSize is the number of bytes of a boid in a frame
+const frameBoidSize = 6
+
+// Keyframe is the layout of the boids in the frames
+type Keyframe = models.SimulationKeyframe
+
+// FishBoids is the number of boids of a fish
+type FishBoids = models.SimulationFishBoids
+
+// Frame are the positions of all boids at a tick
+type Frame = models.SimulationFrame
+
+// Keyframe returns the current layout of the boids
+func (w *World) Keyframe() *Keyframe {
+	keyframe := &Keyframe{Tick: w.Tick, Fishes: []FishBoids{}, MinX: MinX, MinY: MinY, MaxX: MaxX, MaxY: MaxY}
+	for _, b := range w.Boids {
+		if n := len(keyframe.Fishes); n > 0 && keyframe.Fishes[n-1].FishID == b.FishID {
+			keyframe.Fishes[n-1].Boids++
+			continue
+		}
+		keyframe.Fishes = append(keyframe.Fishes, FishBoids{FishID: b.FishID, Boids: 1})
+	}
+	return keyframe
+}
+
+// Frame packs the current positions of the boids
+func (w *World) Frame(time int64) Frame {
+	boids := make([]byte, len(w.Boids)*frameBoidSize)
+	for i, b := range w.Boids {
+		buf := boids[i*frameBoidSize:]
+		binary.LittleEndian.PutUint16(buf, quantize(b.X, MinX, MaxX))
+		binary.LittleEndian.PutUint16(buf[2:], quantize(b.Y, MinY, MaxY))
+		binary.LittleEndian.PutUint16(buf[4:], quantize(math.Atan2(b.VY, b.VX), -math.Pi, math.Pi))
+	}
+	return Frame{Tick: w.Tick, Time: time, Boids: boids}
+}
+
+// quantize maps v from low..high to 0..65535, values outside are clamped
+func quantize(v, low, high float64) uint16 {
+	f := (v - low) / (high - low)
+	return uint16(math.Round(min(max(f, 0), 1) * math.MaxUint16))
+}
@@ -0,0 +1,107 @@
+package sim
+
+import "math"
+
+// grid buckets the boids by position, so a boid only looks at the boids of the cells around it.
+// Boids outside the bounds are in the border cells.
+type grid struct {
+	size          float64
+	columns, rows int
+	// start[c]..start[c+1] are the indexes of cell c in boids
+	start []int
+	boids []int
+	cells []int
+	next  []int
+}
+
+type neighbor struct {
+	index int
+	dist  float64
+}
+
+func newGrid(size float64) grid {
+	columns := int(math.Ceil((MaxX - MinX) / size))
+	rows := int(math.Ceil((MaxY - MinY) / size))
+	return grid{
+		size:    size,
+		columns: columns,
+		rows:    rows,
+		start:   make([]int, columns*rows+1),
+	}
+}
+
+func (g *grid) cell(x, y float64) (int, int) {
+	column := min(max(int((x-MinX)/g.size), 0), g.columns-1)
+	row := min(max(int((y-MinY)/g.size), 0), g.rows-1)
+	return column, row
+}
+
+// build sorts the boids into the cells, the boids of a cell keep their order
+func (g *grid) build(boids []Boid) {
+	clear(g.start)
+	g.cells = g.cells[:0]
+	for _, b := range boids {
+		column, row := g.cell(b.X, b.Y)
+		c := row*g.columns + column
+		g.cells = append(g.cells, c)
+		g.start[c+1]++
+	}
+	for c := 1; c < len(g.start); c++ {
+		g.start[c] += g.start[c-1]
+	}
+
+	if cap(g.boids) < len(boids) {
+		g.boids = make([]int, len(boids))
+	}
+	g.boids = g.boids[:len(boids)]
+	g.next = append(g.next[:0], g.start[:len(g.start)-1]...)
+	for i, c := range g.cells {
+		g.boids[g.next[c]] = i
+		g.next[c]++
+	}
+}
+
+// nearest appends the nearest boids of the flock of boid i within the cell size to result, nearest first
+func (g *grid) nearest(boids []Boid, i int, result []neighbor) []neighbor {
+	b := &boids[i]
+	column, row := g.cell(b.X, b.Y)
+
+	for r := max(row-1, 0); r <= min(row+1, g.rows-1); r++ {
+		for c := max(column-1, 0); c <= min(column+1, g.columns-1); c++ {
+			cell := r*g.columns + c
+			for _, j := range g.boids[g.start[cell]:g.start[cell+1]] {
+				o := &boids[j]
+				if j == i || o.flock != b.flock {
+					continue
+				}
+				dx, dy := o.X-b.X, o.Y-b.Y
+				if dx*dx+dy*dy >= g.size*g.size {
+					continue
+				}
+				result = insertNeighbor(result, neighbor{index: j, dist: math.Sqrt(dx*dx + dy*dy)})
+			}
+		}
+	}
+	return result
+}
+
+// insertNeighbor keeps the maxNeighbors nearest sorted by distance, equal distances by index
+func insertNeighbor(result []neighbor, n neighbor) []neighbor {
+	pos := len(result)
+	for pos > 0 && less(n, result[pos-1]) {
+		pos--
+	}
+	if pos == maxNeighbors {
+		return result
+	}
+	if len(result) < maxNeighbors {
+		result = append(result, neighbor{})
+	}
+	copy(result[pos+1:], result[pos:len(result)-1])
+	result[pos] = n
+	return result
+}
+
+func less(a, b neighbor) bool {
+	return a.dist < b.dist || a.dist == b.dist && a.index < b.index
+}
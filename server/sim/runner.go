@@ -0,0 +1,408 @@
+package sim
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/storage"
+)
+
+// FrameRate is the number of frames per second sent to displays, they interpolate between them
+const FrameRate = 10
+
+// LeaderTimeout is how long the servers wait for frames of the leading simulation before one of them takes over
+const LeaderTimeout = time.Second
+
+// DefaultBoidsPerFish is used if the simulation of an aquarium does not set it
+const DefaultBoidsPerFish = 10
+
+// MaxBoidsPerFish is as many as the frontend simulates on its own
+const MaxBoidsPerFish = 50
+
+// Update is sent to the subscribers of a simulation, Keyframe is set if the layout changed since their last update
+type Update struct {
+	Keyframe *Keyframe
+	Frame    Frame
+}
+
+// Manager runs one simulation per simulated aquarium while displays watch it. With more replicas
+// every server with displays of the aquarium runs a simulation, but only the one running longest
+// sends frames to all of them. If it stops, another one takes over and starts over from the fishes.
+type Manager struct {
+	log     *slog.Logger
+	storage *storage.Storage
+	pubsub  pubsub.Broker[models.Event]
+
+	lock    sync.Mutex
+	runners map[uuid.UUID]*runner
+}
+
+func NewManager(log *slog.Logger, store *storage.Storage, ps pubsub.Broker[models.Event]) *Manager {
+	return &Manager{
+		log:     log,
+		storage: store,
+		pubsub:  ps,
+		runners: map[uuid.UUID]*runner{},
+	}
+}
+
+// Subscribe returns the updates of the simulation of aquarium, nil if it is not simulated.
+// The first update has a keyframe. The channel is closed when ctx is done or the simulation stops,
+// e.g. because it was turned off or failed, subscribing again starts a new one. Slow subscribers miss
+// frames, never keyframes.
+func (m *Manager) Subscribe(ctx context.Context, aquarium *models.Aquarium) <-chan Update {
+	if aquarium.Simulation == nil {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r, ok := m.runners[aquarium.ID]
+	if !ok {
+		r = newRunner(m, aquarium.ID, *aquarium.Simulation)
+		m.runners[aquarium.ID] = r
+		go r.run()
+	}
+
+	sub := &subscriber{ch: make(chan Update, 2)}
+	r.lock.Lock()
+	r.subs[sub] = struct{}{}
+	r.lock.Unlock()
+
+	context.AfterFunc(ctx, func() { m.unsubscribe(r, sub) })
+	return sub.ch
+}
+
+// unsubscribe stops the simulation after its last subscriber
+func (m *Manager) unsubscribe(r *runner, sub *subscriber) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.subs[sub]; !ok {
+		return
+	}
+	delete(r.subs, sub)
+	close(sub.ch)
+
+	if len(r.subs) == 0 && m.runners[r.aquariumID] == r {
+		delete(m.runners, r.aquariumID)
+		r.cancel()
+	}
+}
+
+// remove forgets a runner that stopped by itself and ends its subscriptions
+func (m *Manager) remove(r *runner) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.runners[r.aquariumID] == r {
+		delete(m.runners, r.aquariumID)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for sub := range r.subs {
+		delete(r.subs, sub)
+		close(sub.ch)
+	}
+}
+
+type subscriber struct {
+	ch chan Update
+	// version is the version of the keyframe the subscriber knows
+	version uint64
+}
+
+// runner simulates one aquarium while it leads and relays the frames of the leading simulation
+// to the subscribers of this server
+type runner struct {
+	manager    *Manager
+	log        *slog.Logger
+	id         uuid.UUID
+	aquariumID uuid.UUID
+	settings   models.Simulation
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	// leading is set while this simulation sends the frames, since when it started
+	leading bool
+	since   time.Time
+	world   *World
+	// layout is the version of the keyframe, it changes when fishes join or leave
+	layout   uint64
+	keyframe *Keyframe
+	// frames counts the published frames, every second one comes with the keyframe
+	frames uint64
+
+	// source is the leading simulation the subscribers get the frames of, lastFrame when it sent the last one.
+	// synced is set once its keyframe arrived.
+	source    models.SimulationUpdate
+	synced    bool
+	lastFrame time.Time
+
+	lock sync.Mutex
+	subs map[*subscriber]struct{}
+	// version changes with every keyframe the subscribers get, shared is the latest one
+	version uint64
+	shared  *Keyframe
+}
+
+func newRunner(m *Manager, aquariumID uuid.UUID, settings models.Simulation) *runner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &runner{
+		manager:    m,
+		log:        m.log.With(slog.String("aquarium", aquariumID.String())),
+		id:         uuid.New(),
+		aquariumID: aquariumID,
+		settings:   settings,
+		ctx:        ctx,
+		cancel:     cancel,
+		lastFrame:  time.Now(),
+		subs:       map[*subscriber]struct{}{},
+	}
+}
+
+func (r *runner) run() {
+	defer r.manager.remove(r)
+	defer r.cancel()
+
+	// subscribe before reading the fishes, nothing gets lost in between
+	sub := r.manager.pubsub.Subscribe(models.AquariumTopic(r.aquariumID), r.ctx, 10)
+	defer func() { sub.Close() }()
+	updates := r.manager.pubsub.Subscribe(models.SimulationTopic(r.aquariumID), r.ctx, 10)
+	defer updates.Close()
+
+	// a simulation running elsewhere already takes over right away
+	if err := r.lead(); err != nil {
+		r.log.Error("Failed to start simulation", slog.String("error", err.Error()))
+		return
+	}
+	defer r.log.Info("Simulation stopped")
+
+	ticker := time.NewTicker(time.Second / TickRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.leading {
+				// the leading simulation is gone
+				if time.Since(r.lastFrame) < LeaderTimeout {
+					continue
+				}
+				if err := r.lead(); err != nil {
+					r.log.Error("Failed to take over simulation", slog.String("error", err.Error()))
+					return
+				}
+			}
+
+			r.world.Step()
+			if r.world.Tick%(TickRate/FrameRate) == 0 {
+				r.publish()
+			}
+		case event, ok := <-updates.C:
+			if !ok {
+				// pubsub was closed, the server shuts down
+				return
+			}
+			if event.SimulationUpdate != nil {
+				r.relay(event.SimulationUpdate)
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				// pubsub was closed, the server shuts down
+				return
+			}
+
+			// missed fishes, start over from the storage
+			if sub.Dropped() > 0 {
+				sub.Close()
+				sub = r.manager.pubsub.Subscribe(models.AquariumTopic(r.aquariumID), r.ctx, 10)
+				if !r.leading {
+					continue
+				}
+				if err := r.reset(); err != nil {
+					r.log.Error("Failed to reset simulation", slog.String("error", err.Error()))
+					return
+				}
+				continue
+			}
+
+			if !r.handle(event) {
+				return
+			}
+		}
+	}
+}
+
+// lead starts a new world with the swimming fishes of the aquarium and sends its frames to all servers
+func (r *runner) lead() error {
+	if err := r.reset(); err != nil {
+		return err
+	}
+
+	r.leading = true
+	r.since = time.Now()
+	r.log.Info("Simulation started", slog.Uint64("seed", r.settings.Seed))
+	return nil
+}
+
+// follow stops the simulation of this server, another one sends the frames
+func (r *runner) follow(leader models.SimulationUpdate) {
+	r.leading = false
+	r.world = nil
+	r.keyframe = nil
+	r.log.Info("Simulation follows another server", slog.String("leader", leader.Runner.String()))
+}
+
+// handle applies an event to the world, it reports false if the simulation was turned off
+func (r *runner) handle(event models.Event) bool {
+	switch {
+	case event.Aquarium != nil:
+		if event.Aquarium.Simulation == nil {
+			return false
+		}
+		if *event.Aquarium.Simulation != r.settings {
+			r.settings = *event.Aquarium.Simulation
+			if !r.leading {
+				return true
+			}
+			if err := r.reset(); err != nil {
+				r.log.Error("Failed to reset simulation", slog.String("error", err.Error()))
+				return false
+			}
+		}
+	case event.Fish != nil && r.leading:
+		switch {
+		case event.Kind == models.EventFishLeft || !event.Fish.Approved || !event.Fish.Ready():
+			if !r.world.Has(event.Fish.ID) {
+				return true
+			}
+			r.world.Remove(event.Fish.ID)
+		case event.Kind == models.EventFishJoin:
+			if r.world.Has(event.Fish.ID) {
+				return true
+			}
+			r.world.Add(event.Fish, r.boidsPerFish())
+		default:
+			return true
+		}
+		r.changed()
+	}
+	return true
+}
+
+// reset starts a new world with the swimming fishes of the aquarium
+func (r *runner) reset() error {
+	fishes, err := r.manager.storage.Fishes(r.aquariumID)
+	if err != nil {
+		return err
+	}
+
+	r.world = NewWorld(r.settings.Seed)
+	for _, fish := range fishes {
+		if fish.Approved && fish.Ready() {
+			r.world.Add(fish, r.boidsPerFish())
+		}
+	}
+	r.changed()
+	return nil
+}
+
+func (r *runner) boidsPerFish() int {
+	if r.settings.BoidsPerFish <= 0 {
+		return DefaultBoidsPerFish
+	}
+	return r.settings.BoidsPerFish
+}
+
+// changed sends the keyframe with the next frame
+func (r *runner) changed() {
+	r.layout++
+	r.keyframe = r.world.Keyframe()
+	r.frames = 0
+}
+
+// publish sends the current frame to all servers
+func (r *runner) publish() {
+	update := &models.SimulationUpdate{
+		Runner: r.id,
+		Since:  r.since,
+		Layout: r.layout,
+		Frame:  r.world.Frame(time.Now().UnixMilli()),
+	}
+	if r.frames%FrameRate == 0 {
+		update.Keyframe = r.keyframe
+	}
+	r.frames++
+
+	r.manager.pubsub.Publish(models.SimulationTopic(r.aquariumID), models.NewSimulationEvent(r.aquariumID, update))
+}
+
+// leads reports if the simulation of a runs longer than the one of b, they take over in the order they started
+func leads(a, b models.SimulationUpdate) bool {
+	if !a.Since.Equal(b.Since) {
+		return a.Since.Before(b.Since)
+	}
+	return a.Runner.String() < b.Runner.String()
+}
+
+// relay sends an update of the leading simulation to the subscribers of this server
+func (r *runner) relay(update *models.SimulationUpdate) {
+	if update.Runner != r.id && r.leading && leads(*update, models.SimulationUpdate{Runner: r.id, Since: r.since}) {
+		r.follow(*update)
+	}
+
+	// a new source needs to be the leading one, the old one is gone or runs shorter
+	if update.Runner != r.source.Runner {
+		gone := r.source.Runner == uuid.Nil || time.Since(r.lastFrame) >= LeaderTimeout
+		if !gone && !leads(*update, r.source) {
+			return
+		}
+		r.source = models.SimulationUpdate{Runner: update.Runner, Since: update.Since}
+		r.synced = false
+	}
+	r.lastFrame = time.Now()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.synced || update.Layout != r.source.Layout {
+		if update.Keyframe == nil {
+			// the frames can not be read without the layout
+			return
+		}
+		r.source.Layout = update.Layout
+		r.synced = true
+		r.shared = update.Keyframe
+		r.version++
+	}
+
+	r.broadcast(update.Frame)
+}
+
+// broadcast sends frame to all subscribers, a subscriber with a full buffer misses it. The lock must be held.
+func (r *runner) broadcast(frame Frame) {
+	for sub := range r.subs {
+		update := Update{Frame: frame}
+		if sub.version != r.version {
+			update.Keyframe = r.shared
+		}
+
+		select {
+		case sub.ch <- update:
+			sub.version = r.version
+		default:
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package sim
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/storage"
+)
+
+// nextKeyframe waits for the next update with a keyframe
+func nextKeyframe(t *testing.T, updates <-chan Update) *Keyframe {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update, ok := <-updates:
+			require.True(t, ok, "updates closed")
+			if update.Keyframe != nil {
+				assert.Len(t, update.Frame.Boids, countBoids(update.Keyframe)*frameBoidSize)
+				return update.Keyframe
+			}
+		case <-timeout:
+			require.FailNow(t, "no keyframe")
+		}
+	}
+}
+
+func countBoids(keyframe *Keyframe) (n int) {
+	for _, fish := range keyframe.Fishes {
+		n += fish.Boids
+	}
+	return n
+}
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New(), Simulation: &models.Simulation{Seed: 7, BoidsPerFish: 3}}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fishes := testFishes(2)
+	for _, fish := range fishes {
+		fish.AquariumID = aquarium.ID
+	}
+	require.NoError(t, store.InsertFish(aquarium.ID, fishes[0]))
+
+	ps := pubsub.NewPubSub[models.Event]()
+	t.Cleanup(ps.Close)
+	m := NewManager(slog.Default(), store, ps)
+
+	// aquariums without simulation have no updates
+	assert.Nil(t, m.Subscribe(context.Background(), &models.Aquarium{ID: uuid.New()}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	updates := m.Subscribe(ctx, aquarium)
+	keyframe := nextKeyframe(t, updates)
+	assert.Equal(t, []FishBoids{{FishID: fishes[0].ID, Boids: 3}}, keyframe.Fishes)
+
+	// a second display watches the same simulation
+	other, cancelOther := context.WithCancel(context.Background())
+	assert.Equal(t, keyframe.Fishes, nextKeyframe(t, m.Subscribe(other, aquarium)).Fishes)
+	cancelOther()
+
+	// joining fishes change the layout
+	ps.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishJoin, fishes[1]))
+	keyframe = nextKeyframe(t, updates)
+	assert.Equal(t, []FishBoids{{FishID: fishes[0].ID, Boids: 3}, {FishID: fishes[1].ID, Boids: 3}}, keyframe.Fishes)
+
+	// turning it off ends the updates
+	ps.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(&models.Aquarium{ID: aquarium.ID}))
+	assert.Eventually(t, func() bool {
+		select {
+		case _, ok := <-updates:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond)
+
+	m.lock.Lock()
+	assert.Empty(t, m.runners)
+	m.lock.Unlock()
+
+	// the simulation stops with its last display
+	updates = m.Subscribe(ctx, aquarium)
+	nextKeyframe(t, updates)
+	cancel()
+	assert.Eventually(t, func() bool {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		return len(m.runners) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestManagerReplicas(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New(), Simulation: &models.Simulation{Seed: 7, BoidsPerFish: 3}}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fish := testFishes(1)[0]
+	fish.AquariumID = aquarium.ID
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+
+	// two replicas connected by the broker
+	ps := pubsub.NewPubSub[models.Event]()
+	t.Cleanup(ps.Close)
+	a := NewManager(slog.Default(), store, ps)
+	b := NewManager(slog.Default(), store, ps)
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	updatesA := a.Subscribe(ctxA, aquarium)
+	nextKeyframe(t, updatesA)
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	updatesB := b.Subscribe(ctxB, aquarium)
+	nextKeyframe(t, updatesB)
+
+	// the displays of b get the frames of the simulation of a, it runs longer
+	assert.Eventually(t, func() bool {
+		frameA, frameB := (<-updatesA).Frame, (<-updatesB).Frame
+		for frameA.Tick != frameB.Tick {
+			if frameA.Tick < frameB.Tick {
+				frameA = (<-updatesA).Frame
+			} else {
+				frameB = (<-updatesB).Frame
+			}
+		}
+		return frameA.Time == frameB.Time
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// without displays on a, b takes over
+	cancelA()
+	keyframe := nextKeyframe(t, updatesB)
+	assert.Equal(t, []FishBoids{{FishID: fish.ID, Boids: 3}}, keyframe.Fishes)
+	_, ok := <-updatesB
+	assert.True(t, ok)
+}
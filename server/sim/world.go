@@ -0,0 +1,211 @@
+// Package sim moves the boids of an aquarium on the server, so all displays show the same aquarium.
+// The rules are the ones of the frontend (frontend/src/Boid.ts) in the plane of the screen.
+package sim
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+)
+
+// Bounds of the aquarium in the units of the frontend scene
+const (
+	MinX = -3.85
+	MaxX = 3.85
+	MinY = 0.3
+	MaxY = 5.0
+)
+
+const (
+	// TickRate is the number of steps per second
+	TickRate = 20
+	// frontendRate is the frame rate the frontend constants are made for
+	frontendRate = 60
+
+	speed          = 0.009  // how far a boid swims per frontend frame
+	sepRadius      = 0.3    // how close neighboids may come
+	sepWeight      = 1.0    // how much the boid separates itself from its neighboids
+	aliWeight      = 0.3    // how much the boid follows the direction of its flock
+	cohWeight      = 0.1    // how much the boid swims to the middle of its flock
+	avoWeight      = 0.2    // how much the boid dodges the walls
+	ranWeight      = 0.003  // how much the boid goes in a random direction
+	inertia        = 0.02   // the proportion with which the rules affect the current speed
+	avoRadius      = 0.0025 // the radius of the sightline of the boid to the walls
+	neighborRadius = 0.8    // how far a boid sees the boids of its flock
+	maxNeighbors   = 6
+	largeArea      = 200000 // drawn pixels of a fish that swims slowest
+)
+
+// Boid is one swimming copy of a fish
+type Boid struct {
+	FishID uuid.UUID
+	X, Y   float64
+	VX, VY float64
+
+	flock uint8
+	speed float64
+}
+
+// World is the state of one simulated aquarium. It is not safe for concurrent use.
+// Two worlds with the same seed, fishes and steps are equal.
+type World struct {
+	// Tick counts the steps
+	Tick  uint64
+	Boids []Boid
+
+	rng  *rand.Rand
+	grid grid
+	// dv is the velocity change of every boid in the current step
+	dv []vector
+}
+
+func NewWorld(seed uint64) *World {
+	return &World{
+		rng:  rand.New(rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)),
+		grid: newGrid(neighborRadius),
+	}
+}
+
+// Add lets count boids of fish swim at random positions, fishes already swimming are ignored
+func (w *World) Add(fish *models.Fish, count int) {
+	if w.Has(fish.ID) {
+		return
+	}
+
+	flock := flockOf(fish.Attributes, w.rng)
+	speed := speedOf(fish.Attributes)
+	for range count {
+		w.Boids = append(w.Boids, Boid{
+			FishID: fish.ID,
+			X:      MinX + w.rng.Float64()*(MaxX-MinX),
+			Y:      0.7 + w.rng.Float64()*2.6,
+			VX:     w.rng.Float64()*2 - 1,
+			flock:  flock,
+			speed:  speed,
+		})
+	}
+}
+
+// Remove takes all boids of a fish out, the order of the others stays the same
+func (w *World) Remove(fishID uuid.UUID) {
+	w.Boids = slices.DeleteFunc(w.Boids, func(b Boid) bool { return b.FishID == fishID })
+}
+
+// Has reports if boids of the fish are swimming
+func (w *World) Has(fishID uuid.UUID) bool {
+	return slices.ContainsFunc(w.Boids, func(b Boid) bool { return b.FishID == fishID })
+}
+
+// Step moves all boids by one tick. The rules see the state before the step, the order of the boids does not matter.
+func (w *World) Step() {
+	w.Tick++
+	w.grid.build(w.Boids)
+
+	// the frontend constants are per frame
+	frames := float64(frontendRate) / TickRate
+
+	w.dv = slices.Grow(w.dv[:0], len(w.Boids))[:len(w.Boids)]
+	var neighbors [maxNeighbors]neighbor
+	for i := range w.Boids {
+		b := &w.Boids[i]
+		n := w.grid.nearest(w.Boids, i, neighbors[:0])
+
+		dv := separation(w.Boids, b, n).
+			add(alignment(w.Boids, n)).
+			add(cohesion(w.Boids, b, n)).
+			add(avoidance(b)).
+			add(w.randomness())
+		w.dv[i] = dv.scale(inertia * frames)
+	}
+
+	for i := range w.Boids {
+		b := &w.Boids[i]
+		v := vector{b.VX, b.VY}.add(w.dv[i]).clamp(b.speed*0.5, b.speed)
+		b.VX, b.VY = v.x, v.y
+		b.X += v.x * frames
+		b.Y += v.y * frames
+	}
+}
+
+// separation avoids the neighboids that are too close
+func separation(boids []Boid, b *Boid, n []neighbor) vector {
+	var result vector
+	for _, o := range n {
+		if o.dist > sepRadius {
+			continue
+		}
+		away := vector{b.X - boids[o.index].X, b.Y - boids[o.index].Y}
+		if o.dist != 0 {
+			away = away.scale(1 / o.dist)
+		}
+		result = result.add(away)
+	}
+	return result.clamp(sepWeight, sepWeight)
+}
+
+// alignment swims in the direction of the neighboids
+func alignment(boids []Boid, n []neighbor) vector {
+	var result vector
+	for _, o := range n {
+		result = result.add(vector{boids[o.index].VX, boids[o.index].VY})
+	}
+	return result.clamp(aliWeight, aliWeight)
+}
+
+// cohesion swims to the middle of the neighboids
+func cohesion(boids []Boid, b *Boid, n []neighbor) vector {
+	if len(n) == 0 {
+		return vector{}
+	}
+
+	var center vector
+	for _, o := range n {
+		center = center.add(vector{boids[o.index].X, boids[o.index].Y})
+	}
+	center = center.scale(1 / float64(len(n)))
+	return vector{center.x - b.X, center.y - b.Y}.clamp(cohWeight, cohWeight)
+}
+
+// avoidance turns away from walls when the boid is close to hitting them
+func avoidance(b *Boid) vector {
+	var result vector
+	if math.Abs(b.X)+avoRadius >= MaxX {
+		result.x = -math.Copysign(1, b.X)
+	}
+	if b.Y <= MinY {
+		result.y = 1
+	}
+	if b.Y >= MaxY {
+		result.y = -1
+	}
+	return result.clamp(avoWeight, avoWeight)
+}
+
+// randomness shakes things up a little
+func (w *World) randomness() vector {
+	return vector{w.rng.Float64()*2 - 1, w.rng.Float64()*2 - 1}.clamp(ranWeight, ranWeight)
+}
+
+type vector struct {
+	x, y float64
+}
+
+func (v vector) add(o vector) vector {
+	return vector{v.x + o.x, v.y + o.y}
+}
+
+func (v vector) scale(f float64) vector {
+	return vector{v.x * f, v.y * f}
+}
+
+// clamp limits the length of v to low..high, the zero vector stays zero
+func (v vector) clamp(low, high float64) vector {
+	length := math.Sqrt(v.x*v.x + v.y*v.y)
+	if length == 0 {
+		return v
+	}
+	return v.scale(max(low, min(high, length)) / length)
+}
@@ -0,0 +1,175 @@
+package sim
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/superbarne/fish/models"
+)
+
+func testFishes(n int) []*models.Fish {
+	fishes := make([]*models.Fish, n)
+	for i := range fishes {
+		fishes[i] = &models.Fish{
+			ID:         uuid.NewSHA1(uuid.Nil, []byte{byte(i), byte(i >> 8)}),
+			Approved:   true,
+			Attributes: &models.FishAttributes{Colors: []string{[]string{"#e02020", "#2040c0", "#808080"}[i%3]}, Area: i * 1000},
+		}
+	}
+	return fishes
+}
+
+func testWorld(seed uint64, fishes []*models.Fish, boids int) *World {
+	w := NewWorld(seed)
+	for _, fish := range fishes {
+		w.Add(fish, boids)
+	}
+	return w
+}
+
+func TestWorldDeterministic(t *testing.T) {
+	t.Parallel()
+
+	fishes := testFishes(20)
+	a := testWorld(42, fishes, 5)
+	b := testWorld(42, fishes, 5)
+	other := testWorld(43, fishes, 5)
+
+	for range 200 {
+		a.Step()
+		b.Step()
+		other.Step()
+	}
+
+	assert.Equal(t, uint64(200), a.Tick)
+	assert.Equal(t, a.Boids, b.Boids)
+	assert.Equal(t, a.Frame(0), b.Frame(0))
+	assert.NotEqual(t, a.Frame(0), other.Frame(0))
+
+	// the boids stay in the aquarium
+	for _, boid := range a.Boids {
+		assert.InDelta(t, 0, boid.X, MaxX+0.5)
+		assert.True(t, boid.Y > MinY-0.5 && boid.Y < MaxY+0.5, boid.Y)
+	}
+}
+
+func TestWorldLayout(t *testing.T) {
+	t.Parallel()
+
+	fishes := testFishes(3)
+	w := testWorld(1, fishes, 4)
+	w.Add(fishes[0], 4)
+	assert.Len(t, w.Boids, 12, "fishes only join once")
+
+	w.Remove(fishes[1].ID)
+	assert.False(t, w.Has(fishes[1].ID))
+
+	keyframe := w.Keyframe()
+	assert.Equal(t, []FishBoids{{FishID: fishes[0].ID, Boids: 4}, {FishID: fishes[2].ID, Boids: 4}}, keyframe.Fishes)
+	assert.Len(t, w.Frame(0).Boids, 8*frameBoidSize)
+}
+
+func TestFrame(t *testing.T) {
+	t.Parallel()
+
+	w := NewWorld(1)
+	w.Boids = []Boid{
+		{X: MinX, Y: MaxY, VX: 1},
+		{X: MaxX + 1, Y: MinY - 1, VX: -1, VY: -0.0001},
+	}
+	frame := w.Frame(1234)
+	assert.Equal(t, int64(1234), frame.Time)
+
+	read := func(i, field int) uint16 {
+		return binary.LittleEndian.Uint16(frame.Boids[i*frameBoidSize+field*2:])
+	}
+	assert.Equal(t, uint16(0), read(0, 0))
+	assert.Equal(t, uint16(math.MaxUint16), read(0, 1))
+	assert.Equal(t, uint16(math.MaxUint16/2+1), read(0, 2), "heading right is the middle")
+	// outside the bounds is clamped
+	assert.Equal(t, uint16(math.MaxUint16), read(1, 0))
+	assert.Equal(t, uint16(0), read(1, 1))
+	assert.LessOrEqual(t, read(1, 2), uint16(1), "heading left is -π")
+}
+
+func TestGridNearest(t *testing.T) {
+	t.Parallel()
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	boids := make([]Boid, 500)
+	for i := range boids {
+		boids[i] = Boid{
+			X:     MinX - 1 + rng.Float64()*(MaxX-MinX+2),
+			Y:     MinY - 1 + rng.Float64()*(MaxY-MinY+2),
+			flock: uint8(rng.IntN(3)),
+		}
+	}
+	// boids on top of each other
+	boids[1].X, boids[1].Y, boids[1].flock = boids[0].X, boids[0].Y, boids[0].flock
+
+	g := newGrid(neighborRadius)
+	g.build(boids)
+
+	for i, b := range boids {
+		// brute force
+		var want []neighbor
+		for j, o := range boids {
+			dx, dy := o.X-b.X, o.Y-b.Y
+			dist := math.Sqrt(dx*dx + dy*dy)
+			if j != i && o.flock == b.flock && dx*dx+dy*dy < neighborRadius*neighborRadius {
+				want = append(want, neighbor{index: j, dist: dist})
+			}
+		}
+		slices.SortFunc(want, func(a, b neighbor) int {
+			if less(a, b) {
+				return -1
+			}
+			return 1
+		})
+		want = want[:min(len(want), maxNeighbors)]
+
+		got := g.nearest(boids, i, nil)
+		if len(want) == 0 {
+			assert.Empty(t, got)
+			continue
+		}
+		assert.Equal(t, want, got, i)
+	}
+}
+
+func TestColorFlock(t *testing.T) {
+	t.Parallel()
+
+	for hex, want := range map[string]uint8{
+		"#e02020": flockRed,
+		"#2040c0": flockBlue,
+		"#20c040": flockGreen,
+		"#808080": flockGray,
+		"#ff00ff": flockMagenta,
+	} {
+		flock, ok := colorFlock(hex)
+		assert.True(t, ok, hex)
+		assert.Equal(t, want, flock, hex)
+	}
+
+	_, ok := colorFlock("red")
+	assert.False(t, ok)
+}
+
+// BenchmarkStep is one tick of a full aquarium, several hundred fishes with one boid each
+func BenchmarkStep(b *testing.B) {
+	w := testWorld(1, testFishes(500), 1)
+	for range 100 {
+		w.Step()
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		w.Step()
+	}
+}
@@ -0,0 +1,223 @@
+// Package snapshot renders aquariums to pictures for social media and mementos, the renders are cached by revision.
+package snapshot
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/gif"
+	"image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/storage"
+)
+
+// renderVersion changes the revisions of all aquariums when the renders look different
+const renderVersion = "1"
+
+// MaxSeeds is the number of seeds with a cached render per aquarium and format, the render of the
+// default seed is always kept
+const MaxSeeds = 8
+
+// Format of a render
+type Format string
+
+const (
+	// PNG is a still picture of the aquarium
+	PNG Format = "png"
+	// GIF is an animated loop of the aquarium
+	GIF Format = "gif"
+)
+
+var ErrFormat = errors.New("unknown snapshot format")
+
+// Renderer renders aquariums and keeps the latest render per aquarium, seed and format
+type Renderer struct {
+	storage *storage.Storage
+
+	// lock renders one at a time, requests for the same render wait for the cached file
+	lock sync.Mutex
+}
+
+func NewRenderer(store *storage.Storage) *Renderer {
+	return &Renderer{storage: store}
+}
+
+// DefaultSeed is the seed of the layout of an aquarium if none is given
+func DefaultSeed(aquariumID uuid.UUID) uint64 {
+	return binary.BigEndian.Uint64(aquariumID[:8])
+}
+
+// Revision identifies what a render shows: the approved fishes, their images and the seed
+func Revision(fishes []*models.Fish, seed uint64) string {
+	hash := sha256.New()
+	io.WriteString(hash, renderVersion+"\n"+strconv.FormatUint(seed, 10)+"\n")
+	for _, fish := range swimming(fishes) {
+		io.WriteString(hash, fish.ID.String()+" "+strconv.FormatInt(fish.UpdatedAt.UnixNano(), 10)+"\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
+
+// Render returns the path of the render of the aquarium and its revision, it is only rendered again
+// if the revision changed
+func (r *Renderer) Render(aquariumID uuid.UUID, seed uint64, format Format) (string, string, error) {
+	if format != PNG && format != GIF {
+		return "", "", ErrFormat
+	}
+
+	fishes, err := r.storage.Fishes(aquariumID)
+	if err != nil {
+		return "", "", err
+	}
+	revision := Revision(fishes, seed)
+
+	prefix := strconv.FormatUint(seed, 10) + "-"
+	path, err := r.storage.SnapshotPath(aquariumID, prefix+revision+"."+string(format))
+	if err != nil {
+		return "", "", err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, err := os.Stat(path); err == nil {
+		return path, revision, nil
+	}
+
+	scene, err := r.scene(aquariumID, fishes, seed)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := write(path, func(w io.Writer) error {
+		if format == GIF {
+			return gif.EncodeAll(w, scene.Animation(imageprocess.AnimationWidth, imageprocess.AnimationHeight))
+		}
+		return png.Encode(w, scene.Snapshot(imageprocess.SnapshotWidth, imageprocess.SnapshotHeight))
+	}); err != nil {
+		return "", "", err
+	}
+
+	// older revisions of the seed are not needed anymore
+	others, _ := filepath.Glob(filepath.Join(filepath.Dir(path), prefix+"*."+string(format)))
+	for _, other := range others {
+		if other != path {
+			os.Remove(other)
+		}
+	}
+	evict(filepath.Dir(path), format, strconv.FormatUint(DefaultSeed(aquariumID), 10)+"-")
+
+	return path, revision, nil
+}
+
+// evict removes the renders of format in dir rendered longest ago until MaxSeeds are left,
+// renders starting with keep stay
+func evict(dir string, format Format, keep string) {
+	renders, _ := filepath.Glob(filepath.Join(dir, "*."+string(format)))
+	if len(renders) <= MaxSeeds {
+		return
+	}
+
+	type render struct {
+		path    string
+		modTime time.Time
+	}
+	candidates := []render{}
+	for _, path := range renders {
+		info, err := os.Stat(path)
+		if err != nil || strings.HasPrefix(filepath.Base(path), keep) {
+			continue
+		}
+		candidates = append(candidates, render{path, info.ModTime()})
+	}
+	slices.SortFunc(candidates, func(a, b render) int { return a.modTime.Compare(b.modTime) })
+
+	for _, candidate := range candidates[:min(len(renders)-MaxSeeds, len(candidates))] {
+		os.Remove(candidate.path)
+	}
+}
+
+// scene places the approved fishes of the aquarium
+func (r *Renderer) scene(aquariumID uuid.UUID, fishes []*models.Fish, seed uint64) (*imageprocess.Scene, error) {
+	sceneFishes := []imageprocess.SceneFish{}
+	for _, fish := range swimming(fishes) {
+		img, err := r.image(aquariumID, fish.ID)
+		if errors.Is(err, fs.ErrNotExist) {
+			// processed images can be removed in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sceneFish := imageprocess.SceneFish{Image: img}
+		if fish.Attributes != nil {
+			sceneFish.Facing = fish.Attributes.Facing
+			sceneFish.Area = fish.Attributes.Area
+		}
+		sceneFishes = append(sceneFishes, sceneFish)
+	}
+
+	return imageprocess.NewScene(sceneFishes, seed), nil
+}
+
+// image loads the medium variant of the fish image, fishes processed before variants existed have only the full one
+func (r *Renderer) image(aquariumID uuid.UUID, fishID uuid.UUID) (image.Image, error) {
+	path, err := r.storage.FishImageVariantPath(aquariumID, fishID, models.ImageSizeMedium)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := imageprocess.LoadImage(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return r.storage.FishImage(aquariumID, fishID)
+	}
+	return img, err
+}
+
+// swimming returns the fishes the public sees in the aquarium
+func swimming(fishes []*models.Fish) []*models.Fish {
+	result := []*models.Fish{}
+	for _, fish := range fishes {
+		if fish.Approved && fish.Ready() {
+			result = append(result, fish)
+		}
+	}
+	return result
+}
+
+// write writes to a temp file first, readers never see a half written render
+func write(path string, encode func(io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := encode(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
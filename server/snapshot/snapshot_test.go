@@ -0,0 +1,119 @@
+package snapshot
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/storage"
+)
+
+func insertFish(t *testing.T, store *storage.Storage, aquariumID uuid.UUID, approved bool) *models.Fish {
+	t.Helper()
+
+	fish := &models.Fish{ID: uuid.New(), AquariumID: aquariumID, Approved: approved, Status: models.FishStatusReady, UpdatedAt: time.Now()}
+	require.NoError(t, store.InsertFish(aquariumID, fish))
+
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for x := 5; x < 35; x++ {
+		for y := 5; y < 15; y++ {
+			img.Set(x, y, color.NRGBA{0xe0, 0x20, 0x20, 0xff})
+		}
+	}
+	path, err := store.FishImagePath(aquariumID, fish.ID)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, png.Encode(file, img))
+
+	return fish
+}
+
+func TestRenderer(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	insertFish(t, store, aquarium.ID, true)
+
+	renderer := NewRenderer(store)
+	seed := DefaultSeed(aquarium.ID)
+
+	path, revision, err := renderer.Render(aquarium.ID, seed, PNG)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	img, err := png.Decode(file)
+	file.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 1920, img.Bounds().Dx())
+
+	// the same revision is not rendered again
+	cached, cachedRevision, err := renderer.Render(aquarium.ID, seed, PNG)
+	require.NoError(t, err)
+	assert.Equal(t, path, cached)
+	assert.Equal(t, revision, cachedRevision)
+	cachedInfo, err := os.Stat(cached)
+	require.NoError(t, err)
+	assert.Equal(t, info.ModTime(), cachedInfo.ModTime())
+
+	// fishes waiting for approval are not shown
+	insertFish(t, store, aquarium.ID, false)
+	_, same, err := renderer.Render(aquarium.ID, seed, PNG)
+	require.NoError(t, err)
+	assert.Equal(t, revision, same)
+
+	// a new fish is a new revision, the old render is removed
+	insertFish(t, store, aquarium.ID, true)
+	newPath, newRevision, err := renderer.Render(aquarium.ID, seed, PNG)
+	require.NoError(t, err)
+	assert.NotEqual(t, revision, newRevision)
+	assert.FileExists(t, newPath)
+	assert.NoFileExists(t, path)
+
+	// the seed is part of the revision, other seeds do not replace the render
+	seedPath, seedRevision, err := renderer.Render(aquarium.ID, seed+1, PNG)
+	require.NoError(t, err)
+	assert.NotEqual(t, newRevision, seedRevision)
+	assert.FileExists(t, newPath)
+
+	// only the latest seeds stay, the default seed is kept
+	for i := uint64(2); i <= MaxSeeds+1; i++ {
+		_, _, err := renderer.Render(aquarium.ID, seed+i, PNG)
+		require.NoError(t, err)
+	}
+	renders, err := filepath.Glob(filepath.Join(filepath.Dir(newPath), "*.png"))
+	require.NoError(t, err)
+	assert.Len(t, renders, MaxSeeds)
+	assert.FileExists(t, newPath)
+	assert.NoFileExists(t, seedPath)
+
+	// the animated loop is cached next to the picture
+	gifPath, gifRevision, err := renderer.Render(aquarium.ID, seed, GIF)
+	require.NoError(t, err)
+	assert.Equal(t, newRevision, gifRevision)
+	file, err = os.Open(gifPath)
+	require.NoError(t, err)
+	anim, err := gif.DecodeAll(file)
+	file.Close()
+	require.NoError(t, err)
+	assert.Len(t, anim.Image, 36)
+
+	_, _, err = renderer.Render(aquarium.ID, seed, Format("mp4"))
+	assert.ErrorIs(t, err, ErrFormat)
+}
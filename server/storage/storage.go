@@ -1,13 +1,17 @@
 package storage
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"image"
 	"io"
+	"io/fs"
 	"mime/multipart"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fogleman/gg"
@@ -41,11 +45,13 @@ func (s *Storage) save(path string, data interface{}) error {
 		return err
 	}
 
-	if err := os.WriteFile(path, raw, os.ModePerm); err != nil {
+	// write to a temp file first, readers never see a half written file
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, raw, os.ModePerm); err != nil {
 		return err
 	}
 
-	return nil
+	return os.Rename(tmpPath, path)
 }
 
 // InsertAquarium inserts or updates an aquarium
@@ -140,7 +146,7 @@ func (s *Storage) Fishes(aquariumID uuid.UUID) (fishes []*models.Fish, err error
 
 	fishes = []*models.Fish{}
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
 			continue
 		}
 
@@ -222,6 +228,71 @@ func (s *Storage) FishImagePath(aquariumID uuid.UUID, fishID uuid.UUID) (path st
 	return filepath.Join(fishPath, filename), nil
 }
 
+// FishImageVariantPath returns the path of a size variant of the fish image
+func (s *Storage) FishImageVariantPath(aquariumID uuid.UUID, fishID uuid.UUID, size models.ImageSize) (path string, err error) {
+	path, err = s.FishImagePath(aquariumID, fishID)
+	if err != nil || size == models.ImageSizeFull {
+		return path, err
+	}
+
+	return strings.TrimSuffix(path, ".png") + "_" + string(size) + ".png", nil
+}
+
+// SnapshotPath returns the path of a cached render of an aquarium, e.g. "<revision>.png"
+func (s *Storage) SnapshotPath(aquariumID uuid.UUID, name string) (path string, err error) {
+	if aquariumID == uuid.Nil {
+		return "", ErrBadID
+	}
+
+	return filepath.Join(s.basePath, "aquariums", aquariumID.String(), "snapshots", filepath.Base(name)), nil
+}
+
+// FishMask returns the mask corrections of a fish
+func (s *Storage) FishMask(aquariumID uuid.UUID, fishID uuid.UUID) (mask *models.FishMask, err error) {
+	if aquariumID == uuid.Nil {
+		return nil, ErrBadID
+	}
+
+	if fishID == uuid.Nil {
+		return nil, ErrBadID
+	}
+
+	raw, err := os.ReadFile(filepath.Join(s.basePath, "aquariums", aquariumID.String(), "fishes_masks", fishID.String()+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &models.FishMask{Strokes: []models.MaskStroke{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mask = &models.FishMask{}
+	if err := json.Unmarshal(raw, mask); err != nil {
+		return nil, err
+	}
+	if mask.Strokes == nil {
+		mask.Strokes = []models.MaskStroke{}
+	}
+
+	return mask, nil
+}
+
+// SaveFishMask replaces the mask corrections of a fish
+func (s *Storage) SaveFishMask(aquariumID uuid.UUID, fishID uuid.UUID, mask *models.FishMask) (err error) {
+	if aquariumID == uuid.Nil {
+		return ErrBadID
+	}
+
+	if fishID == uuid.Nil {
+		return ErrBadID
+	}
+
+	path := filepath.Join(s.basePath, "aquariums", aquariumID.String(), "fishes_masks", fishID.String()+".json")
+	return s.save(
+		path,
+		mask,
+	)
+}
+
 // FishImage returns a fish image
 func (s *Storage) FishImage(aquariumID uuid.UUID, fishID uuid.UUID) (img image.Image, err error) {
 	path, err := s.FishImagePath(aquariumID, fishID)
@@ -274,30 +345,44 @@ func (s *Storage) DeleteFish(aquariumID uuid.UUID, fishID uuid.UUID) (err error)
 		return err
 	}
 
-	if err := os.Remove(fishImagePath); err != nil {
+	// fishes still processing have no image yet
+	if err := os.Remove(fishImagePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
 
-	return nil
-}
+	for _, size := range models.ImageVariants {
+		variantPath, err := s.FishImageVariantPath(aquariumID, fishID, size)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(variantPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
 
-func (s *Storage) SaveTmpFishImageFromRequest(aquariumID uuid.UUID, fishID uuid.UUID, file multipart.File, multipartHeader *multipart.FileHeader) (string, error) {
-	if aquariumID == uuid.Nil {
-		return "", ErrBadID
+	// mask corrections
+	fishMaskPath := filepath.Join(s.basePath, "aquariums", aquariumID.String(), "fishes_masks", fishID.String()+".json")
+	if err := os.Remove(fishMaskPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
 	}
 
-	if fishID == uuid.Nil {
+	return nil
+}
+
+// SaveOriginal stores an uploaded image until it is processed and returns its filename
+func (s *Storage) SaveOriginal(jobID uuid.UUID, file multipart.File, multipartHeader *multipart.FileHeader) (string, error) {
+	if jobID == uuid.Nil {
 		return "", ErrBadID
 	}
 
-	tmpFolder := filepath.Join(os.TempDir(), "aquariums", aquariumID.String())
-	if err := os.MkdirAll(tmpFolder, os.ModePerm); err != nil {
+	originalsPath := filepath.Join(s.basePath, "originals")
+	if err := os.MkdirAll(originalsPath, os.ModePerm); err != nil {
 		return "", err
 	}
 
-	fileName := fishID.String() + filepath.Ext(multipartHeader.Filename)
+	fileName := jobID.String() + filepath.Ext(multipartHeader.Filename)
 
-	out, err := os.Create(filepath.Join(tmpFolder, fileName))
+	out, err := os.Create(filepath.Join(originalsPath, fileName))
 	if err != nil {
 		return "", err
 	}
@@ -307,5 +392,269 @@ func (s *Storage) SaveTmpFishImageFromRequest(aquariumID uuid.UUID, fishID uuid.
 		return "", err
 	}
 
-	return filepath.Join(tmpFolder, fileName), nil
+	return fileName, nil
+}
+
+// OriginalPath returns the path of a stored upload
+func (s *Storage) OriginalPath(filename string) string {
+	return filepath.Join(s.basePath, "originals", filepath.Base(filename))
+}
+
+// DeleteOriginal deletes a stored upload
+func (s *Storage) DeleteOriginal(filename string) error {
+	if err := os.Remove(s.OriginalPath(filename)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// InsertJob inserts or updates a job
+func (s *Storage) InsertJob(job *models.Job) (err error) {
+	if job.ID == uuid.Nil {
+		return ErrBadID
+	}
+
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = time.Now()
+	}
+	job.UpdatedAt = time.Now()
+
+	path := filepath.Join(s.basePath, "jobs", job.ID.String()+".json")
+	if err := s.save(path, job); err != nil {
+		return err
+	}
+
+	return s.indexJob(job)
+}
+
+// indexJob keeps a marker of every job that is not done or failed yet, the queue only reads these
+func (s *Storage) indexJob(job *models.Job) error {
+	path := filepath.Join(s.basePath, "jobs", "open", job.ID.String())
+
+	if job.Status == models.JobStatusDone || job.Status == models.JobStatusFailed {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, nil, os.ModePerm)
+}
+
+// IndexJobs marks the open jobs stored before the index existed
+func (s *Storage) IndexJobs() error {
+	jobs, err := s.Jobs()
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if job.Status == models.JobStatusDone || job.Status == models.JobStatusFailed {
+			continue
+		}
+		if err := s.indexJob(job); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OpenJobs returns the jobs that are not done or failed yet
+func (s *Storage) OpenJobs() (jobs []*models.Job, err error) {
+	files, err := os.ReadDir(filepath.Join(s.basePath, "jobs", "open"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return []*models.Job{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	jobs = []*models.Job{}
+	for _, file := range files {
+		jobID, err := uuid.Parse(file.Name())
+		if err != nil {
+			continue
+		}
+
+		job, err := s.Job(jobID)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// ClaimJob makes this process the only one running the job. A claim not renewed within timeout is taken over,
+// its process is gone. It reports false if another process holds the claim.
+func (s *Storage) ClaimJob(jobID uuid.UUID, timeout time.Duration) (bool, error) {
+	if jobID == uuid.Nil {
+		return false, ErrBadID
+	}
+
+	path := filepath.Join(s.basePath, "jobs", "claims", jobID.String())
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return false, err
+	}
+
+	for {
+		// creating fails if the file exists, only one process gets the claim
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.ModePerm)
+		if err == nil {
+			return true, file.Close()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if time.Since(info.ModTime()) < timeout {
+			return false, nil
+		}
+
+		// the stale claim is linked to a name only the first process taking it over gets, the others
+		// fail or find a newer claim under it
+		stalePath := path + "." + strconv.FormatInt(info.ModTime().UnixNano(), 10) + ".stale"
+		if err := os.Link(path, stalePath); err != nil {
+			if errors.Is(err, fs.ErrExist) || errors.Is(err, fs.ErrNotExist) {
+				return false, nil
+			}
+			return false, err
+		}
+		stale, err := os.Stat(stalePath)
+		if err != nil || !stale.ModTime().Equal(info.ModTime()) {
+			os.Remove(stalePath)
+			return false, err
+		}
+
+		err = os.Remove(path)
+		os.Remove(stalePath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+	}
+}
+
+// RenewJobClaim tells the other processes the claim of the job is still held
+func (s *Storage) RenewJobClaim(jobID uuid.UUID) error {
+	now := time.Now()
+	return os.Chtimes(filepath.Join(s.basePath, "jobs", "claims", jobID.String()), now, now)
+}
+
+// ReleaseJob gives up the claim of the job
+func (s *Storage) ReleaseJob(jobID uuid.UUID) error {
+	if err := os.Remove(filepath.Join(s.basePath, "jobs", "claims", jobID.String())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+// Job returns a job
+func (s *Storage) Job(jobID uuid.UUID) (job *models.Job, err error) {
+	if jobID == uuid.Nil {
+		return nil, ErrBadID
+	}
+
+	raw, err := os.ReadFile(filepath.Join(s.basePath, "jobs", jobID.String()+".json"))
+	if err != nil {
+		return nil, err
+	}
+
+	job = &models.Job{}
+	if err := json.Unmarshal(raw, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Jobs returns all jobs
+func (s *Storage) Jobs() (jobs []*models.Job, err error) {
+	jobsPath := filepath.Join(s.basePath, "jobs")
+
+	if err := os.MkdirAll(jobsPath, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(jobsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs = []*models.Job{}
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(jobsPath, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		job := &models.Job{}
+		if err := json.Unmarshal(raw, job); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// Secret returns the random secret with the given name, it is created on first use.
+// Servers sharing the data directory share their secrets.
+func (s *Storage) Secret(name string) ([]byte, error) {
+	path := filepath.Join(s.basePath, "secrets", filepath.Base(name))
+
+	secret, err := os.ReadFile(path)
+	if err == nil {
+		return secret, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	// the first server wins if several start at the same time, link never replaces an existing file
+	tmpPath := path + "." + uuid.NewString() + ".tmp"
+	if err := os.WriteFile(tmpPath, secret, 0o600); err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpPath)
+
+	if err := os.Link(tmpPath, path); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return os.ReadFile(path)
+		}
+		return nil, err
+	}
+
+	return secret, nil
 }
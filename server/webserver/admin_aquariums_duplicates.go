@@ -0,0 +1,45 @@
+package webserver
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+)
+
+func (ws *WebServer) setAdminDuplicatePolicy(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// find aquarium
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	policy := models.DuplicatePolicy(r.FormValue("policy"))
+	switch policy {
+	case models.DuplicatePolicyOff, models.DuplicatePolicyFlag, models.DuplicatePolicyReject, models.DuplicatePolicyMerge:
+	default:
+		http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	aquarium.DuplicatePolicy = policy
+
+	if err := ws.storage.InsertAquarium(aquarium); err != nil {
+		ws.log.Error("Failed to save aquarium", slog.String("error", err.Error()))
+	} else {
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(aquarium))
+	}
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+}
@@ -0,0 +1,59 @@
+package webserver
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+)
+
+func (ws *WebServer) setAdminNamePolicy(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// find aquarium
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	maxLength, err := strconv.Atoi(r.FormValue("max_length"))
+	if err != nil || maxLength < 0 {
+		maxLength = 0
+	}
+
+	aquarium.NamePolicy.MaxLength = maxLength
+	aquarium.NamePolicy.Deny = parseWords(r.FormValue("deny"))
+	aquarium.NamePolicy.Allow = parseWords(r.FormValue("allow"))
+
+	if err := ws.storage.InsertAquarium(aquarium); err != nil {
+		ws.log.Error("Failed to save aquarium", slog.String("error", err.Error()))
+	} else {
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(aquarium))
+	}
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+}
+
+// parseWords splits a list of words separated by commas or new lines
+func parseWords(value string) []string {
+	words := []string{}
+	for _, word := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == '\n' || r == '\r'
+	}) {
+		if word = strings.TrimSpace(word); word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -3,9 +3,11 @@ package webserver
 import (
 	"log/slog"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
 )
 
 func (ws *WebServer) toggleAdminNeedApproval(w http.ResponseWriter, r *http.Request) {
@@ -32,5 +34,43 @@ func (ws *WebServer) toggleAdminNeedApproval(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(aquarium))
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+}
+
+// maxAquariumNameLength limits the aquarium name, it has to fit on fish cards
+const maxAquariumNameLength = 64
+
+func (ws *WebServer) renameAdminAquarium(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// find aquarium
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	name := strings.Join(strings.Fields(r.FormValue("name")), " ")
+	if runes := []rune(name); len(runes) > maxAquariumNameLength {
+		name = string(runes[:maxAquariumNameLength])
+	}
+	aquarium.Name = name
+
+	if err := ws.storage.InsertAquarium(aquarium); err != nil {
+		ws.log.Error("Failed to save aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(aquarium))
+
 	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
 }
@@ -6,6 +6,9 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/names"
+	"github.com/superbarne/fish/sim"
 )
 
 func (ws *WebServer) showAdminAquarium(w http.ResponseWriter, r *http.Request) {
@@ -30,8 +33,14 @@ func (ws *WebServer) showAdminAquarium(w http.ResponseWriter, r *http.Request) {
 	}
 
 	ws.tmpl.ExecuteTemplate(w, "admin_aquarium.html", map[string]interface{}{
-		"Aquarium": aquarium,
-		"Fishes":   fishes,
-		"Revision": ws.gitCommit,
+		"Aquarium":            aquarium,
+		"Fishes":              fishes,
+		"Duplicates":          imageprocess.DuplicateGroups(fishes),
+		"DefaultNameLength":   names.DefaultMaxLength,
+		"DefaultBoidsPerFish": sim.DefaultBoidsPerFish,
+		"MaxBoidsPerFish":     sim.MaxBoidsPerFish,
+		"Viewers":             ws.viewers.list(aquariumID),
+		"Error":               r.URL.Query().Get("error"),
+		"Revision":            ws.gitCommit,
 	})
 }
@@ -0,0 +1,60 @@
+package webserver
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/sim"
+)
+
+// setAdminSimulation turns the simulation on the server on or off, an empty seed picks a random one
+func (ws *WebServer) setAdminSimulation(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// find aquarium
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	if r.FormValue("enabled") == "" {
+		aquarium.Simulation = nil
+	} else {
+		seed := rand.Uint64() >> 11
+		if value := r.FormValue("seed"); value != "" {
+			if seed, err = strconv.ParseUint(value, 10, 64); err != nil {
+				http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+				return
+			}
+		}
+
+		boids, err := strconv.Atoi(r.FormValue("boids_per_fish"))
+		if err != nil || boids <= 0 || boids > sim.MaxBoidsPerFish {
+			http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+			return
+		}
+
+		aquarium.Simulation = &models.Simulation{Seed: seed, BoidsPerFish: boids}
+	}
+
+	if err := ws.storage.InsertAquarium(aquarium); err != nil {
+		ws.log.Error("Failed to save aquarium", slog.String("error", err.Error()))
+	} else {
+		// running simulations and displays follow the settings
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(aquarium))
+	}
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+}
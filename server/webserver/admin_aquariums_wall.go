@@ -0,0 +1,56 @@
+package webserver
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+)
+
+// maxWallSlots limits the displays of a wall
+const maxWallSlots = 64
+
+// setAdminWall splits the aquarium over columns × rows displays, zero columns or rows remove the wall
+func (ws *WebServer) setAdminWall(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	// find aquarium
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	columns, _ := strconv.Atoi(r.FormValue("columns"))
+	rows, _ := strconv.Atoi(r.FormValue("rows"))
+	width, _ := strconv.Atoi(r.FormValue("width"))
+	height, _ := strconv.Atoi(r.FormValue("height"))
+
+	switch {
+	case columns <= 0 || rows <= 0:
+		aquarium.Wall = nil
+	case columns*rows > maxWallSlots || width <= 0 || height <= 0 || width > 16384 || height > 16384:
+		http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+		return
+	default:
+		aquarium.Wall = models.NewWall(columns, rows, width, height)
+	}
+
+	if err := ws.storage.InsertAquarium(aquarium); err != nil {
+		ws.log.Error("Failed to save aquarium", slog.String("error", err.Error()))
+	} else {
+		// displays get their new viewports
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewAquariumEvent(aquarium))
+	}
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
 )
 
 func (ws *WebServer) approveAdminFish(w http.ResponseWriter, r *http.Request) {
@@ -45,6 +46,9 @@ func (ws *WebServer) approveAdminFish(w http.ResponseWriter, r *http.Request) {
 	if fish.Approved {
 		now := time.Now()
 		fish.ApprovedAt = &now
+		// the moderator decided it is no duplicate and the name is fine
+		fish.DuplicateOf = nil
+		fish.NameFlagged = false
 	}
 
 	// save
@@ -56,10 +60,10 @@ func (ws *WebServer) approveAdminFish(w http.ResponseWriter, r *http.Request) {
 
 	if fish.Approved {
 		// publish
-		ws.pubsub.Publish("aquarium:"+aquariumID.String(), fish)
+		ws.pubsub.Publish(models.AquariumTopic(aquariumID), models.NewFishEvent(models.EventFishJoin, fish))
 	} else {
 		// delete fish from aquarium
-		ws.pubsub.Publish("aquarium:"+aquariumID.String()+":delete", fish)
+		ws.pubsub.Publish(models.AquariumTopic(aquariumID), models.NewFishEvent(models.EventFishLeft, fish))
 	}
 
 	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
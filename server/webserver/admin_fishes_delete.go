@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
 )
 
 func (ws *WebServer) deleteAdminFish(w http.ResponseWriter, r *http.Request) {
@@ -38,16 +39,31 @@ func (ws *WebServer) deleteAdminFish(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// delete fish
-	err = ws.storage.DeleteFish(aquarium.ID, fishID)
-	if err != nil {
+	if err := ws.deleteFish(fish); err != nil {
 		ws.log.Error("Failed to delete fish", slog.String("error", err.Error()))
 		http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
 		return
 	}
 
-	// pubsub
-	ws.pubsub.Publish("aquarium:"+aquariumID.String()+":delete", fish)
-
 	http.Redirect(w, r, "/admin/aquarium/"+aquarium.ID.String(), http.StatusSeeOther)
 }
+
+// deleteFish removes fish from the storage, the displays and its upload
+func (ws *WebServer) deleteFish(fish *models.Fish) error {
+	if err := ws.storage.DeleteFish(fish.AquariumID, fish.ID); err != nil {
+		return err
+	}
+
+	ws.pubsub.Publish(models.AquariumTopic(fish.AquariumID), models.NewFishEvent(models.EventFishLeft, fish))
+
+	// reprocessing the upload must not bring it back
+	if fish.UploadID == uuid.Nil {
+		return nil
+	}
+	job, err := ws.storage.Job(fish.UploadID)
+	if err != nil {
+		return nil
+	}
+	job.DeleteFish(fish.ID)
+	return ws.storage.InsertJob(job)
+}
@@ -0,0 +1,34 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// getAdminFishImage serves the image of every fish, also the ones waiting for approval
+func (ws *WebServer) getAdminFishImage(w http.ResponseWriter, r *http.Request) {
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	fishID, err := uuid.Parse(chi.URLParam(r, "fishID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	fish, err := ws.storage.Fish(aquariumID, fishID)
+	if err != nil || fish.AquariumID != aquariumID {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	ws.serveFishImage(w, r, fish)
+}
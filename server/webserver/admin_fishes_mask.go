@@ -0,0 +1,108 @@
+package webserver
+
+import (
+	"encoding/json"
+	"image/png"
+	"log/slog"
+	"net/http"
+
+	"github.com/superbarne/fish/jobs"
+	"github.com/superbarne/fish/models"
+)
+
+func (ws *WebServer) showAdminFishMask(w http.ResponseWriter, r *http.Request) {
+	fish, job, err := ws.fishJob(r)
+	if err != nil && fish == nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	mask, err := ws.storage.FishMask(fish.AquariumID, fish.ID)
+	if err != nil {
+		ws.log.Error("Failed to get strokes", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin/aquarium/"+fish.AquariumID.String(), http.StatusSeeOther)
+		return
+	}
+
+	ws.tmpl.ExecuteTemplate(w, "admin_fish_mask.html", map[string]interface{}{
+		"Fish":     fish,
+		"Job":      job,
+		"Strokes":  mask.Strokes,
+		"Revision": ws.gitCommit,
+	})
+}
+
+// getAdminFishSource returns the unmasked part of the original the fish was cut from
+func (ws *WebServer) getAdminFishSource(w http.ResponseWriter, r *http.Request) {
+	fish, job, err := ws.fishJob(r)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	slot, ok := job.Slot(fish.ID)
+	_, _, sources, err := jobs.ExtractFishes(ws.storage, job, ws.log)
+	if err != nil || !ok || slot >= len(sources) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, sources[slot])
+}
+
+// saveAdminFishMask stores the strokes of the moderator and regenerates the fish image
+func (ws *WebServer) saveAdminFishMask(w http.ResponseWriter, r *http.Request) {
+	fish, job, err := ws.fishJob(r)
+	if err != nil {
+		http.Error(w, "Fish has no original image", http.StatusNotFound)
+		return
+	}
+
+	// the worker would save the job over the new queue entry and the strokes would not be applied
+	if job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning {
+		http.Error(w, "Job is busy", http.StatusConflict)
+		return
+	}
+
+	body := struct {
+		Strokes []models.MaskStroke `json:"strokes"`
+	}{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 5<<20)).Decode(&body); err != nil {
+		http.Error(w, "Invalid strokes", http.StatusBadRequest)
+		return
+	}
+
+	for _, stroke := range body.Strokes {
+		if stroke.Mode != models.MaskStrokeKeep && stroke.Mode != models.MaskStrokeRemove {
+			http.Error(w, "Invalid stroke mode", http.StatusBadRequest)
+			return
+		}
+	}
+
+	aquarium, err := ws.storage.Aquarium(fish.AquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Error(w, "Failed to get aquarium", http.StatusInternalServerError)
+		return
+	}
+
+	// the strokes fit the fish as the current settings cut it, the processor drops them when the settings change
+	settings := jobs.Settings(aquarium, job)
+	if err := ws.storage.SaveFishMask(fish.AquariumID, fish.ID, &models.FishMask{Settings: &settings, Strokes: body.Strokes}); err != nil {
+		ws.log.Error("Failed to save strokes", slog.String("error", err.Error()))
+		http.Error(w, "Failed to save strokes", http.StatusInternalServerError)
+		return
+	}
+
+	// the processor applies the strokes and publishes the update
+	if err := ws.jobs.Enqueue(job); err != nil {
+		ws.log.Error("Failed to queue job", slog.String("error", err.Error()))
+		http.Error(w, "Failed to queue job", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
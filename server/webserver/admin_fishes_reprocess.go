@@ -0,0 +1,241 @@
+package webserver
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/jobs"
+	"github.com/superbarne/fish/models"
+)
+
+// fishJob returns a fish and the upload job it was created by
+func (ws *WebServer) fishJob(r *http.Request) (*models.Fish, *models.Job, error) {
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fishID, err := uuid.Parse(chi.URLParam(r, "fishID"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fish, err := ws.storage.Fish(aquariumID, fishID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// fishes from before the job queue have no upload
+	if fish.UploadID == uuid.Nil {
+		return fish, nil, jobs.ErrNoOriginal
+	}
+
+	job, err := ws.storage.Job(fish.UploadID)
+	if err != nil {
+		return fish, nil, err
+	}
+
+	return fish, job, nil
+}
+
+// parseProcessSettings reads the settings form: threshold in percent, seeds as "x,y x,y" and crop as "x,y,w,h"
+func parseProcessSettings(r *http.Request) (models.ProcessSettings, error) {
+	settings := models.ProcessSettings{}
+
+	switch r.FormValue("mode") {
+	case "split":
+		split := true
+		settings.Split = &split
+	case "single":
+		split := false
+		settings.Split = &split
+	}
+
+	if raw := r.FormValue("threshold"); raw != "" {
+		threshold, err := strconv.ParseFloat(raw, 64)
+		if err != nil || threshold < 0 || threshold > 100 {
+			return settings, errors.New("invalid threshold")
+		}
+		settings.Threshold = threshold / 100
+	}
+
+	for _, raw := range strings.Fields(r.FormValue("seeds")) {
+		values, err := parseInts(raw, 2)
+		if err != nil {
+			return settings, errors.New("invalid seed")
+		}
+		settings.Seeds = append(settings.Seeds, image.Pt(values[0], values[1]))
+	}
+
+	if raw := strings.TrimSpace(r.FormValue("crop")); raw != "" {
+		values, err := parseInts(raw, 4)
+		if err != nil {
+			return settings, errors.New("invalid crop")
+		}
+		settings.Crop = image.Rect(values[0], values[1], values[0]+values[2], values[1]+values[3])
+	}
+
+	return settings, nil
+}
+
+func parseInts(raw string, n int) ([]int, error) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != n {
+		return nil, errors.New("wrong number of values")
+	}
+
+	values := make([]int, n)
+	for i, part := range parts {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	return values, nil
+}
+
+func (ws *WebServer) showAdminFishReprocess(w http.ResponseWriter, r *http.Request) {
+	fish, job, err := ws.fishJob(r)
+	if err != nil && fish == nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	ws.tmpl.ExecuteTemplate(w, "admin_fish_reprocess.html", map[string]interface{}{
+		"Fish":     fish,
+		"Job":      job,
+		"Revision": ws.gitCommit,
+	})
+}
+
+func (ws *WebServer) getAdminFishOriginal(w http.ResponseWriter, r *http.Request) {
+	_, job, err := ws.fishJob(r)
+	if err != nil || job.Original == "" {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	http.ServeFile(w, r, ws.storage.OriginalPath(job.Original))
+}
+
+// getAdminFishPreview runs the pipeline with the given settings without saving anything
+func (ws *WebServer) getAdminFishPreview(w http.ResponseWriter, r *http.Request) {
+	_, job, err := ws.fishJob(r)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	job.Settings, err = parseProcessSettings(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, images, _, err := jobs.ExtractFishes(ws.storage, job, ws.log)
+	if err != nil {
+		ws.log.Error("Failed to process preview", slog.String("error", err.Error()))
+		http.Error(w, "Failed to process image", http.StatusInternalServerError)
+		return
+	}
+
+	// all fishes of the upload side by side
+	const gap = 20
+	width, height := -gap, 0
+	for _, img := range images {
+		width += img.Bounds().Dx() + gap
+		height = max(height, img.Bounds().Dy())
+	}
+
+	dc := gg.NewContext(width, height)
+	x := 0
+	for _, img := range images {
+		dc.DrawImage(img, x, 0)
+		x += img.Bounds().Dx() + gap
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, dc.Image())
+}
+
+// reprocessAdminFish queues the upload of the fish again with new settings
+func (ws *WebServer) reprocessAdminFish(w http.ResponseWriter, r *http.Request) {
+	fish, job, err := ws.fishJob(r)
+	if err != nil {
+		if fish == nil {
+			http.Redirect(w, r, "/admin", http.StatusSeeOther)
+			return
+		}
+		ws.log.Error("Failed to get job of fish", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin/aquarium/"+fish.AquariumID.String(), http.StatusSeeOther)
+		return
+	}
+
+	// the worker would overwrite the settings and process the upload twice
+	if job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning {
+		http.Redirect(w, r, "/admin/aquarium/"+fish.AquariumID.String()+"?error=busy", http.StatusSeeOther)
+		return
+	}
+
+	job.Settings, err = parseProcessSettings(r)
+	if err != nil {
+		http.Redirect(w, r, "/admin/aquarium/"+fish.AquariumID.String()+"/fishes/"+fish.ID.String()+"/reprocess", http.StatusSeeOther)
+		return
+	}
+
+	if err := ws.jobs.Enqueue(job); err != nil {
+		ws.log.Error("Failed to queue job", slog.String("error", err.Error()))
+	}
+
+	http.Redirect(w, r, "/admin/aquarium/"+fish.AquariumID.String(), http.StatusSeeOther)
+}
+
+// reprocessAdminAquarium queues all uploads of the aquarium with their stored settings
+func (ws *WebServer) reprocessAdminAquarium(w http.ResponseWriter, r *http.Request) {
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	uploads, err := ws.storage.Jobs()
+	if err != nil {
+		ws.log.Error("Failed to get jobs", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/admin/aquarium/"+aquariumID.String(), http.StatusSeeOther)
+		return
+	}
+
+	busy := false
+	for _, job := range uploads {
+		if job.AquariumID != aquariumID || job.Original == "" {
+			continue
+		}
+		if job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning {
+			busy = true
+			continue
+		}
+
+		if err := ws.jobs.Enqueue(job); err != nil {
+			ws.log.Error("Failed to queue job", slog.String("job", job.ID.String()), slog.String("error", err.Error()))
+		}
+	}
+
+	if busy {
+		http.Redirect(w, r, "/admin/aquarium/"+aquariumID.String()+"?error=busy", http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquariumID.String(), http.StatusSeeOther)
+}
@@ -0,0 +1,75 @@
+package webserver
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+func TestAdminFishUpload(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	job := &models.Job{ID: uuid.New(), AquariumID: aquarium.ID, Original: "fish.png", Status: models.JobStatusRunning}
+	fishes := []*models.Fish{
+		{ID: uuid.New(), AquariumID: aquarium.ID, UploadID: job.ID},
+		{ID: uuid.New(), AquariumID: aquarium.ID, UploadID: job.ID},
+	}
+	for _, fish := range fishes {
+		require.NoError(t, store.InsertFish(aquarium.ID, fish))
+		job.FishIDs = append(job.FishIDs, fish.ID)
+	}
+	require.NoError(t, store.InsertJob(job))
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	post := func(path string, values url.Values) string {
+		res, err := client.PostForm(server.URL+"/admin/aquarium/"+aquarium.ID.String()+path, values)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusSeeOther, res.StatusCode)
+		return res.Header.Get("Location")
+	}
+
+	// a running upload keeps its settings
+	aquariumPath := "/admin/aquarium/" + aquarium.ID.String()
+	assert.Equal(t, aquariumPath+"?error=busy", post("/fishes/"+fishes[0].ID.String()+"/reprocess", url.Values{"threshold": {"40"}}))
+	assert.Equal(t, aquariumPath+"?error=busy", post("/reprocess", nil))
+	stored, err := store.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusRunning, stored.Status)
+	assert.Zero(t, stored.Settings.Threshold)
+
+	// and the moderator saves the mask again when it is done
+	res, err := client.Post(server.URL+aquariumPath+"/fishes/"+fishes[0].ID.String()+"/mask", "application/json", strings.NewReader(`{"strokes":[]}`))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusConflict, res.StatusCode)
+	mask, err := store.FishMask(aquarium.ID, fishes[0].ID)
+	require.NoError(t, err)
+	assert.Nil(t, mask.Settings)
+
+	// done uploads are queued again
+	job.Status = models.JobStatusDone
+	require.NoError(t, store.InsertJob(job))
+	assert.Equal(t, aquariumPath, post("/fishes/"+fishes[0].ID.String()+"/reprocess", url.Values{"threshold": {"40"}}))
+	stored, err = store.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusPending, stored.Status)
+	assert.Equal(t, 0.4, stored.Settings.Threshold)
+
+	// a deleted fish is not created again by the upload
+	assert.Equal(t, aquariumPath, post("/fishes/"+fishes[1].ID.String()+"/delete", nil))
+	stored, err = store.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{fishes[0].ID}, stored.FishIDs)
+}
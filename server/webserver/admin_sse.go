@@ -0,0 +1,60 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/superbarne/fish/models"
+)
+
+// sseAdmin sends the events of all aquariums for the Admin Panel, including fishes waiting for approval
+func (ws *WebServer) sseAdmin(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	sub := ws.pubsub.Subscribe(models.AllAquariumsTopic, ctx, 100)
+	defer sub.Close()
+
+	fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
+	flusher.Flush()
+
+	var dropped uint64
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
+			flusher.Flush()
+		case event, ok := <-sub.C:
+			if !ok {
+				fmt.Fprintf(w, "retry: 2000\nevent: restarting\ndata: {\"reason\":\"server restarting\"}\n\n")
+				flusher.Flush()
+				return
+			}
+
+			// the dashboard only shows a log, it is told about gaps but needs no snapshot
+			if n := sub.Dropped(); n > dropped {
+				fmt.Fprintf(w, "event: resync\ndata: {\"dropped\":%d}\n\n", n-dropped)
+				dropped = n
+			}
+
+			raw, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, raw)
+			flusher.Flush()
+		}
+	}
+}
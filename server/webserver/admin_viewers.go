@@ -0,0 +1,38 @@
+package webserver
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+)
+
+// commandAdminViewer reloads or disconnects a viewer, the command reaches it on every server
+func (ws *WebServer) commandAdminViewer(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+
+	viewerID, err := uuid.Parse(chi.URLParam(r, "viewerID"))
+	if err != nil {
+		http.Redirect(w, r, "/admin/aquarium/"+aquariumID.String(), http.StatusSeeOther)
+		return
+	}
+
+	action, ok := models.ParseViewerAction(chi.URLParam(r, "action"))
+	if !ok {
+		http.Redirect(w, r, "/admin/aquarium/"+aquariumID.String(), http.StatusSeeOther)
+		return
+	}
+
+	ws.pubsub.Publish(models.AquariumTopic(aquariumID), models.NewViewerCommandEvent(aquariumID, &models.ViewerCommand{
+		ViewerID: viewerID,
+		Action:   action,
+	}))
+
+	http.Redirect(w, r, "/admin/aquarium/"+aquariumID.String()+"#viewers", http.StatusSeeOther)
+}
@@ -0,0 +1,97 @@
+package webserver
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/snapshot"
+)
+
+// getAquariumSnapshot serves a picture (png) or a loop (gif) of the approved fishes of the aquarium.
+// The public always gets the layout of the aquarium, every other seed is a render of its own.
+func (ws *WebServer) getAquariumSnapshot(format snapshot.Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("404 not found"))
+			return
+		}
+
+		if r.URL.Query().Has("seed") {
+			forbidden(w)
+			return
+		}
+
+		ws.serveSnapshot(w, r, aquariumID, snapshot.DefaultSeed(aquariumID), format)
+	}
+}
+
+// getAdminAquariumSnapshot is the snapshot of the aquarium for moderators, ?seed= picks another layout
+func (ws *WebServer) getAdminAquariumSnapshot(format snapshot.Format) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("404 not found"))
+			return
+		}
+
+		seed := snapshot.DefaultSeed(aquariumID)
+		if value := r.URL.Query().Get("seed"); value != "" {
+			if seed, err = strconv.ParseUint(value, 10, 64); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte("400 bad request"))
+				return
+			}
+		}
+
+		ws.serveSnapshot(w, r, aquariumID, seed, format)
+	}
+}
+
+// serveSnapshot renders the aquarium with seed if the cached render is outdated and serves it
+func (ws *WebServer) serveSnapshot(w http.ResponseWriter, r *http.Request, aquariumID uuid.UUID, seed uint64, format snapshot.Format) {
+	// find aquarium
+	if _, err := ws.storage.Aquarium(aquariumID); err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	path, revision, err := ws.snapshots.Render(aquariumID, seed, format)
+	if err != nil {
+		ws.log.Error("Failed to render snapshot", slog.String("aquarium", aquariumID.String()), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 internal server error"))
+		return
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		// replaced by a newer revision in the meantime
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("503 service unavailable"))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 internal server error"))
+		return
+	}
+
+	// the revision changes with the fishes, clients revalidate
+	w.Header().Set("Content-Type", "image/"+string(format))
+	w.Header().Set("Content-Disposition", `inline; filename="aquarium-`+aquariumID.String()+`.`+string(format)+`"`)
+	w.Header().Set("ETag", `"`+revision+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
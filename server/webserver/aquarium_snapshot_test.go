@@ -0,0 +1,33 @@
+package webserver
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+func TestSnapshotSeed(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	status := func(path string) int {
+		res, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	// the public gets the layout of the aquarium, other layouts are rendered for moderators only
+	assert.Equal(t, http.StatusOK, status("/aquarium/"+aquarium.ID.String()+"/snapshot.png"))
+	assert.Equal(t, http.StatusForbidden, status("/aquarium/"+aquarium.ID.String()+"/snapshot.png?seed=42"))
+	assert.Equal(t, http.StatusOK, status("/admin/aquarium/"+aquarium.ID.String()+"/snapshot.png?seed=42"))
+	assert.Equal(t, http.StatusBadRequest, status("/admin/aquarium/"+aquarium.ID.String()+"/snapshot.png?seed=x"))
+}
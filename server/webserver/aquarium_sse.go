@@ -3,13 +3,12 @@ package webserver
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/superbarne/fish/models"
 )
 
 func (ws *WebServer) sseAquarium(w http.ResponseWriter, r *http.Request) {
@@ -30,7 +29,6 @@ func (ws *WebServer) sseAquarium(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -41,55 +39,35 @@ func (ws *WebServer) sseAquarium(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+	// EventSource sends the header on reconnects, the query parameter is for other clients
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
 
-	fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
-	flusher.Flush()
+	// ?display= names the display on the Admin Panel
+	ws.streamAquarium(r.Context(), newViewer(r, aquariumID, "sse"), lastEventID, func(msg streamMessage) error {
+		if err := writeSSE(w, msg); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
 
-	// send old fishes
-	fishes, err := ws.storage.Fishes(aquariumID)
+// writeSSE writes msg as SSE event
+func writeSSE(w io.Writer, msg streamMessage) error {
+	raw, err := json.Marshal(msg.Data)
 	if err != nil {
-		ws.log.Error("Failed to get fishes", slog.String("error", err.Error()))
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 internal server error"))
-		return
+		return err
 	}
 
-	for _, fish := range fishes {
-		if !fish.Approved {
-			continue
-		}
-		raw, _ := json.Marshal(fish)
-		fmt.Fprintf(w, "event: fishjoin\ndata: %s\n\n", raw)
+	if msg.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n", msg.Retry)
 	}
-	flusher.Flush()
-
-	// subscribe to new fishes
-	newFishes := ws.pubsub.Subscribe("aquarium:"+aquariumID.String(), ctx, 10)
-	defer ws.pubsub.Unsubscribe("aquarium:"+aquariumID.String(), ctx)
-	deleteFishes := ws.pubsub.Subscribe("aquarium:"+aquariumID.String()+":delete", ctx, 10)
-	defer ws.pubsub.Unsubscribe("aquarium:"+aquariumID.String()+":delete", ctx)
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
-			flusher.Flush()
-		case deleteFishes := <-deleteFishes:
-			raw, _ := json.Marshal(deleteFishes)
-			fmt.Fprintf(w, "event: fishleft\ndata: %s\n\n", raw)
-			flusher.Flush()
-		case fish := <-newFishes:
-			if !fish.(*models.Fish).Approved {
-				continue
-			}
-
-			raw, _ := json.Marshal(fish)
-			fmt.Fprintf(w, "event: fishjoin\ndata: %s\n\n", raw)
-			flusher.Flush()
-		}
+	if msg.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", msg.ID)
 	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Event, raw)
+	return err
 }
@@ -0,0 +1,348 @@
+package webserver
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+)
+
+// simRetryDelay is how long a display simulates the fishes itself after the simulation stopped on an error
+const simRetryDelay = 2 * time.Second
+
+// streamMessage is a message of the aquarium stream, it is sent as SSE event or WebSocket message
+type streamMessage struct {
+	// ID is the event id to resume the stream from, empty if the message has none
+	ID    string      `json:"id,omitempty"`
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+	// Retry asks SSE clients to reconnect after the given milliseconds
+	Retry int `json:"-"`
+}
+
+// streamAquarium sends the fishes of the aquarium of v and then its events until ctx is done,
+// the server shuts down, a moderator ends it or send fails. lastEventID resumes the stream of a reconnecting client.
+func (ws *WebServer) streamAquarium(ctx context.Context, v *viewer, lastEventID string, send func(streamMessage) error) error {
+	aquariumID := v.AquariumID
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	// subscribe before reading the current state, nothing gets lost in between
+	topic := models.AquariumTopic(aquariumID)
+	sub := ws.pubsub.Subscribe(topic, ctx, 10)
+	defer func() { sub.Close() }()
+	// interactions are not numbered for the client, missed ones are gone
+	interactionSub := ws.pubsub.Subscribe(models.InteractionTopic(aquariumID), ctx, 10)
+	defer interactionSub.Close()
+	interactions := interactionSub.C
+
+	if err := send(pingMessage("")); err != nil {
+		return err
+	}
+
+	ws.viewers.join(v)
+	defer ws.viewers.leave(v)
+
+	// displays of a wall claim their slot, the viewport is sent when it is assigned
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		return err
+	}
+	wall := aquarium.Wall
+	ws.viewers.reclaim(v, wallSlots(wall))
+
+	// reconnecting clients only get what they missed
+	lastSeq, resumed, err := ws.resumeStream(topic, lastEventID, send)
+	if err != nil {
+		return err
+	}
+	if !resumed {
+		if lastSeq, err = ws.snapshotStream(aquariumID, send); err != nil {
+			return err
+		}
+	}
+
+	// simulated aquariums send the positions of the boids, the first update is a keyframe
+	updates := ws.sims.Subscribe(ctx, aquarium)
+	simulated := updates != nil
+	// retry subscribes again after the simulation stopped on its own
+	var retry <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := send(pingMessage("")); err != nil {
+				return err
+			}
+			ws.viewers.update(v, func(v *viewer) { v.LastPing = time.Now() })
+		case count := <-v.count:
+			if err := send(streamMessage{Event: "viewers", Data: map[string]int{"count": count}}); err != nil {
+				return err
+			}
+		case slot := <-v.slot:
+			if err := send(viewportMessage(wall, slot)); err != nil {
+				return err
+			}
+		case msg := <-v.direct:
+			if err := send(msg); err != nil {
+				return err
+			}
+		case update, ok := <-updates:
+			if !ok {
+				// the simulation stopped, e.g. it was turned off or failed. The display simulates
+				// the fishes itself until it runs again.
+				updates = nil
+				if !simulated {
+					continue
+				}
+				simulated = false
+				if err := send(streamMessage{Event: "simstop", Data: struct{}{}}); err != nil {
+					return err
+				}
+				if lastSeq, err = ws.snapshotStream(aquariumID, send); err != nil {
+					return err
+				}
+				retry = time.After(simRetryDelay)
+				continue
+			}
+			if update.Keyframe != nil {
+				if err := send(streamMessage{Event: "simkeyframe", Data: update.Keyframe}); err != nil {
+					return err
+				}
+			}
+			if err := send(streamMessage{Event: "simframe", Data: update.Frame}); err != nil {
+				return err
+			}
+		case <-retry:
+			retry = nil
+			if updates != nil {
+				continue
+			}
+			aquarium, err := ws.storage.Aquarium(aquariumID)
+			if err != nil {
+				ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+				retry = time.After(simRetryDelay)
+				continue
+			}
+			// turned off meanwhile, the display keeps simulating
+			if updates = ws.sims.Subscribe(ctx, aquarium); updates != nil {
+				simulated = true
+			}
+		case event, ok := <-interactions:
+			if !ok {
+				// pubsub was closed, the aquarium events end the stream
+				interactions = nil
+				continue
+			}
+			msg := eventMessage(event)
+			msg.ID = ""
+			if err := send(msg); err != nil {
+				return err
+			}
+		case event, ok := <-sub.C:
+			// the client missed events, it starts over with a new snapshot
+			if dropped := sub.Dropped(); dropped > 0 {
+				ws.log.Warn("Aquarium client too slow, resync", slog.String("aquarium", aquariumID.String()), slog.Uint64("dropped", dropped))
+
+				sub.Close()
+				sub = ws.pubsub.Subscribe(topic, ctx, 10)
+
+				if err := send(streamMessage{Event: "resync", Data: map[string]uint64{"dropped": dropped}}); err != nil {
+					return err
+				}
+				if lastSeq, err = ws.snapshotStream(aquariumID, send); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if !ok {
+				// pubsub was closed, the server shuts down
+				return send(streamMessage{Event: "restarting", Data: map[string]string{"reason": "server restarting"}, Retry: 2000})
+			}
+			if event.Sequence <= lastSeq {
+				// already sent with the snapshot or the replay
+				continue
+			}
+			lastSeq = event.Sequence
+
+			// a changed wall needs new slots
+			if event.Aquarium != nil {
+				wall = event.Aquarium.Wall
+				ws.viewers.reclaim(v, wallSlots(wall))
+
+				// the simulation was turned on or off, without it the display simulates the fishes on its own again
+				switch {
+				case event.Aquarium.Simulation != nil && updates == nil:
+					updates = ws.sims.Subscribe(ctx, event.Aquarium)
+					simulated = true
+				case event.Aquarium.Simulation == nil && simulated:
+					updates = nil
+					simulated = false
+					if err := send(streamMessage{Event: "simstop", Data: struct{}{}}); err != nil {
+						return err
+					}
+					if lastSeq, err = ws.snapshotStream(aquariumID, send); err != nil {
+						return err
+					}
+				}
+			}
+
+			if event.Command != nil {
+				if event.Command.ViewerID != v.ID {
+					continue
+				}
+				ws.log.Info("Viewer command", slog.String("viewer", v.ID.String()), slog.String("action", string(event.Command.Action)))
+				send(streamMessage{Event: string(event.Command.Action), Data: struct{}{}})
+				return nil
+			}
+
+			if err := send(eventMessage(event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// snapshotStream sends all fishes of the aquarium and returns the sequence the snapshot is at
+func (ws *WebServer) snapshotStream(aquariumID uuid.UUID, send func(streamMessage) error) (uint64, error) {
+	lastSeq := ws.pubsub.LastSequence(models.AquariumTopic(aquariumID))
+
+	fishes, err := ws.storage.Fishes(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get fishes", slog.String("error", err.Error()))
+		return 0, err
+	}
+
+	for _, fish := range fishes {
+		if !fish.Approved || !fish.Ready() {
+			continue
+		}
+		if err := send(streamMessage{Event: string(models.EventFishJoin), Data: newStreamFish(fish)}); err != nil {
+			return 0, err
+		}
+	}
+
+	// the id of the snapshot, a reconnect continues from here
+	return lastSeq, send(pingMessage(pubsub.EventID(lastSeq)))
+}
+
+// resumeStream sends the events after lastEventID of a reconnecting client.
+// It reports false if the client needs a full snapshot instead.
+func (ws *WebServer) resumeStream(topic string, lastEventID string, send func(streamMessage) error) (uint64, bool, error) {
+	if lastEventID == "" {
+		return 0, false, nil
+	}
+
+	lastSeq, ok := pubsub.ParseEventID(lastEventID)
+	if !ok {
+		return 0, false, nil
+	}
+
+	events, ok := ws.pubsub.Since(topic, lastSeq)
+	if !ok {
+		return 0, false, nil
+	}
+
+	for _, event := range events {
+		if err := send(eventMessage(event)); err != nil {
+			return 0, false, err
+		}
+		lastSeq = event.Sequence
+	}
+
+	return lastSeq, true, nil
+}
+
+// streamFish is a fish as displays see it, the upload it came from stays private to the uploader
+type streamFish struct {
+	*models.Fish
+	UploadID *uuid.UUID `json:"upload_id,omitempty"`
+}
+
+func newStreamFish(fish *models.Fish) streamFish {
+	return streamFish{Fish: fish}
+}
+
+// streamAquariumSettings are the settings displays may see
+type streamAquariumSettings struct {
+	ID           uuid.UUID    `json:"id"`
+	Name         string       `json:"name"`
+	NeedApproval bool         `json:"need_approval"`
+	SplitFishes  bool         `json:"split_fishes"`
+	Wall         *models.Wall `json:"wall,omitempty"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+}
+
+// streamViewport is the part of the wall a display shows, Time is the server time in unix milliseconds
+type streamViewport struct {
+	Slot int `json:"slot"`
+	models.WallSlot
+	CanvasWidth  int   `json:"canvas_width"`
+	CanvasHeight int   `json:"canvas_height"`
+	Time         int64 `json:"time"`
+}
+
+// wallSlots returns the number of slots of wall, zero without wall
+func wallSlots(wall *models.Wall) int {
+	if wall == nil {
+		return 0
+	}
+	return len(wall.Slots)
+}
+
+// viewportMessage tells a display its part of the wall, slot is noSlot for the whole aquarium
+func viewportMessage(wall *models.Wall, slot int) streamMessage {
+	viewport := streamViewport{Slot: noSlot, Time: time.Now().UnixMilli()}
+	if wall != nil && slot >= 0 && slot < len(wall.Slots) {
+		viewport.Slot = slot
+		viewport.WallSlot = wall.Slots[slot]
+		viewport.CanvasWidth = wall.Width
+		viewport.CanvasHeight = wall.Height
+	}
+
+	return streamMessage{Event: "viewport", Data: viewport}
+}
+
+func pingMessage(id string) streamMessage {
+	return streamMessage{ID: id, Event: "ping", Data: struct{}{}}
+}
+
+// eventMessage converts event for displays, events of fishes the public must not see only move the id forward
+func eventMessage(event models.Event) streamMessage {
+	id := pubsub.EventID(event.Sequence)
+
+	switch {
+	case event.Fish != nil:
+		// fishes leave for being flagged too, displays only learn which one
+		if event.Kind == models.EventFishLeft {
+			return streamMessage{ID: id, Event: string(event.Kind), Data: map[string]uuid.UUID{"id": event.Fish.ID}}
+		}
+		if !event.Fish.Approved || !event.Fish.Ready() {
+			return pingMessage(id)
+		}
+		return streamMessage{ID: id, Event: string(event.Kind), Data: newStreamFish(event.Fish)}
+	case event.Aquarium != nil:
+		return streamMessage{ID: id, Event: string(event.Kind), Data: streamAquariumSettings{
+			ID:           event.Aquarium.ID,
+			Name:         event.Aquarium.Name,
+			NeedApproval: event.Aquarium.NeedApproval,
+			SplitFishes:  event.Aquarium.SplitFishes,
+			Wall:         event.Aquarium.Wall,
+			UpdatedAt:    event.Aquarium.UpdatedAt,
+		}}
+	case event.Interaction != nil:
+		return streamMessage{ID: id, Event: string(event.Kind), Data: event.Interaction}
+	case event.Handoff != nil:
+		return streamMessage{ID: id, Event: string(event.Kind), Data: event.Handoff}
+	default:
+		return pingMessage(id)
+	}
+}
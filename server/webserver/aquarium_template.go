@@ -0,0 +1,33 @@
+package webserver
+
+import (
+	"image/png"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+)
+
+func (ws *WebServer) getAquariumTemplate(w http.ResponseWriter, r *http.Request) {
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	// find aquarium
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", `inline; filename="aquarium-`+aquarium.ID.String()+`.png"`)
+	png.Encode(w, imageprocess.RenderTemplate(aquarium.ID))
+}
@@ -1,14 +1,16 @@
 package webserver
 
 import (
+	"errors"
+	"io"
 	"log/slog"
 	"net/http"
-	"os"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/superbarne/fish/imageprocess"
 	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/names"
 )
 
 func (ws *WebServer) uploadAquariumFish(w http.ResponseWriter, r *http.Request) {
@@ -28,78 +30,130 @@ func (ws *WebServer) uploadAquariumFish(w http.ResponseWriter, r *http.Request)
 	}
 
 	if r.Method == http.MethodPost {
-		// Get the file from the request
-		file, multipartHeader, err := r.FormFile("image")
+		job, err := ws.createJob(r, aquarium)
 		if err != nil {
-			ws.log.Error("Failed to get image from request", slog.String("error", err.Error()))
-			http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
+			http.Redirect(w, r, "/aquarium/"+aquarium.ID.String()+"?error="+uploadError(err), http.StatusSeeOther)
 			return
 		}
-		defer file.Close()
 
-		// is file a image
-		if multipartHeader.Header.Get("Content-Type") != "image/png" && multipartHeader.Header.Get("Content-Type") != "image/jpeg" && multipartHeader.Header.Get("Content-Type") != "image/jpg" {
-			ws.log.Error("File is not a image", slog.String("content-type", multipartHeader.Header.Get("Content-Type")))
-			http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
-			return
-		}
+		ws.issueOwnership(w, r, job.ID)
+		http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+		return
+	}
 
-		fishID := uuid.New()
-		tmpFilePath, err := ws.storage.SaveTmpFishImageFromRequest(aquarium.ID, fishID, file, multipartHeader)
+	ws.tmpl.ExecuteTemplate(w, "upload.html", map[string]interface{}{
+		"ID":          aquarium.ID.String(),
+		"Action":      "/aquarium/" + aquarium.ID.String() + "/",
+		"SplitFishes": aquarium.SplitFishes,
+		"Error":       r.URL.Query().Get("error"),
+		"Formats":     imageprocess.Formats,
+		"Revision":    ws.gitCommit,
+	})
+}
+
+// uploadFish accepts photos of printed templates and finds the aquarium by the code on the template
+func (ws *WebServer) uploadFish(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		job, err := ws.createJob(r, nil)
 		if err != nil {
-			ws.log.Error("Failed to save image", slog.String("error", err.Error()))
-			http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
+			http.Redirect(w, r, "/upload?error="+uploadError(err), http.StatusSeeOther)
 			return
 		}
 
-		defer func() {
-			// Remove tmp file
-			if err := os.Remove(tmpFilePath); err != nil {
-				ws.log.Error("Failed to remove temp file", slog.String("error", err.Error()))
-			}
-		}()
+		ws.issueOwnership(w, r, job.ID)
+		http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+		return
+	}
 
-		// Process Image
-		targetPath, err := ws.storage.FishImagePath(aquarium.ID, fishID)
-		if err != nil {
-			ws.log.Error("Failed to get fish image path", slog.String("error", err.Error()))
-			http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
-			return
-		}
-		if err := imageprocess.ProcessImage(tmpFilePath, targetPath, ws.log); err != nil {
-			ws.log.Error("Failed to process image", slog.String("error", err.Error()))
-			http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
-			return
-		}
+	ws.tmpl.ExecuteTemplate(w, "upload.html", map[string]interface{}{
+		"Action":   "/upload",
+		"Error":    r.URL.Query().Get("error"),
+		"Formats":  imageprocess.Formats,
+		"Revision": ws.gitCommit,
+	})
+}
 
-		name := r.FormValue("name")
-		if name == "" {
-			name = "Boid"
-		}
+// uploadError maps errors of createJob to the error shown on the upload page
+func uploadError(err error) string {
+	if errors.Is(err, imageprocess.ErrUnsupportedFormat) {
+		return "format"
+	}
+	return "upload"
+}
+
+// createJob stores the uploaded image and queues its processing. Aquarium may be nil,
+// then the aquarium is taken from the template on the photo.
+func (ws *WebServer) createJob(r *http.Request, aquarium *models.Aquarium) (*models.Job, error) {
+	// Get the file from the request
+	file, multipartHeader, err := r.FormFile("image")
+	if err != nil {
+		ws.log.Error("Failed to get image from request", slog.String("error", err.Error()))
+		return nil, err
+	}
+	defer file.Close()
+
+	// is file a image, browsers do not agree on content types for heic, so look at the content
+	format, err := imageprocess.DetectFormat(file)
+	if err != nil {
+		ws.log.Error("File is not a image", slog.String("content-type", multipartHeader.Header.Get("Content-Type")))
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	ws.log.Debug("Received upload", slog.String("format", format))
+
+	// the name is cleaned with the policy of the aquarium, for template uploads once it is known
+	job := &models.Job{
+		ID:      uuid.New(),
+		Name:    r.FormValue("name"),
+		FishIDs: []uuid.UUID{},
+		Slots:   []int{},
+	}
+
+	switch r.FormValue("mode") {
+	case "split":
+		split := true
+		job.Settings.Split = &split
+	case "single":
+		split := false
+		job.Settings.Split = &split
+	}
+
+	job.Original, err = ws.storage.SaveOriginal(job.ID, file, multipartHeader)
+	if err != nil {
+		ws.log.Error("Failed to save image", slog.String("error", err.Error()))
+		return nil, err
+	}
+
+	// the fish is visible in the admin panel while it is processed
+	if aquarium != nil {
+		job.AquariumID = aquarium.ID
 
-		// Write Json with metadata about the uploaded file
+		name, flagged := names.Moderate(job.Name, aquarium.NamePolicy)
 		fish := &models.Fish{
-			ID:         fishID,
-			AquariumID: aquarium.ID,
-			Name:       name,
-			Filename:   fishID.String() + ".png",
-			Approved:   !aquarium.NeedApproval, // if need approval true, set fish approved value to false
+			ID:          uuid.New(),
+			AquariumID:  aquarium.ID,
+			UploadID:    job.ID,
+			Name:        name,
+			Status:      models.FishStatusProcessing,
+			NameFlagged: flagged,
+			Approved:    !aquarium.NeedApproval && !flagged, // flagged names always need approval
 		}
 
-		if err := ws.storage.InsertFish(aquariumID, fish); err != nil {
+		if err := ws.storage.InsertFish(aquarium.ID, fish); err != nil {
 			ws.log.Error("Failed to save fish", slog.String("error", err.Error()))
-			http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
-			return
+			return nil, err
 		}
 
-		ws.pubsub.Publish("aquarium:"+aquariumID.String(), fish)
+		// the first drawing on the sheet
+		job.AddFish(fish.ID, 0)
+	}
 
-		http.Redirect(w, r, "/aquarium/"+aquariumID.String(), http.StatusSeeOther)
-		return
+	if err := ws.jobs.Enqueue(job); err != nil {
+		ws.log.Error("Failed to queue job", slog.String("error", err.Error()))
+		return nil, err
 	}
 
-	ws.tmpl.ExecuteTemplate(w, "upload.html", map[string]interface{}{
-		"ID":       aquarium.ID.String(),
-		"Revision": ws.gitCommit,
-	})
+	return job, nil
 }
@@ -0,0 +1,36 @@
+package webserver
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+func TestUploadNamePolicy(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New(), NamePolicy: models.NamePolicy{MaxLength: 40}}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	// longer than the default length, but within the policy of the aquarium
+	name := "Wanda die wunderbare Regenbogenforelle"
+	body, contentType := imageForm(t, "  "+name+"  ")
+	res, err := client.Post(server.URL+"/aquarium/"+aquarium.ID.String()+"/", contentType, body)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	job, err := store.Job(uuid.MustParse(strings.TrimPrefix(res.Header.Get("Location"), "/uploads/")))
+	require.NoError(t, err)
+	fish, err := store.Fish(aquarium.ID, job.FishIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, name, fish.Name)
+}
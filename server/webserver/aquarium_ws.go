@@ -0,0 +1,232 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/names"
+)
+
+const (
+	// wsWriteWait is the time a client has to take a message
+	wsWriteWait = 10 * time.Second
+	// wsPongWait is the time a client has to answer a ping, pings are sent a bit more often
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	// wsMaxMessageSize is the largest message a client may send
+	wsMaxMessageSize = 4096
+	// wsInteractionInterval is the shortest time between two interactions of a client
+	wsInteractionInterval = 200 * time.Millisecond
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// displays run on other hosts, like for SSE all origins are allowed
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsClientMessage is a message from a client
+type wsClientMessage struct {
+	// Type is register, viewport, claim, time, handoff, feed or tap
+	Type string `json:"type"`
+	// Slot is the wall slot a display claims, without slot the first free one
+	Slot *int `json:"slot"`
+	// Client is the time of the client a time request was sent at
+	Client int64 `json:"client"`
+	// Handoff is a boid leaving the viewport of the display
+	Handoff models.Handoff `json:"handoff"`
+	// Display is the name of a registering display
+	Display string `json:"display"`
+	// Width and Height are the viewport of the client in pixels
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// FishID is the tapped fish, X and Y where the client interacted, 0..1 from the top left corner
+	FishID uuid.UUID `json:"fish_id"`
+	X      float64   `json:"x"`
+	Y      float64   `json:"y"`
+}
+
+func (ws *WebServer) wsAquarium(w http.ResponseWriter, r *http.Request) {
+	// validate id
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	// find aquarium
+	_, err = ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader answered already
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	v := newViewer(r, aquariumID, "ws")
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		ws.viewers.update(v, func(v *viewer) { v.LastPing = time.Now() })
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	// the stream ends when the client is gone
+	go func() {
+		defer cancel()
+		ws.readWS(conn, v)
+	}()
+
+	go func() {
+		ticker := time.NewTicker(wsPingPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	ws.streamAquarium(ctx, v, r.URL.Query().Get("lastEventId"), func(msg streamMessage) error {
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(msg)
+	})
+
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(wsWriteWait))
+}
+
+// readWS handles the messages of the client of v until the connection fails
+func (ws *WebServer) readWS(conn *websocket.Conn, v *viewer) {
+	var lastInteraction, lastHandoff time.Time
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				ws.log.Debug("WebSocket closed", slog.String("viewer", v.ID.String()), slog.String("error", err.Error()))
+			}
+			return
+		}
+
+		var msg wsClientMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			ws.log.Debug("Invalid WebSocket message", slog.String("viewer", v.ID.String()), slog.String("error", err.Error()))
+			continue
+		}
+
+		switch msg.Type {
+		case "register":
+			display := names.Clean(msg.Display, names.DefaultMaxLength)
+			ws.viewers.update(v, func(v *viewer) { v.Display = display })
+			ws.log.Info("Display registered", slog.String("aquarium", v.AquariumID.String()), slog.String("viewer", v.ID.String()), slog.String("display", display))
+		case "viewport":
+			if msg.Width <= 0 || msg.Height <= 0 || msg.Width > 16384 || msg.Height > 16384 {
+				continue
+			}
+			ws.viewers.update(v, func(v *viewer) { v.Width, v.Height = msg.Width, msg.Height })
+		case "claim":
+			ws.claimWS(v, msg)
+		case "time":
+			// the client estimates the offset of its clock with the round trip time
+			ws.viewers.send(v, streamMessage{Event: "time", Data: map[string]int64{
+				"client": msg.Client,
+				"server": time.Now().UnixMilli(),
+			}})
+		case "handoff":
+			// only displays on the wall hand boids over, and not faster than phones interact
+			from := ws.viewers.slotOf(v)
+			if from == noSlot || time.Since(lastHandoff) < wsInteractionInterval {
+				continue
+			}
+			lastHandoff = time.Now()
+
+			ws.handoffWS(v.AquariumID, from, msg.Handoff)
+		case "feed", "tap":
+			// phones must not flood the displays
+			if time.Since(lastInteraction) < wsInteractionInterval {
+				continue
+			}
+			lastInteraction = time.Now()
+
+			ws.interactWS(v.AquariumID, msg)
+		default:
+			ws.log.Debug("Unknown WebSocket message", slog.String("viewer", v.ID.String()), slog.String("type", msg.Type))
+		}
+	}
+}
+
+// claimWS gives the display of v a slot of the wall
+func (ws *WebServer) claimWS(v *viewer, msg wsClientMessage) {
+	aquarium, err := ws.storage.Aquarium(v.AquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		return
+	}
+
+	slot := slotAuto
+	if msg.Slot != nil && *msg.Slot >= 0 {
+		slot = *msg.Slot
+	}
+
+	ws.viewers.claim(v, slot, wallSlots(aquarium.Wall))
+}
+
+// handoffWS passes a boid the display of slot from lets go to the other displays of the wall
+func (ws *WebServer) handoffWS(aquariumID uuid.UUID, from int, handoff models.Handoff) {
+	// only fishes everyone can see swim over the wall
+	fish, err := ws.storage.Fish(aquariumID, handoff.FishID)
+	if err != nil || !fish.Approved || !fish.Ready() {
+		return
+	}
+	handoff.From = from
+
+	ws.pubsub.Publish(models.InteractionTopic(aquariumID), models.NewHandoffEvent(aquariumID, &handoff))
+}
+
+// interactWS publishes an interaction of a client to all displays of the aquarium
+func (ws *WebServer) interactWS(aquariumID uuid.UUID, msg wsClientMessage) {
+	interaction := &models.Interaction{
+		X: min(max(msg.X, 0), 1),
+		Y: min(max(msg.Y, 0), 1),
+	}
+
+	kind := models.EventFeed
+	if msg.Type == "tap" {
+		// only fishes everyone can see can be tapped
+		fish, err := ws.storage.Fish(aquariumID, msg.FishID)
+		if err != nil || !fish.Approved || !fish.Ready() {
+			return
+		}
+		kind = models.EventFishTap
+		interaction.FishID = fish.ID
+	}
+
+	ws.pubsub.Publish(models.InteractionTopic(aquariumID), models.NewInteractionEvent(kind, aquariumID, interaction))
+}
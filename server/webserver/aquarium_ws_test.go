@@ -0,0 +1,83 @@
+package webserver
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+// readWSMessage reads messages of conn until one with event name arrives
+func readWSMessage(t *testing.T, conn *websocket.Conn, name string) map[string]interface{} {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var msg map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg["event"] == name {
+			return msg
+		}
+	}
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fish := &models.Fish{
+		ID:         uuid.New(),
+		AquariumID: aquarium.ID,
+		Filename:   "fish.png",
+		Name:       "Nemo",
+		Approved:   true,
+		Status:     models.FishStatusReady,
+	}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/aquarium/" + aquarium.ID.String() + "/ws"
+	display, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer display.Close()
+	phone, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer phone.Close()
+
+	// the same stream as SSE
+	msg := readWSMessage(t, display, "fishjoin")
+	assert.Equal(t, fish.ID.String(), msg["data"].(map[string]interface{})["id"])
+	readWSMessage(t, phone, "fishjoin")
+
+	require.NoError(t, display.WriteJSON(map[string]interface{}{"type": "register", "display": "Foyer"}))
+	require.NoError(t, display.WriteJSON(map[string]interface{}{"type": "viewport", "width": 1920, "height": 1080}))
+
+	// interactions of one client reach all clients, they are not kept for resumed streams
+	seq := server.pubsub.LastSequence(models.AquariumTopic(aquarium.ID))
+	require.NoError(t, phone.WriteJSON(map[string]interface{}{"type": "tap", "fish_id": fish.ID, "x": 0.5, "y": 2}))
+	msg = readWSMessage(t, display, "fishtap")
+	assert.Empty(t, msg["id"])
+	assert.Equal(t, seq, server.pubsub.LastSequence(models.AquariumTopic(aquarium.ID)))
+	assert.Equal(t, map[string]interface{}{"fish_id": fish.ID.String(), "x": 0.5, "y": 1.0}, msg["data"])
+
+	// too large messages end the connection
+	require.NoError(t, phone.WriteMessage(websocket.TextMessage, make([]byte, wsMaxMessageSize+1)))
+	phone.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, _, err := phone.ReadMessage(); err != nil {
+			break
+		}
+	}
+
+	// the display is still connected
+	require.NoError(t, display.WriteJSON(map[string]interface{}{"type": "feed", "x": 0.1, "y": 0.2}))
+	msg = readWSMessage(t, display, "feed")
+	assert.Equal(t, map[string]interface{}{"fish_id": uuid.Nil.String(), "x": 0.1, "y": 0.2}, msg["data"])
+}
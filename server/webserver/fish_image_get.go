@@ -1,14 +1,30 @@
 package webserver
 
 import (
-	"image/png"
-	"log/slog"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
 )
 
+// etag is the cached content hash of an image file
+type etag struct {
+	modTime time.Time
+	size    int64
+	value   string
+}
+
+// getFishImage serves the stored png of approved fishes, ?size=thumb|medium|full selects the variant
 func (ws *WebServer) getFishImage(w http.ResponseWriter, r *http.Request) {
 	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
 	if err != nil {
@@ -24,15 +40,112 @@ func (ws *WebServer) getFishImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// is file exist?
-	img, err := ws.storage.FishImage(aquariumID, fishID)
+	// unknown, foreign and not yet approved fishes do not exist for the public
+	fish, err := ws.storage.Fish(aquariumID, fishID)
+	if err != nil || fish.AquariumID != aquariumID || !fish.Approved || !fish.Ready() {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	ws.serveFishImage(w, r, fish)
+}
+
+// serveFishImage streams the image variant of fish with caching headers.
+// Urls versioned with the update time of the fish (?v=<unix millis>) never change and are cached forever,
+// other versions could be cached with an old image.
+func (ws *WebServer) serveFishImage(w http.ResponseWriter, r *http.Request, fish *models.Fish) {
+	size, ok := models.ParseImageSize(r.URL.Query().Get("size"))
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("400 unknown size"))
+		return
+	}
+
+	path, err := ws.fishImageVariant(fish.AquariumID, fish.ID, size)
 	if err != nil {
-		ws.log.Error("Failed to get fish image", slog.String("error", err.Error()))
+		// processed images can be removed in the meantime
 		w.WriteHeader(http.StatusNotFound)
 		w.Write([]byte("404 not found"))
 		return
 	}
 
+	file, err := os.Open(path)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 internal server error"))
+		return
+	}
+
+	tag, err := ws.fileETag(path, info, file)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 internal server error"))
+		return
+	}
+
 	w.Header().Set("Content-Type", "image/png")
-	png.Encode(w, img)
+	w.Header().Set("ETag", tag)
+	if r.URL.Query().Get("v") == strconv.FormatInt(fish.UpdatedAt.UnixMilli(), 10) {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// fileETag returns the strong etag of the file, the hash is only computed again if the file changed
+func (ws *WebServer) fileETag(path string, info fs.FileInfo, file io.ReadSeeker) (string, error) {
+	if cached, ok := ws.etags.Load(path); ok {
+		cached := cached.(etag)
+		if cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+			return cached.value, nil
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	value := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	ws.etags.Store(path, etag{modTime: info.ModTime(), size: info.Size(), value: value})
+
+	return value, nil
+}
+
+// fishImageVariant returns the path of the image variant. Fishes processed before
+// variants existed get them on the first request.
+func (ws *WebServer) fishImageVariant(aquariumID, fishID uuid.UUID, size models.ImageSize) (string, error) {
+	path, err := ws.storage.FishImageVariantPath(aquariumID, fishID, size)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) || size == models.ImageSizeFull {
+		return path, err
+	}
+
+	img, err := ws.storage.FishImage(aquariumID, fishID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := imageprocess.SaveImage(imageprocess.Resize(img, size.MaxEdge()), path, ws.log); err != nil {
+		return "", err
+	}
+
+	return path, nil
 }
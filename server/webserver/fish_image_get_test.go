@@ -0,0 +1,62 @@
+package webserver
+
+import (
+	"image"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+)
+
+func TestFishImageCache(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	fish := &models.Fish{ID: uuid.New(), AquariumID: aquarium.ID, Approved: true, Status: models.FishStatusReady, UpdatedAt: time.Now()}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+	path, err := store.FishImagePath(aquarium.ID, fish.ID)
+	require.NoError(t, err)
+	require.NoError(t, imageprocess.SaveImage(image.NewNRGBA(image.Rect(0, 0, 400, 200)), path, slog.Default()))
+
+	get := func(query string, etag string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/aquarium/"+aquarium.ID.String()+"/fishes/"+fish.ID.String()+".png"+query, nil)
+		require.NoError(t, err)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+
+	// only the current version is cached forever
+	version := strconv.FormatInt(fish.UpdatedAt.UnixMilli(), 10)
+	res := get("?size=thumb&v="+version, "")
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "public, max-age=31536000, immutable", res.Header.Get("Cache-Control"))
+	assert.Equal(t, "no-cache", get("?size=thumb&v=1", "").Header.Get("Cache-Control"))
+	assert.Equal(t, "no-cache", get("?size=thumb", "").Header.Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusNotModified, get("?size=thumb", res.Header.Get("ETag")).StatusCode)
+
+	// the lazily created variant is written in one go
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotEqual(t, ".tmp", filepath.Ext(entry.Name()), entry.Name())
+	}
+}
@@ -0,0 +1,85 @@
+package webserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+)
+
+func (ws *WebServer) getFishOutlineJSON(w http.ResponseWriter, r *http.Request) {
+	outline, ok := ws.fishOutline(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(outline)
+}
+
+func (ws *WebServer) getFishOutlineSVG(w http.ResponseWriter, r *http.Request) {
+	outline, ok := ws.fishOutline(w, r)
+	if !ok {
+		return
+	}
+
+	points := make([]string, 0, len(outline.Points))
+	for _, p := range outline.Points {
+		points = append(points, fmt.Sprintf("%g,%g", p[0], p[1]))
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d">`, outline.Width, outline.Height, outline.Width, outline.Height)
+	fmt.Fprintf(w, `<polygon points="%s" fill="none" stroke="#000" stroke-width="2"/>`, strings.Join(points, " "))
+	fmt.Fprint(w, `</svg>`)
+}
+
+// fishOutline returns the stored outline of the fish. Fishes processed before outlines
+// existed are traced on the fly.
+func (ws *WebServer) fishOutline(w http.ResponseWriter, r *http.Request) (*models.Outline, bool) {
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return nil, false
+	}
+
+	fishID, err := uuid.Parse(chi.URLParam(r, "fishID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return nil, false
+	}
+
+	fish, err := ws.storage.Fish(aquariumID, fishID)
+	if err != nil || fish.AquariumID != aquariumID || !fish.Approved || !fish.Ready() {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return nil, false
+	}
+
+	if fish.Outline != nil {
+		return fish.Outline, true
+	}
+
+	img, err := ws.storage.FishImage(aquariumID, fishID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return nil, false
+	}
+
+	outline := imageprocess.TraceOutline(img)
+	if outline == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return nil, false
+	}
+
+	return outline, true
+}
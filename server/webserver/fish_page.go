@@ -0,0 +1,120 @@
+package webserver
+
+import (
+	"encoding/json"
+	"image/png"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+)
+
+// fishState is the state of a fish the public may know
+type fishState string
+
+const (
+	fishStateProcessing fishState = "processing"
+	fishStateFailed     fishState = "failed"
+	fishStateWaiting    fishState = "waiting"
+	fishStateSwimming   fishState = "swimming"
+)
+
+func stateOf(fish *models.Fish) fishState {
+	switch {
+	case fish.Status == models.FishStatusFailed:
+		return fishStateFailed
+	case !fish.Ready():
+		return fishStateProcessing
+	case !fish.Approved:
+		return fishStateWaiting
+	default:
+		return fishStateSwimming
+	}
+}
+
+// publicFish finds the fish of the share page, unknown and foreign fishes are nil
+func (ws *WebServer) publicFish(r *http.Request) (*models.Aquarium, *models.Fish) {
+	aquariumID, err := uuid.Parse(chi.URLParam(r, "aquariumID"))
+	if err != nil {
+		return nil, nil
+	}
+
+	fishID, err := uuid.Parse(chi.URLParam(r, "fishID"))
+	if err != nil {
+		return nil, nil
+	}
+
+	aquarium, err := ws.storage.Aquarium(aquariumID)
+	if err != nil {
+		return nil, nil
+	}
+
+	fish, err := ws.storage.Fish(aquariumID, fishID)
+	if err != nil || fish.AquariumID != aquariumID {
+		return nil, nil
+	}
+
+	return aquarium, fish
+}
+
+// getFishPage is the public share page of a fish. Name and image are only shown once the fish is approved.
+func (ws *WebServer) getFishPage(w http.ResponseWriter, r *http.Request) {
+	aquarium, fish := ws.publicFish(r)
+	if fish == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	ws.tmpl.ExecuteTemplate(w, "fish.html", map[string]interface{}{
+		"Aquarium": aquarium,
+		"Fish":     fish,
+		"State":    stateOf(fish),
+		"Date":     imageprocess.GermanDate(fish.CreatedAt),
+		"Revision": ws.gitCommit,
+	})
+}
+
+// getFishState reports the state of a fish, the share page reloads when it changes
+func (ws *WebServer) getFishState(w http.ResponseWriter, r *http.Request) {
+	_, fish := ws.publicFish(r)
+	if fish == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]fishState{"state": stateOf(fish)})
+}
+
+// getFishCard serves the take-home card of an approved fish
+func (ws *WebServer) getFishCard(w http.ResponseWriter, r *http.Request) {
+	aquarium, fish := ws.publicFish(r)
+	if fish == nil || stateOf(fish) != fishStateSwimming {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	ws.serveFishCard(w, aquarium, fish)
+}
+
+// serveFishCard renders the card of fish with its name, the aquarium name and the upload date
+func (ws *WebServer) serveFishCard(w http.ResponseWriter, aquarium *models.Aquarium, fish *models.Fish) {
+	img, err := ws.storage.FishImage(fish.AquariumID, fish.ID)
+	if err != nil {
+		ws.log.Error("Failed to get fish image", slog.String("fish", fish.ID.String()), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Disposition", `inline; filename="fisch-`+fish.ID.String()+`.png"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	png.Encode(w, imageprocess.RenderCard(img, fish.Name, aquarium.Name, fish.CreatedAt))
+}
@@ -0,0 +1,141 @@
+package webserver
+
+import (
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+)
+
+func TestFishPage(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New(), Name: "Stadtfest"}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	fish := &models.Fish{ID: uuid.New(), AquariumID: aquarium.ID, Name: "Wanda", Status: models.FishStatusReady, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for x := 5; x < 35; x++ {
+		for y := 5; y < 15; y++ {
+			img.Set(x, y, color.NRGBA{0xe0, 0x20, 0x20, 0xff})
+		}
+	}
+	path, err := store.FishImagePath(aquarium.ID, fish.ID)
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(file, img))
+	file.Close()
+
+	job := &models.Job{ID: uuid.New(), AquariumID: aquarium.ID, FishIDs: []uuid.UUID{fish.ID}, Status: models.JobStatusDone}
+	require.NoError(t, store.InsertJob(job))
+
+	get := func(path string, cookies ...*http.Cookie) (*http.Response, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		require.NoError(t, err)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+	state := func() string {
+		res, body := get("/aquarium/" + aquarium.ID.String() + "/fishes/" + fish.ID.String() + "/state.json")
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		data := map[string]string{}
+		require.NoError(t, json.Unmarshal([]byte(body), &data))
+		return data["state"]
+	}
+	page := "/aquarium/" + aquarium.ID.String() + "/fishes/" + fish.ID.String()
+
+	// waiting for moderation, the public sees neither name nor card
+	res, body := get(page)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, body, "wartet noch auf die Freigabe")
+	assert.NotContains(t, body, "Wanda")
+	assert.Equal(t, "waiting", state())
+	res, _ = get(page + "/card.png")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	// knowing the job id is not enough, the uploader sees the fish and card with the ownership token
+	uploads := "/uploads/" + job.ID.String() + "/fishes/"
+	res, _ = get(uploads + fish.ID.String() + ".png")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, _ = get(uploads + fish.ID.String() + "/card.png")
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	token, _ := server.ws.owners.Issue(job.ID, time.Now())
+	owner := &http.Cookie{Name: ownerCookiePrefix + job.ID.String(), Value: token}
+	res, _ = get(uploads+fish.ID.String()+".png", owner)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res, body = get(uploads+fish.ID.String()+"/card.png", owner)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	card, err := png.Decode(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, imageprocess.CardWidth, imageprocess.CardHeight), card.Bounds())
+	res, _ = get(uploads+uuid.NewString()+"/card.png", owner)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, body = get("/uploads/" + job.ID.String())
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, body, "/aquarium/"+aquarium.ID.String())
+
+	// approved, the page shows the fish
+	fish.Approved = true
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+	res, _ = get(uploads + fish.ID.String() + ".png")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "swimming", state())
+	res, body = get(page)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, body, "Wanda")
+	assert.Contains(t, body, "Stadtfest")
+	res, _ = get(page + "/card.png")
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "image/png", res.Header.Get("Content-Type"))
+
+	// fishes of other aquariums do not exist here
+	res, _ = get("/aquarium/" + uuid.NewString() + "/fishes/" + fish.ID.String())
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestStreamFishHidesUpload(t *testing.T) {
+	t.Parallel()
+
+	fish := &models.Fish{ID: uuid.New(), UploadID: uuid.New(), Name: "Wanda", Approved: true, Status: models.FishStatusReady}
+	raw, err := json.Marshal(eventMessage(models.NewFishEvent(models.EventFishJoin, fish)).Data)
+	require.NoError(t, err)
+	assert.Contains(t, string(raw), fish.ID.String())
+	assert.NotContains(t, string(raw), fish.UploadID.String())
+	assert.NotContains(t, string(raw), "upload_id")
+}
+
+func TestStreamFishLeftOnlyID(t *testing.T) {
+	t.Parallel()
+
+	fish := &models.Fish{ID: uuid.New(), Name: "Arschgesicht", NameFlagged: true, Status: models.FishStatusReady}
+	raw, err := json.Marshal(eventMessage(models.NewFishEvent(models.EventFishLeft, fish)).Data)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"`+fish.ID.String()+`"}`, string(raw))
+}
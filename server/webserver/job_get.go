@@ -0,0 +1,84 @@
+package webserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+)
+
+// jobResponse is the processing state of an upload without the original and the settings
+type jobResponse struct {
+	ID         uuid.UUID        `json:"id"`
+	AquariumID uuid.UUID        `json:"aquarium_id"`
+	Status     models.JobStatus `json:"status"`
+	// Error is only sent to the uploader
+	Error      string        `json:"error,omitempty"`
+	Duplicates []uuid.UUID   `json:"duplicates,omitempty"`
+	Fishes     []jobFishInfo `json:"fishes"`
+	// Waiting counts the fishes hidden until they are approved
+	Waiting int `json:"waiting"`
+}
+
+type jobFishInfo struct {
+	ID        uuid.UUID         `json:"id"`
+	Name      string            `json:"name"`
+	Status    models.FishStatus `json:"status"`
+	Approved  bool              `json:"approved"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// getJob reports the processing state of an upload. Fishes waiting for approval are only
+// listed for the holder of the ownership token of the upload.
+func (ws *WebServer) getJob(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	job, err := ws.storage.Job(jobID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	token, _ := ws.uploadOwner(r, job.ID)
+	owner := token != ""
+
+	res := jobResponse{
+		ID:         job.ID,
+		AquariumID: job.AquariumID,
+		Status:     job.Status,
+		Duplicates: job.Duplicates,
+		Fishes:     []jobFishInfo{},
+	}
+	if owner {
+		res.Error = job.Error
+	}
+	for _, fishID := range job.FishIDs {
+		fish, err := ws.storage.Fish(job.AquariumID, fishID)
+		if err != nil {
+			continue
+		}
+		if !owner && (!fish.Approved || !fish.Ready()) {
+			res.Waiting++
+			continue
+		}
+		res.Fishes = append(res.Fishes, jobFishInfo{
+			ID:        fish.ID,
+			Name:      fish.Name,
+			Status:    fish.Status,
+			Approved:  fish.Approved,
+			UpdatedAt: fish.UpdatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
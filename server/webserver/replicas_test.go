@@ -0,0 +1,217 @@
+package webserver
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/pubsub/natstest"
+	"github.com/superbarne/fish/storage"
+)
+
+// newReplica starts a server on store connected to the NATS server at natsURL
+func newReplica(t *testing.T, store *storage.Storage, natsURL string) *testServer {
+	t.Helper()
+
+	ps, err := pubsub.NewNATS(slog.Default(), pubsub.NewPubSub[models.Event](), natsURL, "fish")
+	require.NoError(t, err)
+
+	return startTestServer(t, store, ps)
+}
+
+// streamSSE connects to the SSE stream at url and returns the event names
+func streamSSE(t *testing.T, url string) <-chan string {
+	t.Helper()
+
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+
+	events := make(chan string, 100)
+	go func() {
+		defer close(events)
+
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+				events <- name
+			}
+		}
+	}()
+
+	return events
+}
+
+// waitForEvent reads events until name arrives
+func waitForEvent(t *testing.T, events <-chan string, name string) {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			require.True(t, ok, "stream ended before %s", name)
+			if event == name {
+				return
+			}
+		case <-timeout:
+			require.Fail(t, "no event", name)
+			return
+		}
+	}
+}
+
+func TestReplicasFanOut(t *testing.T) {
+	t.Parallel()
+
+	natsURL := natstest.Server(t)
+
+	// the replicas share the storage like a shared volume
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New(), NeedApproval: true}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fish := &models.Fish{
+		ID:         uuid.New(),
+		AquariumID: aquarium.ID,
+		Filename:   "fish.png",
+		Name:       "Nemo",
+		Status:     models.FishStatusReady,
+	}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+
+	a := newReplica(t, store, natsURL)
+	b := newReplica(t, store, natsURL)
+
+	// displays on both replicas, the ping with an id ends the snapshot
+	streamA := streamSSE(t, a.URL+"/aquarium/"+aquarium.ID.String()+"/sse")
+	streamB := streamSSE(t, b.URL+"/aquarium/"+aquarium.ID.String()+"/sse")
+	waitForEvent(t, streamA, "ping")
+	waitForEvent(t, streamA, "ping")
+	waitForEvent(t, streamB, "ping")
+	waitForEvent(t, streamB, "ping")
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// approved on a, swimming on both
+	res, err := client.PostForm(a.URL+"/admin/aquarium/"+aquarium.ID.String()+"/fishes/"+fish.ID.String()+"/approve", url.Values{"approved": {"true"}})
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+
+	waitForEvent(t, streamA, "fishjoin")
+	waitForEvent(t, streamB, "fishjoin")
+
+	// settings changed on b reach a
+	res, err = client.Post(b.URL+"/admin/aquarium/"+aquarium.ID.String()+"/split", "", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	waitForEvent(t, streamA, "aquariumsettings")
+	waitForEvent(t, streamB, "aquariumsettings")
+}
+
+// waitForViewers reads the viewer counts of conn until count arrives, the count of the other replica comes later
+func waitForViewers(t *testing.T, conn *websocket.Conn, count int) {
+	t.Helper()
+
+	for {
+		msg := readWSMessage(t, conn, "viewers")
+		if msg["data"].(map[string]interface{})["count"] == float64(count) {
+			return
+		}
+	}
+}
+
+func TestReplicasViewers(t *testing.T) {
+	t.Parallel()
+
+	natsURL := natstest.Server(t)
+
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	a := newReplica(t, store, natsURL)
+	b := newReplica(t, store, natsURL)
+
+	path := "/aquarium/" + aquarium.ID.String() + "/ws"
+	foyer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(a.URL, "http")+path+"?display=Foyer", nil)
+	require.NoError(t, err)
+	defer foyer.Close()
+	waitForViewers(t, foyer, 1)
+
+	// a viewer on b counts on both replicas
+	phone, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(b.URL, "http")+path+"?display=Handy", nil)
+	require.NoError(t, err)
+	defer phone.Close()
+	waitForViewers(t, foyer, 2)
+	waitForViewers(t, phone, 2)
+
+	// the Admin Panel of a lists the viewer of b
+	res, err := http.Get(a.URL + "/admin/aquarium/" + aquarium.ID.String())
+	require.NoError(t, err)
+	page, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Contains(t, string(page), "Zuschauer (2)")
+	assert.Contains(t, string(page), "Handy")
+
+	// and forgets it when it leaves
+	phone.Close()
+	waitForViewers(t, foyer, 1)
+}
+
+func TestReplicasWallSlots(t *testing.T) {
+	t.Parallel()
+
+	natsURL := natstest.Server(t)
+
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New(), Wall: models.NewWall(2, 1, 1920, 1080)}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	a := newReplica(t, store, natsURL)
+	b := newReplica(t, store, natsURL)
+
+	// waitForSlot reads the viewports of conn until it shows slot, a slot both replicas gave away moves later
+	waitForSlot := func(conn *websocket.Conn, slot int) {
+		t.Helper()
+		for {
+			msg := readWSMessage(t, conn, "viewport")
+			if msg["data"].(map[string]interface{})["slot"] == float64(slot) {
+				return
+			}
+		}
+	}
+
+	path := "/aquarium/" + aquarium.ID.String() + "/ws"
+	left, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(a.URL, "http")+path+"?slot=auto", nil)
+	require.NoError(t, err)
+	defer left.Close()
+	waitForSlot(left, 0)
+
+	// the first free slot of both replicas
+	right, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(b.URL, "http")+path+"?slot=auto", nil)
+	require.NoError(t, err)
+	defer right.Close()
+	waitForSlot(right, 1)
+
+	// a newer claim on b takes over the slot of a
+	require.NoError(t, right.WriteJSON(map[string]interface{}{"type": "claim", "slot": 0}))
+	waitForSlot(right, 0)
+	waitForSlot(left, -1)
+}
@@ -0,0 +1,106 @@
+package webserver
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/jobs"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/sim"
+	"github.com/superbarne/fish/storage"
+)
+
+func TestSimulation(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fish := &models.Fish{ID: uuid.New(), AquariumID: aquarium.ID, Name: "Nemo", Approved: true, Status: models.FishStatusReady}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+
+	setSimulation := func(values url.Values) {
+		res, err := http.PostForm(server.URL+"/admin/aquarium/"+aquarium.ID.String()+"/simulation", values)
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/aquarium/"+aquarium.ID.String()+"/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	readWSMessage(t, conn, "fishjoin")
+
+	// invalid settings are ignored
+	setSimulation(url.Values{"enabled": {"on"}, "seed": {"-1"}, "boids_per_fish": {"4"}})
+	stored, err := store.Aquarium(aquarium.ID)
+	require.NoError(t, err)
+	assert.Nil(t, stored.Simulation)
+
+	// turned on while watching, the positions come from the server
+	setSimulation(url.Values{"enabled": {"on"}, "seed": {"42"}, "boids_per_fish": {"4"}})
+	keyframe := readWSMessage(t, conn, "simkeyframe")["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{map[string]interface{}{"fish_id": fish.ID.String(), "boids": float64(4)}}, keyframe["fishes"])
+	frame := readWSMessage(t, conn, "simframe")["data"].(map[string]interface{})
+	boids, err := base64.StdEncoding.DecodeString(frame["boids"].(string))
+	require.NoError(t, err)
+	assert.Len(t, boids, 4*6)
+
+	stored, err = store.Aquarium(aquarium.ID)
+	require.NoError(t, err)
+	assert.Equal(t, &models.Simulation{Seed: 42, BoidsPerFish: 4}, stored.Simulation)
+
+	// turned off, the display gets the fishes again to simulate them itself
+	setSimulation(url.Values{})
+	readWSMessage(t, conn, "simstop")
+	readWSMessage(t, conn, "fishjoin")
+}
+
+func TestSimulationFailed(t *testing.T) {
+	t.Parallel()
+
+	store := storage.NewStorage(t.TempDir())
+	aquarium := &models.Aquarium{ID: uuid.New(), Simulation: &models.Simulation{Seed: 42}}
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fish := &models.Fish{ID: uuid.New(), AquariumID: aquarium.ID, Name: "Nemo", Approved: true, Status: models.FishStatusReady}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+
+	// the simulation reads its fishes from a broken storage
+	simDir := t.TempDir()
+	broken := filepath.Join(simDir, "aquariums", aquarium.ID.String(), "fishes", "broken.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(broken), os.ModePerm))
+	require.NoError(t, os.WriteFile(broken, []byte("{"), os.ModePerm))
+
+	ps := pubsub.NewPubSub[models.Event]()
+	ws := NewWebServer(slog.Default(), ps, store, jobs.NewQueue(slog.Default(), store, nil, 1, 10, 0), "test")
+	ws.sims = sim.NewManager(slog.Default(), storage.NewStorage(simDir), ps)
+	server := httptest.NewServer(ws.router)
+	t.Cleanup(func() {
+		ps.Close()
+		server.Close()
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/aquarium/"+aquarium.ID.String()+"/ws", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the display simulates the fishes itself while the simulation fails
+	readWSMessage(t, conn, "simstop")
+	readWSMessage(t, conn, "fishjoin")
+
+	// and gets the positions again once it runs
+	require.NoError(t, os.Remove(broken))
+	readWSMessage(t, conn, "simkeyframe")
+}
@@ -0,0 +1,310 @@
+package webserver
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/names"
+	"github.com/superbarne/fish/owner"
+	"github.com/superbarne/fish/storage"
+)
+
+// ownerCookiePrefix is followed by the job id, every upload has its own cookie
+const ownerCookiePrefix = "fish_owner_"
+
+// newOwnerSigner signs the ownership tokens of uploads. The secret is shared by all servers with
+// the same data directory, AQUARIUM_OWNER_SECRET replaces it and AQUARIUM_OWNER_WINDOW (e.g. 2h)
+// sets how long uploaders may change their fishes.
+func newOwnerSigner(store *storage.Storage) (*owner.Signer, error) {
+	window := owner.DefaultWindow
+	if raw := os.Getenv("AQUARIUM_OWNER_WINDOW"); raw != "" {
+		var err error
+		if window, err = time.ParseDuration(raw); err != nil {
+			return nil, err
+		}
+	}
+
+	if secret := os.Getenv("AQUARIUM_OWNER_SECRET"); secret != "" {
+		return owner.NewSigner([]byte(secret), window), nil
+	}
+
+	secret, err := store.Secret("owner")
+	if err != nil {
+		return nil, err
+	}
+
+	return owner.NewSigner(secret, window), nil
+}
+
+// issueOwnership hands the uploader of job the token to change its fishes
+func (ws *WebServer) issueOwnership(w http.ResponseWriter, r *http.Request, jobID uuid.UUID) {
+	token, expires := ws.owners.Issue(jobID, time.Now())
+	ws.setOwnerCookie(w, r, jobID, token, expires)
+}
+
+// setOwnerCookie stores token for the pages of the upload. Behind HTTPS the cookie is never sent
+// over plain HTTP, browsers drop secure cookies of plain HTTP servers.
+func (ws *WebServer) setOwnerCookie(w http.ResponseWriter, r *http.Request, jobID uuid.UUID, token string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     ownerCookiePrefix + jobID.String(),
+		Value:    token,
+		Path:     "/uploads/" + jobID.String(),
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// uploadOwner returns the valid ownership token of the request for the upload jobID, empty if there is none
+func (ws *WebServer) uploadOwner(r *http.Request, jobID uuid.UUID) (string, time.Time) {
+	cookie, err := r.Cookie(ownerCookiePrefix + jobID.String())
+	if err != nil {
+		return "", time.Time{}
+	}
+
+	tokenJobID, expires, err := ws.owners.Verify(cookie.Value, time.Now())
+	if err != nil || tokenJobID != jobID {
+		return "", time.Time{}
+	}
+
+	return cookie.Value, expires
+}
+
+// claimOwnership stores the token of an ownership link in a cookie, the link works on other devices too
+func (ws *WebServer) claimOwnership(w http.ResponseWriter, r *http.Request, jobID uuid.UUID) {
+	token := r.URL.Query().Get("token")
+	tokenJobID, expires, err := ws.owners.Verify(token, time.Now())
+	if err == nil && tokenJobID == jobID {
+		ws.setOwnerCookie(w, r, jobID, token, expires)
+	}
+
+	http.Redirect(w, r, "/uploads/"+jobID.String(), http.StatusSeeOther)
+}
+
+// ownedJob returns the upload of the request if the request holds its ownership token
+func (ws *WebServer) ownedJob(r *http.Request) (*models.Job, bool) {
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		return nil, false
+	}
+
+	if token, _ := ws.uploadOwner(r, jobID); token == "" {
+		return nil, false
+	}
+
+	job, err := ws.storage.Job(jobID)
+	if err != nil {
+		return nil, false
+	}
+
+	return job, true
+}
+
+// ownedFish returns the upload and the fish of the request if the request holds the ownership token of the upload
+func (ws *WebServer) ownedFish(r *http.Request) (*models.Job, *models.Fish, bool) {
+	job, ok := ws.ownedJob(r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	fishID, err := uuid.Parse(chi.URLParam(r, "fishID"))
+	if err != nil || !slices.Contains(job.FishIDs, fishID) {
+		return nil, nil, false
+	}
+
+	fish, err := ws.storage.Fish(job.AquariumID, fishID)
+	if err != nil {
+		return nil, nil, false
+	}
+
+	return job, fish, true
+}
+
+func forbidden(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte("403 forbidden"))
+}
+
+// renameOwnerFish renames a fish of the upload. The name passes the name policy of the aquarium,
+// aquariums with approval need to approve the fish again.
+func (ws *WebServer) renameOwnerFish(w http.ResponseWriter, r *http.Request) {
+	job, fish, ok := ws.ownedFish(r)
+	if !ok {
+		forbidden(w)
+		return
+	}
+
+	aquarium, err := ws.storage.Aquarium(fish.AquariumID)
+	if err != nil {
+		ws.log.Error("Failed to get aquarium", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	name, flagged := names.Moderate(r.FormValue("name"), aquarium.NamePolicy)
+	if name == fish.Name {
+		http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	visible := fish.Approved && fish.Ready()
+	fish.Name = name
+	fish.NameFlagged = flagged
+	if flagged || aquarium.NeedApproval {
+		fish.Approved = false
+		fish.ApprovedAt = nil
+	}
+
+	if err := ws.storage.InsertFish(aquarium.ID, fish); err != nil {
+		ws.log.Error("Failed to save fish", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	if visible && !fish.Approved {
+		// the fish waits for the moderator again
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishLeft, fish))
+	} else {
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishUpdate, fish))
+	}
+
+	// fishes the upload creates later get the new name too
+	job.Name = name
+	if err := ws.storage.InsertJob(job); err != nil {
+		ws.log.Error("Failed to save job", slog.String("error", err.Error()))
+	}
+
+	http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+}
+
+// deleteOwnerFish removes a fish of the upload from the aquarium
+func (ws *WebServer) deleteOwnerFish(w http.ResponseWriter, r *http.Request) {
+	job, fish, ok := ws.ownedFish(r)
+	if !ok {
+		forbidden(w)
+		return
+	}
+
+	if err := ws.deleteFish(fish); err != nil {
+		ws.log.Error("Failed to delete fish", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+		return
+	}
+
+	http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+}
+
+// reuploadOwnerFish replaces the photo of the upload and processes it again, the fishes keep their ids.
+// Aquariums with approval need to approve the new drawings.
+func (ws *WebServer) reuploadOwnerFish(w http.ResponseWriter, r *http.Request) {
+	job, ok := ws.ownedJob(r)
+	if !ok {
+		forbidden(w)
+		return
+	}
+
+	// the photo is still being processed
+	if job.Status == models.JobStatusPending || job.Status == models.JobStatusRunning {
+		http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=busy", http.StatusSeeOther)
+		return
+	}
+
+	file, multipartHeader, err := r.FormFile("image")
+	if err != nil {
+		http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=upload", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	if _, err := imageprocess.DetectFormat(file); err != nil {
+		http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=format", http.StatusSeeOther)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=upload", http.StatusSeeOther)
+		return
+	}
+
+	settings, err := parseProcessSettings(r)
+	if err != nil {
+		http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=upload", http.StatusSeeOther)
+		return
+	}
+
+	original, err := ws.storage.SaveOriginal(job.ID, file, multipartHeader)
+	if err != nil {
+		ws.log.Error("Failed to save image", slog.String("error", err.Error()))
+		http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=upload", http.StatusSeeOther)
+		return
+	}
+	if job.Original != "" && job.Original != original {
+		if err := ws.storage.DeleteOriginal(job.Original); err != nil {
+			ws.log.Error("Failed to delete original", slog.String("error", err.Error()))
+		}
+	}
+	job.Original = original
+
+	// without a mode the upload is split as before, the other settings were made for the old photo
+	if settings.Split == nil {
+		settings.Split = job.Settings.Split
+	}
+	job.Settings = settings
+	// the new photo has other drawings, the deleted ones do not count anymore
+	job.DeletedSlots = nil
+
+	if job.AquariumID != uuid.Nil {
+		if err := ws.resetOwnerFishes(job); err != nil {
+			ws.log.Error("Failed to reset fishes", slog.String("error", err.Error()))
+			http.Redirect(w, r, "/uploads/"+job.ID.String()+"?error=upload", http.StatusSeeOther)
+			return
+		}
+	}
+
+	if err := ws.jobs.Enqueue(job); err != nil {
+		ws.log.Error("Failed to queue job", slog.String("error", err.Error()))
+	}
+
+	http.Redirect(w, r, "/uploads/"+job.ID.String(), http.StatusSeeOther)
+}
+
+// resetOwnerFishes prepares the fishes of job for a new drawing. The corrections of the moderator
+// were made for the old drawing, and aquariums with approval take the fishes out until they are approved again.
+func (ws *WebServer) resetOwnerFishes(job *models.Job) error {
+	aquarium, err := ws.storage.Aquarium(job.AquariumID)
+	if err != nil {
+		return err
+	}
+
+	for _, fishID := range job.FishIDs {
+		fish, err := ws.storage.Fish(aquarium.ID, fishID)
+		if err != nil {
+			continue
+		}
+
+		if err := ws.storage.SaveFishMask(aquarium.ID, fishID, &models.FishMask{Strokes: []models.MaskStroke{}}); err != nil {
+			return err
+		}
+
+		if !aquarium.NeedApproval || !fish.Approved {
+			continue
+		}
+
+		fish.Approved = false
+		fish.ApprovedAt = nil
+		if err := ws.storage.InsertFish(aquarium.ID, fish); err != nil {
+			return err
+		}
+		ws.pubsub.Publish(models.AquariumTopic(aquarium.ID), models.NewFishEvent(models.EventFishLeft, fish))
+	}
+
+	return nil
+}
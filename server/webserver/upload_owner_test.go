@@ -0,0 +1,196 @@
+package webserver
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/owner"
+)
+
+// imageForm is a multipart form with a png in the field image and the given name
+func imageForm(t *testing.T, name string) (io.Reader, string) {
+	t.Helper()
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("image", "fish.png")
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(part, image.NewNRGBA(image.Rect(0, 0, 8, 8))))
+	require.NoError(t, form.WriteField("name", name))
+	require.NoError(t, form.Close())
+
+	return body, form.FormDataContentType()
+}
+
+func TestUploadOwner(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	sub := server.pubsub.Subscribe(models.AquariumTopic(aquarium.ID), ctx, 10)
+
+	client := func() *http.Client {
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		return &http.Client{
+			Jar:           jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	}
+	post := func(client *http.Client, path string, values url.Values) *http.Response {
+		res, err := client.PostForm(server.URL+path, values)
+		require.NoError(t, err)
+		res.Body.Close()
+		return res
+	}
+	page := func(client *http.Client, path string) string {
+		res, err := client.Get(server.URL + path)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+	nextEvent := func() models.Event {
+		select {
+		case event := <-sub.C:
+			return event
+		case <-time.After(time.Second):
+			require.Fail(t, "no event")
+			return models.Event{}
+		}
+	}
+
+	// the upload hands out the ownership cookie
+	uploader := client()
+	body, contentType := imageForm(t, "Wanda")
+	res, err := uploader.Post(server.URL+"/aquarium/"+aquarium.ID.String()+"/", contentType, body)
+	require.NoError(t, err)
+	res.Body.Close()
+	require.Equal(t, http.StatusSeeOther, res.StatusCode)
+	jobPath := res.Header.Get("Location")
+	require.True(t, strings.HasPrefix(jobPath, "/uploads/"))
+
+	job, err := store.Job(uuid.MustParse(strings.TrimPrefix(jobPath, "/uploads/")))
+	require.NoError(t, err)
+	require.Len(t, job.FishIDs, 1)
+	fishPath := jobPath + "/fishes/" + job.FishIDs[0].String()
+
+	ownerPage := page(uploader, jobPath)
+	assert.Contains(t, ownerPage, "Umbenennen")
+	link := ownerPage[strings.Index(ownerPage, jobPath+"?token="):]
+	link = link[:strings.IndexByte(link, '"')]
+
+	// everybody else may look, but not touch
+	stranger := client()
+	jobState := page(uploader, jobPath+"/job.json")
+	assert.Contains(t, jobState, job.FishIDs[0].String())
+	assert.NotContains(t, jobState, job.Original)
+	jobState = page(stranger, jobPath+"/job.json")
+	assert.NotContains(t, jobState, job.FishIDs[0].String())
+	assert.Contains(t, jobState, `"waiting":1`)
+	assert.NotContains(t, page(stranger, jobPath), "Umbenennen")
+	assert.Equal(t, http.StatusForbidden, post(stranger, fishPath+"/name", url.Values{"name": {"Hacked"}}).StatusCode)
+	assert.Equal(t, http.StatusForbidden, post(stranger, fishPath+"/delete", nil).StatusCode)
+	assert.Equal(t, http.StatusForbidden, post(stranger, jobPath+"/fishes/"+uuid.NewString()+"/delete", nil).StatusCode)
+
+	// renamed by the uploader like the moderator would change it
+	assert.Equal(t, http.StatusSeeOther, post(uploader, fishPath+"/name", url.Values{"name": {"  Dorie  "}}).StatusCode)
+	fish, err := store.Fish(aquarium.ID, job.FishIDs[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Dorie", fish.Name)
+	event := nextEvent()
+	assert.Equal(t, models.EventFishUpdate, event.Kind)
+	assert.Equal(t, "Dorie", event.Fish.Name)
+
+	// the personal link works on another device
+	device := client()
+	res, err = device.Get(server.URL + strings.ReplaceAll(link, "&amp;", "&"))
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, jobPath, res.Header.Get("Location"))
+	assert.Contains(t, page(device, jobPath), "Umbenennen")
+
+	// a new photo waits until the first one is processed
+	res = post(device, jobPath+"/image", nil)
+	assert.Equal(t, jobPath+"?error=busy", res.Header.Get("Location"))
+
+	// re-uploaded drawings of aquariums with approval are moderated again
+	aquarium.NeedApproval = true
+	require.NoError(t, store.InsertAquarium(aquarium))
+	fish.Approved = true
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+	job.Status = models.JobStatusDone
+	require.NoError(t, store.InsertJob(job))
+
+	body, contentType = imageForm(t, "Wanda")
+	res, err = device.Post(server.URL+jobPath+"/image", contentType, body)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, jobPath, res.Header.Get("Location"))
+	event = nextEvent()
+	assert.Equal(t, models.EventFishLeft, event.Kind)
+	fish, err = store.Fish(aquarium.ID, job.FishIDs[0])
+	require.NoError(t, err)
+	assert.False(t, fish.Approved)
+	job, err = store.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.JobStatusPending, job.Status)
+
+	// removed from the aquarium and the upload
+	assert.Equal(t, http.StatusSeeOther, post(uploader, fishPath+"/delete", nil).StatusCode)
+	_, err = store.Fish(aquarium.ID, fish.ID)
+	assert.Error(t, err)
+	assert.Equal(t, models.EventFishLeft, nextEvent().Kind)
+	job, err = store.Job(job.ID)
+	require.NoError(t, err)
+	assert.Empty(t, job.FishIDs)
+
+	// after the window the token is worthless
+	token, _ := server.ws.owners.Issue(job.ID, time.Now().Add(-25*time.Hour))
+	expired := client()
+	serverURL, err := url.Parse(server.URL + jobPath)
+	require.NoError(t, err)
+	expired.Jar.SetCookies(serverURL, []*http.Cookie{{Name: ownerCookiePrefix + job.ID.String(), Value: token}})
+	assert.Equal(t, http.StatusForbidden, post(expired, jobPath+"/image", nil).StatusCode)
+	assert.NotContains(t, page(expired, jobPath), "Neu hochladen")
+}
+
+func TestOwnerCookieSecure(t *testing.T) {
+	t.Parallel()
+
+	ws := &WebServer{owners: owner.NewSigner([]byte("secret"), time.Hour)}
+	jobID := uuid.New()
+
+	for proto, secure := range map[string]bool{"": false, "https": true} {
+		r := httptest.NewRequest(http.MethodPost, "/upload", nil)
+		r.Header.Set("X-Forwarded-Proto", proto)
+		w := httptest.NewRecorder()
+		ws.issueOwnership(w, r, jobID)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, secure, cookies[0].Secure, proto)
+		assert.True(t, cookies[0].HttpOnly)
+	}
+}
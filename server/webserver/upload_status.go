@@ -0,0 +1,115 @@
+package webserver
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/imageprocess"
+	"github.com/superbarne/fish/models"
+)
+
+// getUploadStatus is the page after an upload, it shows the fishes of the upload with share links and cards
+func (ws *WebServer) getUploadStatus(w http.ResponseWriter, r *http.Request) {
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	job, err := ws.storage.Job(jobID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	// ownership links move the token into a cookie
+	if r.URL.Query().Has("token") {
+		ws.claimOwnership(w, r, job.ID)
+		return
+	}
+
+	// uploads of templates without a detected aquarium go back to the template upload
+	back := "/upload"
+	if job.AquariumID != uuid.Nil {
+		back = "/aquarium/" + job.AquariumID.String()
+	}
+
+	data := map[string]interface{}{
+		"Job":      job,
+		"Back":     back,
+		"Error":    r.URL.Query().Get("error"),
+		"Formats":  imageprocess.Formats,
+		"Revision": ws.gitCommit,
+	}
+
+	// the uploader may change the fishes until the token expires
+	if token, expires := ws.uploadOwner(r, job.ID); token != "" {
+		data["OwnerLink"] = "/uploads/" + job.ID.String() + "?token=" + token
+		data["OwnerUntil"] = imageprocess.GermanDate(expires) + ", " + expires.Format("15:04") + " Uhr"
+	}
+
+	ws.tmpl.ExecuteTemplate(w, "upload_status.html", data)
+}
+
+// jobFish finds a fish of an upload. Fishes waiting for approval are only shown to the holder
+// of the ownership token of the upload.
+func (ws *WebServer) jobFish(r *http.Request) (*models.Aquarium, *models.Fish) {
+	jobID, err := uuid.Parse(chi.URLParam(r, "jobID"))
+	if err != nil {
+		return nil, nil
+	}
+
+	fishID, err := uuid.Parse(chi.URLParam(r, "fishID"))
+	if err != nil {
+		return nil, nil
+	}
+
+	job, err := ws.storage.Job(jobID)
+	if err != nil || !slices.Contains(job.FishIDs, fishID) {
+		return nil, nil
+	}
+
+	aquarium, err := ws.storage.Aquarium(job.AquariumID)
+	if err != nil {
+		return nil, nil
+	}
+
+	fish, err := ws.storage.Fish(job.AquariumID, fishID)
+	if err != nil || !fish.Ready() {
+		return nil, nil
+	}
+
+	if token, _ := ws.uploadOwner(r, job.ID); token == "" && !fish.Approved {
+		return nil, nil
+	}
+
+	return aquarium, fish
+}
+
+// getJobFishImage serves the image of a fish of an upload
+func (ws *WebServer) getJobFishImage(w http.ResponseWriter, r *http.Request) {
+	_, fish := ws.jobFish(r)
+	if fish == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	ws.serveFishImage(w, r, fish)
+}
+
+// getJobFishCard serves the take-home card of a fish of an upload
+func (ws *WebServer) getJobFishCard(w http.ResponseWriter, r *http.Request) {
+	aquarium, fish := ws.jobFish(r)
+	if fish == nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 not found"))
+		return
+	}
+
+	ws.serveFishCard(w, aquarium, fish)
+}
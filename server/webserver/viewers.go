@@ -0,0 +1,410 @@
+package webserver
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/names"
+	"github.com/superbarne/fish/pubsub"
+)
+
+// viewer is a display or browser of an aquarium connected to this server
+type viewer struct {
+	models.Viewer
+	AquariumID uuid.UUID
+
+	// claim is the slot the viewer asked for
+	claim int
+	// slots is the number of slots of the wall the viewer claimed on
+	slots int
+	// count receives the number of viewers of the aquarium when it changed
+	count chan int
+	// slot receives the slot of the viewer when it changed
+	slot chan int
+	// direct are messages for this viewer only, e.g. answers to its messages
+	direct chan streamMessage
+}
+
+const (
+	// noSlot viewers show the whole aquarium
+	noSlot = -1
+	// slotAuto claims the first free slot
+	slotAuto = -2
+)
+
+const (
+	// presenceInterval is how often every server sends its viewers to the other servers
+	presenceInterval = 10 * time.Second
+	// presenceTimeout is how long the viewers of a server are counted without a new list
+	presenceTimeout = 3 * presenceInterval
+)
+
+// parseSlot parses the slot a viewer asks for, a number or auto
+func parseSlot(raw string) int {
+	if raw == "auto" {
+		return slotAuto
+	}
+	if slot, err := strconv.Atoi(raw); err == nil && slot >= 0 {
+		return slot
+	}
+	return noSlot
+}
+
+func newViewer(r *http.Request, aquariumID uuid.UUID, transport string) *viewer {
+	now := time.Now()
+	return &viewer{
+		Viewer: models.Viewer{
+			ID:          uuid.New(),
+			Transport:   transport,
+			UserAgent:   r.UserAgent(),
+			Display:     names.Clean(r.URL.Query().Get("display"), names.DefaultMaxLength),
+			ConnectedAt: now,
+			LastPing:    now,
+			Slot:        noSlot,
+		},
+		AquariumID: aquariumID,
+		claim:      parseSlot(r.URL.Query().Get("slot")),
+		count:      make(chan int, 1),
+		slot:       make(chan int, 1),
+		direct:     make(chan streamMessage, 8),
+	}
+}
+
+// viewers are the viewers connected to this server by aquarium and the ones other servers sent
+type viewers struct {
+	lock       sync.Mutex
+	byAquarium map[uuid.UUID]map[uuid.UUID]*viewer
+	// remote are the viewers of the other servers by aquarium and server
+	remote map[uuid.UUID]map[uuid.UUID]*models.ViewerPresence
+
+	// server tells the lists of this server apart
+	server uuid.UUID
+	pubsub pubsub.Broker[models.Event]
+}
+
+// newViewers keeps the viewers of this server and shares them with the other servers over ps
+func newViewers(ps pubsub.Broker[models.Event]) *viewers {
+	vs := &viewers{
+		byAquarium: make(map[uuid.UUID]map[uuid.UUID]*viewer),
+		remote:     make(map[uuid.UUID]map[uuid.UUID]*models.ViewerPresence),
+		server:     uuid.New(),
+		pubsub:     ps,
+	}
+
+	// subscribe before the first viewer joins, no list of another server gets lost
+	go vs.share(ps.Subscribe(models.AllViewersTopic, context.Background(), 100))
+
+	return vs
+}
+
+func (vs *viewers) join(v *viewer) {
+	vs.lock.Lock()
+	if _, ok := vs.byAquarium[v.AquariumID]; !ok {
+		vs.byAquarium[v.AquariumID] = make(map[uuid.UUID]*viewer)
+	}
+	vs.byAquarium[v.AquariumID][v.ID] = v
+
+	vs.notify(v.AquariumID)
+	vs.lock.Unlock()
+
+	vs.publish(v.AquariumID)
+}
+
+func (vs *viewers) leave(v *viewer) {
+	vs.lock.Lock()
+	delete(vs.byAquarium[v.AquariumID], v.ID)
+	if len(vs.byAquarium[v.AquariumID]) == 0 {
+		delete(vs.byAquarium, v.AquariumID)
+	}
+
+	vs.notify(v.AquariumID)
+	vs.lock.Unlock()
+
+	vs.publish(v.AquariumID)
+}
+
+// notify sends the count of all servers to the viewers of the aquarium on this server, the lock must be held
+func (vs *viewers) notify(aquariumID uuid.UUID) {
+	count := len(vs.byAquarium[aquariumID])
+	for _, presence := range vs.remote[aquariumID] {
+		count += len(presence.Viewers)
+	}
+
+	for _, v := range vs.byAquarium[aquariumID] {
+		latest(v.count, count)
+	}
+}
+
+// publish sends the viewers of the aquarium on this server to the other servers, an empty list
+// tells them this server has none anymore. The lock must not be held, publishing can wait for share.
+func (vs *viewers) publish(aquariumID uuid.UUID) {
+	vs.lock.Lock()
+	presence := &models.ViewerPresence{
+		Server:  vs.server,
+		Viewers: make([]models.Viewer, 0, len(vs.byAquarium[aquariumID])),
+		Expires: time.Now().Add(presenceTimeout),
+	}
+	for _, v := range vs.byAquarium[aquariumID] {
+		presence.Viewers = append(presence.Viewers, v.Viewer)
+	}
+	vs.lock.Unlock()
+
+	vs.pubsub.Publish(models.ViewersTopic(aquariumID), models.NewViewerPresenceEvent(aquariumID, presence))
+}
+
+// share keeps the lists of the other servers and sends the own ones every presenceInterval until pubsub is closed
+func (vs *viewers) share(sub *pubsub.Subscription[models.Event]) {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, aquariumID := range vs.expire() {
+				vs.publish(aquariumID)
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if event.Presence == nil || event.Presence.Server == vs.server {
+				continue
+			}
+
+			// a new server learns about the viewers here right away
+			if vs.receive(event.AquariumID, event.Presence) {
+				vs.publish(event.AquariumID)
+			}
+		}
+	}
+}
+
+// receive replaces the list of another server, it reports true if the server was unknown
+// and this server has viewers of the aquarium or the slots here changed
+func (vs *viewers) receive(aquariumID uuid.UUID, presence *models.ViewerPresence) bool {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	servers, ok := vs.remote[aquariumID]
+	if !ok {
+		servers = make(map[uuid.UUID]*models.ViewerPresence)
+		vs.remote[aquariumID] = servers
+	}
+	_, known := servers[presence.Server]
+
+	if len(presence.Viewers) == 0 {
+		delete(servers, presence.Server)
+		if len(servers) == 0 {
+			delete(vs.remote, aquariumID)
+		}
+	} else {
+		servers[presence.Server] = presence
+	}
+	changed := vs.resolve(aquariumID, presence)
+
+	vs.notify(aquariumID)
+	return changed || !known && len(presence.Viewers) > 0 && len(vs.byAquarium[aquariumID]) > 0
+}
+
+// resolve settles the slots two servers gave away before they heard from each other, it reports true if a slot
+// here changed. The lock must be held and presence has to be stored already.
+func (vs *viewers) resolve(aquariumID uuid.UUID, presence *models.ViewerPresence) bool {
+	changed := false
+	for _, v := range vs.byAquarium[aquariumID] {
+		if v.Slot == noSlot {
+			continue
+		}
+		for _, o := range presence.Viewers {
+			if o.Slot != v.Slot || !displaces(o, v.Viewer) {
+				continue
+			}
+
+			changed = true
+			if o.AutoSlot {
+				// both took the first free slot, the one of o is taken now
+				vs.assign(v, v.slots)
+				break
+			}
+			// displaced viewers stay off the wall until they claim again
+			v.Slot, v.claim = noSlot, noSlot
+			latest(v.slot, noSlot)
+			break
+		}
+	}
+	return changed
+}
+
+// displaces reports if a keeps the slot b holds too. Asking for a slot beats taking the first free one, the later
+// request keeps a slot both asked for and the earlier one a slot both took as the first free one. The viewer ID
+// breaks ties, all servers decide the same.
+func displaces(a, b models.Viewer) bool {
+	if a.AutoSlot != b.AutoSlot {
+		return !a.AutoSlot
+	}
+	if !a.ClaimedAt.Equal(b.ClaimedAt) {
+		return a.ClaimedAt.After(b.ClaimedAt) != a.AutoSlot
+	}
+	return a.ID.String() > b.ID.String()
+}
+
+// expire forgets the lists of servers that stopped sending and returns the aquariums with viewers on this server
+func (vs *viewers) expire() []uuid.UUID {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	now := time.Now()
+	for aquariumID, servers := range vs.remote {
+		expired := false
+		for server, presence := range servers {
+			if presence.Expires.Before(now) {
+				delete(servers, server)
+				expired = true
+			}
+		}
+		if len(servers) == 0 {
+			delete(vs.remote, aquariumID)
+		}
+		if expired {
+			vs.notify(aquariumID)
+		}
+	}
+
+	aquariumIDs := make([]uuid.UUID, 0, len(vs.byAquarium))
+	for aquariumID := range vs.byAquarium {
+		aquariumIDs = append(aquariumIDs, aquariumID)
+	}
+	return aquariumIDs
+}
+
+// latest replaces the value waiting in ch, only the latest value matters
+func latest[T any](ch chan T, value T) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- value
+}
+
+// claim gives v the requested slot of a wall with count slots, the viewer holding it before loses it.
+// slotAuto takes the first free slot on all servers, v gets noSlot if there is none.
+func (vs *viewers) claim(v *viewer, slot int, count int) {
+	vs.lock.Lock()
+	v.claim = slot
+	vs.assign(v, count)
+	vs.lock.Unlock()
+
+	// the other servers learn about the slot right away
+	vs.publish(v.AquariumID)
+}
+
+// reclaim claims the slot v asked for again, e.g. when the wall changed
+func (vs *viewers) reclaim(v *viewer, count int) {
+	vs.lock.Lock()
+	if v.claim == noSlot {
+		vs.lock.Unlock()
+		return
+	}
+	vs.assign(v, count)
+	vs.lock.Unlock()
+
+	vs.publish(v.AquariumID)
+}
+
+// assign gives v the slot it claimed, the lock must be held
+func (vs *viewers) assign(v *viewer, count int) {
+	others := vs.byAquarium[v.AquariumID]
+	slot := v.claim
+	v.slots = count
+
+	if slot == slotAuto {
+		taken := make(map[int]bool)
+		for _, o := range others {
+			if o != v && o.Slot != noSlot {
+				taken[o.Slot] = true
+			}
+		}
+		for _, presence := range vs.remote[v.AquariumID] {
+			for _, o := range presence.Viewers {
+				if o.Slot != noSlot {
+					taken[o.Slot] = true
+				}
+			}
+		}
+
+		slot = noSlot
+		for i := 0; i < count; i++ {
+			if !taken[i] {
+				slot = i
+				break
+			}
+		}
+	}
+	if slot >= count {
+		slot = noSlot
+	}
+
+	if slot != noSlot {
+		for _, o := range others {
+			if o != v && o.Slot == slot {
+				// displaced viewers stay off the wall until they claim again
+				o.Slot, o.claim = noSlot, noSlot
+				latest(o.slot, noSlot)
+			}
+		}
+	}
+
+	if slot != v.Slot {
+		v.ClaimedAt = time.Now()
+	}
+	v.Slot, v.AutoSlot = slot, v.claim == slotAuto
+	latest(v.slot, slot)
+}
+
+// slotOf returns the slot of v
+func (vs *viewers) slotOf(v *viewer) int {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	return v.Slot
+}
+
+// send queues a message for v only, it is dropped if v does not keep up
+func (vs *viewers) send(v *viewer, msg streamMessage) {
+	select {
+	case v.direct <- msg:
+	default:
+	}
+}
+
+// update changes v while nobody reads it
+func (vs *viewers) update(v *viewer, change func(v *viewer)) {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	change(v)
+}
+
+// list returns the viewers of the aquarium on all servers, the longest connected first
+func (vs *viewers) list(aquariumID uuid.UUID) []models.Viewer {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+
+	list := make([]models.Viewer, 0, len(vs.byAquarium[aquariumID]))
+	for _, v := range vs.byAquarium[aquariumID] {
+		list = append(list, v.Viewer)
+	}
+	for _, presence := range vs.remote[aquariumID] {
+		list = append(list, presence.Viewers...)
+	}
+	slices.SortFunc(list, func(a, b models.Viewer) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+
+	return list
+}
@@ -0,0 +1,67 @@
+package webserver
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+func TestViewers(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/aquarium/" + aquarium.ID.String() + "/ws"
+	foyer, _, err := websocket.DefaultDialer.Dial(url+"?display=Foyer", nil)
+	require.NoError(t, err)
+	defer foyer.Close()
+	assert.Equal(t, 1.0, readWSMessage(t, foyer, "viewers")["data"].(map[string]interface{})["count"])
+
+	// everyone gets the new count
+	phone, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer phone.Close()
+	assert.Equal(t, 2.0, readWSMessage(t, phone, "viewers")["data"].(map[string]interface{})["count"])
+	assert.Equal(t, 2.0, readWSMessage(t, foyer, "viewers")["data"].(map[string]interface{})["count"])
+
+	require.NoError(t, phone.WriteJSON(map[string]interface{}{"type": "register", "display": "Handy"}))
+	require.Eventually(t, func() bool {
+		list := server.ws.viewers.list(aquarium.ID)
+		return len(list) == 2 && list[1].Display == "Handy"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	list := server.ws.viewers.list(aquarium.ID)
+	assert.Equal(t, "Foyer", list[0].Display)
+	assert.Equal(t, "ws", list[0].Transport)
+
+	// the Admin Panel lists the viewers
+	res, err := http.Get(server.URL + "/admin/aquarium/" + aquarium.ID.String())
+	require.NoError(t, err)
+	page, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Contains(t, string(page), "Zuschauer (2)")
+	assert.Contains(t, string(page), "Foyer")
+
+	// a moderator disconnects the phone
+	res, err = http.Post(server.URL+"/admin/aquarium/"+aquarium.ID.String()+"/viewers/"+list[1].ID.String()+"/disconnect", "", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	readWSMessage(t, phone, "disconnect")
+	_, _, err = phone.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+
+	assert.Equal(t, 1.0, readWSMessage(t, foyer, "viewers")["data"].(map[string]interface{})["count"])
+	assert.Len(t, server.ws.viewers.list(aquarium.ID), 1)
+}
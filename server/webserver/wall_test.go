@@ -0,0 +1,112 @@
+package webserver
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/superbarne/fish/models"
+)
+
+func TestWall(t *testing.T) {
+	t.Parallel()
+
+	server := newTestServer(t)
+	store := server.store
+	aquarium := &models.Aquarium{ID: uuid.New()}
+	require.NoError(t, store.InsertAquarium(aquarium))
+
+	setWall := func(columns string) {
+		res, err := http.PostForm(server.URL+"/admin/aquarium/"+aquarium.ID.String()+"/wall", url.Values{
+			"columns": {columns},
+			"rows":    {"1"},
+			"width":   {"1920"},
+			"height":  {"1080"},
+		})
+		require.NoError(t, err)
+		res.Body.Close()
+	}
+	viewport := func(conn *websocket.Conn) map[string]interface{} {
+		return readWSMessage(t, conn, "viewport")["data"].(map[string]interface{})
+	}
+
+	setWall("3")
+
+	base := "ws" + strings.TrimPrefix(server.URL, "http") + "/aquarium/" + aquarium.ID.String() + "/ws"
+	left, _, err := websocket.DefaultDialer.Dial(base+"?slot=auto", nil)
+	require.NoError(t, err)
+	defer left.Close()
+	middle, _, err := websocket.DefaultDialer.Dial(base+"?slot=auto", nil)
+	require.NoError(t, err)
+	defer middle.Close()
+
+	// the first free slots, side by side
+	vp := viewport(left)
+	assert.Equal(t, 0.0, vp["slot"])
+	assert.Equal(t, 0.0, vp["x"])
+	assert.Equal(t, 5760.0, vp["canvas_width"])
+	assert.NotZero(t, vp["time"])
+	vp = viewport(middle)
+	assert.Equal(t, 1.0, vp["slot"])
+	assert.Equal(t, 1920.0, vp["x"])
+
+	// a newer display takes over a slot
+	replacement, _, err := websocket.DefaultDialer.Dial(base, nil)
+	require.NoError(t, err)
+	defer replacement.Close()
+	require.NoError(t, replacement.WriteJSON(map[string]interface{}{"type": "claim", "slot": 1}))
+	assert.Equal(t, 1.0, viewport(replacement)["slot"])
+	assert.Equal(t, -1.0, viewport(middle)["slot"])
+
+	// shared clock
+	require.NoError(t, left.WriteJSON(map[string]interface{}{"type": "time", "client": 42}))
+	clock := readWSMessage(t, left, "time")["data"].(map[string]interface{})
+	assert.Equal(t, 42.0, clock["client"])
+	assert.NotZero(t, clock["server"])
+
+	// a boid swims from the left to the middle screen
+	sendHandoff := func(conn *websocket.Conn, fishID uuid.UUID, boid int) {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "handoff", "handoff": map[string]interface{}{
+			"fish_id": fishID, "boid": boid, "x": 1921, "y": 500, "vx": 120, "vy": 0, "time": 1000,
+		}}))
+	}
+	fish := &models.Fish{ID: uuid.New(), AquariumID: aquarium.ID, Approved: true, Status: models.FishStatusReady}
+	require.NoError(t, store.InsertFish(aquarium.ID, fish))
+	hidden := &models.Fish{ID: uuid.New(), AquariumID: aquarium.ID}
+	require.NoError(t, store.InsertFish(aquarium.ID, hidden))
+	offWall, _, err := websocket.DefaultDialer.Dial(base, nil)
+	require.NoError(t, err)
+	defer offWall.Close()
+
+	// displays off the wall, fishes nobody sees and floods are dropped
+	sendHandoff(offWall, fish.ID, 1)
+	sendHandoff(left, hidden.ID, 2)
+	time.Sleep(wsInteractionInterval)
+	sendHandoff(left, fish.ID, 3)
+	sendHandoff(left, fish.ID, 4)
+	time.Sleep(wsInteractionInterval)
+	sendHandoff(left, fish.ID, 5)
+
+	handoff := readWSMessage(t, replacement, "fishhandoff")["data"].(map[string]interface{})
+	assert.Equal(t, fish.ID.String(), handoff["fish_id"])
+	assert.Equal(t, 0.0, handoff["from"])
+	assert.Equal(t, 3.0, handoff["boid"])
+	assert.Equal(t, 1921.0, handoff["x"])
+	handoff = readWSMessage(t, replacement, "fishhandoff")["data"].(map[string]interface{})
+	assert.Equal(t, 5.0, handoff["boid"])
+
+	// a smaller wall leaves no room for the second screen
+	setWall("1")
+	assert.Equal(t, 0.0, viewport(left)["slot"])
+	assert.Equal(t, -1.0, viewport(replacement)["slot"])
+
+	// without wall every display shows the whole aquarium
+	setWall("0")
+	assert.Equal(t, -1.0, viewport(left)["slot"])
+}
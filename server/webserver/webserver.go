@@ -6,12 +6,18 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	"github.com/superbarne/fish/assets/app"
+	"github.com/superbarne/fish/jobs"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/owner"
 	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/sim"
+	"github.com/superbarne/fish/snapshot"
 	"github.com/superbarne/fish/storage"
 	"github.com/superbarne/fish/views"
 )
@@ -24,17 +30,35 @@ type WebServer struct {
 	tmpl      *template.Template
 	log       *slog.Logger
 
-	pubsub  *pubsub.PubSub
+	pubsub  pubsub.Broker[models.Event]
 	storage *storage.Storage
+	jobs    *jobs.Queue
+
+	// etags caches the content hashes of served images by path
+	etags sync.Map
+	// viewers are the displays connected to this server and the other servers
+	viewers *viewers
+	// sims run the simulated aquariums while displays watch them
+	sims *sim.Manager
+	// snapshots renders the aquariums to pictures
+	snapshots *snapshot.Renderer
+	// owners signs the tokens uploaders change their fishes with
+	owners *owner.Signer
 }
 
-func NewWebServer(log *slog.Logger, pubsub *pubsub.PubSub, store *storage.Storage, gitCommit string) *WebServer {
+func NewWebServer(log *slog.Logger, pubsub pubsub.Broker[models.Event], store *storage.Storage, queue *jobs.Queue, gitCommit string) *WebServer {
 	tmpl, err := template.ParseFS(views.Views, "*.html")
 	if err != nil {
 		log.Error("Failed to parse templates", slog.String("error", err.Error()))
 		os.Exit(1)
 	}
 
+	owners, err := newOwnerSigner(store)
+	if err != nil {
+		log.Error("Failed to create owner signer", slog.String("error", err.Error()))
+		os.Exit(1)
+	}
+
 	ws := &WebServer{
 		router:    chi.NewRouter(),
 		tmpl:      tmpl,
@@ -42,6 +66,11 @@ func NewWebServer(log *slog.Logger, pubsub *pubsub.PubSub, store *storage.Storag
 		gitCommit: gitCommit,
 		pubsub:    pubsub,
 		storage:   store,
+		jobs:      queue,
+		viewers:   newViewers(pubsub),
+		sims:      sim.NewManager(log, store, pubsub),
+		snapshots: snapshot.NewRenderer(store),
+		owners:    owners,
 	}
 
 	// add chi middlewares
@@ -52,11 +81,30 @@ func NewWebServer(log *slog.Logger, pubsub *pubsub.PubSub, store *storage.Storag
 	ws.router.Use(cors.AllowAll().Handler)
 
 	ws.router.Get("/", ws.getLandingPage)
+	ws.router.Get("/upload", ws.uploadFish)
+	ws.router.Post("/upload", ws.uploadFish)
+	ws.router.Route("/uploads/{jobID}", func(r chi.Router) {
+		r.With(middleware.NoCache).Get("/", ws.getUploadStatus)
+		// the ownership cookie is only sent below /uploads/<jobID>
+		r.With(middleware.NoCache).Get("/job.json", ws.getJob)
+		r.Post("/image", ws.reuploadOwnerFish)
+		r.Get("/fishes/{fishID}.png", ws.getJobFishImage)
+		r.Get("/fishes/{fishID}/card.png", ws.getJobFishCard)
+		r.Post("/fishes/{fishID}/name", ws.renameOwnerFish)
+		r.Post("/fishes/{fishID}/delete", ws.deleteOwnerFish)
+	})
+	ws.router.With(middleware.NoCache).Get("/jobs/{jobID}", ws.getJob)
 	ws.router.Handle("/assets/*", http.StripPrefix("/assets/", http.FileServerFS(app.Assets)))
 
 	ws.router.Route("/aquarium", func(r chi.Router) {
 		r.Route("/{aquariumID:[a-f0-9]{8}-[a-f0-9]{4}-4[a-f0-9]{3}-[89aAbB][a-f0-9]{3}-[a-f0-9]{12}}", func(r chi.Router) {
 			r.Get("/fishes/{fishID}.png", ws.getFishImage)
+			r.Get("/fishes/{fishID}/card.png", ws.getFishCard)
+			r.Get("/fishes/{fishID}/outline.json", ws.getFishOutlineJSON)
+			r.Get("/fishes/{fishID}/outline.svg", ws.getFishOutlineSVG)
+			r.Get("/template.png", ws.getAquariumTemplate)
+			r.Get("/snapshot.png", ws.getAquariumSnapshot(snapshot.PNG))
+			r.Get("/snapshot.gif", ws.getAquariumSnapshot(snapshot.GIF))
 
 			r.Group(func(r chi.Router) {
 				r.Use(middleware.NoCache)
@@ -64,6 +112,9 @@ func NewWebServer(log *slog.Logger, pubsub *pubsub.PubSub, store *storage.Storag
 				r.Get("/", ws.uploadAquariumFish)
 				r.Post("/", ws.uploadAquariumFish)
 				r.Get("/sse", ws.sseAquarium)
+				r.Get("/ws", ws.wsAquarium)
+				r.Get("/fishes/{fishID}", ws.getFishPage)
+				r.Get("/fishes/{fishID}/state.json", ws.getFishState)
 			})
 		})
 		r.Handle("/*", http.StripPrefix("/aquarium", http.FileServer(http.Dir("./assets/aquarium"))))
@@ -71,12 +122,31 @@ func NewWebServer(log *slog.Logger, pubsub *pubsub.PubSub, store *storage.Storag
 
 	ws.router.Route("/admin", func(r chi.Router) {
 		r.Get("/", ws.listAdminAquariums)
+		r.Get("/sse", ws.sseAdmin)
 		r.Route("/aquarium/{aquariumID:[a-f0-9]{8}-[a-f0-9]{4}-4[a-f0-9]{3}-[89aAbB][a-f0-9]{3}-[a-f0-9]{12}}", func(r chi.Router) {
 			r.Get("/", ws.showAdminAquarium)
+			r.Post("/name", ws.renameAdminAquarium)
 			r.Post("/approval", ws.toggleAdminNeedApproval)
+			r.Post("/split", ws.toggleAdminSplitFishes)
+			r.Post("/duplicates", ws.setAdminDuplicatePolicy)
+			r.Post("/names", ws.setAdminNamePolicy)
+			r.Post("/wall", ws.setAdminWall)
+			r.Post("/simulation", ws.setAdminSimulation)
+			r.Post("/reprocess", ws.reprocessAdminAquarium)
+			r.Get("/snapshot.png", ws.getAdminAquariumSnapshot(snapshot.PNG))
+			r.Get("/snapshot.gif", ws.getAdminAquariumSnapshot(snapshot.GIF))
+			r.Post("/viewers/{viewerID}/{action}", ws.commandAdminViewer)
 			r.Route("/fishes/{fishID:[a-f0-9]{8}-[a-f0-9]{4}-4[a-f0-9]{3}-[89aAbB][a-f0-9]{3}-[a-f0-9]{12}}", func(r chi.Router) {
 				r.Post("/delete", ws.deleteAdminFish)
 				r.Post("/approve", ws.approveAdminFish)
+				r.Get("/reprocess", ws.showAdminFishReprocess)
+				r.Post("/reprocess", ws.reprocessAdminFish)
+				r.Get("/original", ws.getAdminFishOriginal)
+				r.Get("/preview", ws.getAdminFishPreview)
+				r.Get("/mask", ws.showAdminFishMask)
+				r.Post("/mask", ws.saveAdminFishMask)
+				r.Get("/source.png", ws.getAdminFishSource)
+				r.Get("/image.png", ws.getAdminFishImage)
 			})
 		})
 	})
@@ -0,0 +1,43 @@
+package webserver
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/superbarne/fish/jobs"
+	"github.com/superbarne/fish/models"
+	"github.com/superbarne/fish/pubsub"
+	"github.com/superbarne/fish/storage"
+)
+
+// testServer is a running server with its storage and broker
+type testServer struct {
+	*httptest.Server
+	ws     *WebServer
+	store  *storage.Storage
+	pubsub pubsub.Broker[models.Event]
+}
+
+// newTestServer starts a server with its own storage and an in-process broker
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	return startTestServer(t, storage.NewStorage(t.TempDir()), pubsub.NewPubSub[models.Event]())
+}
+
+// startTestServer starts a server on store and ps. The job queue is not started, jobs stay pending.
+func startTestServer(t *testing.T, store *storage.Storage, ps pubsub.Broker[models.Event]) *testServer {
+	t.Helper()
+
+	queue := jobs.NewQueue(slog.Default(), store, nil, 1, 10, 0)
+	ws := NewWebServer(slog.Default(), ps, store, queue, "test")
+	server := httptest.NewServer(ws.router)
+	t.Cleanup(func() {
+		// end the streams before the server waits for them
+		ps.Close()
+		server.Close()
+	})
+
+	return &testServer{Server: server, ws: ws, store: store, pubsub: ps}
+}